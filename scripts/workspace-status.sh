@@ -0,0 +1,21 @@
+#!/bin/bash
+#
+# Copyright 2019 The Cloud Robotics Authors
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Prints the stamp variables for "bazel build --stamp", which are linked into
+# binaries by //src/go/pkg/version.
+
+echo "STABLE_GIT_COMMIT $(git rev-parse HEAD 2>/dev/null || echo unknown)"
+echo "STABLE_VERSION $(git describe --tags --always --dirty 2>/dev/null || echo unknown)"
@@ -0,0 +1,116 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// Annotation on upstream objects with the reason why an admission
+	// webhook in the downstream cluster rejected the object.
+	annotationAdmissionRejected = "cr-syncer.cloudrobotics.com/admission-rejected"
+
+	// Rejected objects are retried after this interval instead of the
+	// rate-limited backoff, as the webhook will likely keep rejecting
+	// them until the object or the webhook changes.
+	admissionRejectedBackoff = 10 * time.Minute
+)
+
+var mAdmissionRejections = stats.Int64(
+	"cr-syncer.cloudrobotics.com/admission_rejections",
+	"Downstream writes rejected by admission webhooks",
+	stats.UnitDimensionless,
+)
+
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "cr-syncer.cloudrobotics.com/admission_rejections_total",
+			Description: "Total number of downstream writes rejected by admission webhooks",
+			Measure:     mAdmissionRejections,
+			TagKeys:     []tag.Key{tagResource},
+			Aggregation: view.Count(),
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// admissionRejectedError is returned by the sync functions if an admission
+// webhook rejected the write of an object.
+type admissionRejectedError struct {
+	apiError
+}
+
+// isAdmissionRejection returns true if the error was returned because an
+// admission webhook denied the request.
+func isAdmissionRejection(err error) bool {
+	status, ok := err.(*errors.StatusError)
+	if !ok {
+		return false
+	}
+	switch status.ErrStatus.Code {
+	case http.StatusBadRequest, http.StatusForbidden:
+		return strings.Contains(status.ErrStatus.Message, "admission webhook")
+	}
+	return false
+}
+
+// setAdmissionRejected records the reason of an admission rejection in the
+// annotations of the upstream object, or removes it if msg is empty. The
+// object is only written if the annotation changes.
+func (s *crSyncer) setAdmissionRejected(key string, o *unstructured.Unstructured, msg string) {
+	if len(msg) > maxSyncErrorLength {
+		msg = msg[:maxSyncErrorLength-3] + "..."
+	}
+	if o.GetAnnotations()[annotationAdmissionRejected] == msg {
+		return
+	}
+	var value interface{} // Removes the annotation.
+	if msg != "" {
+		value = msg
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				annotationAdmissionRejected: value,
+			},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	updated, err := s.upstream.Namespace(o.GetNamespace()).Patch(o.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		if !isNotFoundError(err) {
+			log.Printf("Failed to record admission rejection of %s: %s", key, err)
+		}
+		return
+	}
+	s.recordSelfWrite(key, updated.GetResourceVersion())
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stest "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func webhookDenied(code int32) error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    code,
+		Message: `admission webhook "validate.example.com" denied the request: spec is invalid`,
+	}}
+}
+
+func TestIsAdmissionRejection(t *testing.T) {
+	tests := []struct {
+		desc string
+		err  error
+		want bool
+	}{
+		{"bad request", webhookDenied(http.StatusBadRequest), true},
+		{"forbidden", webhookDenied(http.StatusForbidden), true},
+		{"other code", webhookDenied(http.StatusInternalServerError), false},
+		{"not a webhook", apierrors.NewBadRequest("invalid object"), false},
+		{"not a status error", errors.New("admission webhook failed"), false},
+	}
+	for _, tc := range tests {
+		if got := isAdmissionRejection(tc.err); got != tc.want {
+			t.Errorf("%s: isAdmissionRejection() = %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestProcessNextWorkItem_backsOffOnAdmissionRejection(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", "status1"))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+
+	f.local.PrependReactor("create", "*", func(k8stest.Action) (bool, runtime.Object, error) {
+		return true, nil, webhookDenied(http.StatusBadRequest)
+	})
+
+	// Use a separate queue, as the informers fill the syncer's queues.
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	q.Add("default/resource1")
+	crs.processNextWorkItem(context.Background(), q, crs.reconcileUpstream, "upstream")
+
+	// The key is requeued after admissionRejectedBackoff instead of the
+	// rate limiter's backoff.
+	if n := q.NumRequeues("default/resource1"); n != 0 {
+		t.Errorf("got %d rate-limited requeues, want 0", n)
+	}
+	if n := q.Len(); n != 0 {
+		t.Errorf("got %d queued keys, want 0", n)
+	}
+
+	o, err := f.remote.Resource(gvr).Namespace("default").Get("resource1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := o.GetAnnotations()[annotationAdmissionRejected]; got == "" {
+		t.Errorf("resource1 has no %s annotation", annotationAdmissionRejected)
+	}
+}
+
+func TestSyncUpstream_clearsAdmissionRejection(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	tcrRemote := newTestCR("resource1", "spec1", "status1")
+	tcrRemote.SetAnnotations(map[string]string{annotationAdmissionRejected: "denied"})
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := f.remote.Resource(gvr).Namespace("default").Get("resource1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := o.GetAnnotations()[annotationAdmissionRejected]; ok {
+		t.Errorf("resource1 still has %s annotation %q", annotationAdmissionRejected, got)
+	}
+}
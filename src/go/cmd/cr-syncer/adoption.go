@@ -0,0 +1,78 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"strings"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// CRD annotation that controls which existing downstream objects the
+	// syncer manages. With "adopt", the default, it manages all objects
+	// with the name of an upstream object. With "strict", it only manages
+	// objects that it created or that were marked for adoption.
+	annotationAdoption = "cr-syncer.cloudrobotics.com/adoption"
+	adoptionStrict     = "strict"
+
+	// Annotation on downstream objects that are managed by the syncer. It's
+	// set on the objects the syncer writes if adoption is strict, and can
+	// be set manually to adopt existing objects.
+	annotationOwnedByUpstream = "cr-syncer.cloudrobotics.com/owned-by-upstream"
+)
+
+// parseStrictAdoption returns true if the CRD requires strict adoption.
+func parseStrictAdoption(crd crdtypes.CustomResourceDefinition) bool {
+	switch value := crd.ObjectMeta.Annotations[annotationAdoption]; value {
+	case adoptionStrict:
+		return true
+	case "", "adopt":
+		return false
+	default:
+		log.Printf("Value for %s must be adopt or strict on %s, got %q, using strict",
+			annotationAdoption, crd.ObjectMeta.Name, value)
+		return true
+	}
+}
+
+// isForeign returns true if adoption is strict and the downstream object o
+// wasn't created or adopted by the syncer, so it must be left untouched.
+// Objects are adopted if they have the owned-by-upstream annotation, or a
+// synced-by annotation of a syncer on this robot.
+func (s *crSyncer) isForeign(o *unstructured.Unstructured) bool {
+	if !s.strictAdoption {
+		return false
+	}
+	annotations := o.GetAnnotations()
+	if annotations[annotationOwnedByUpstream] == "true" {
+		return false
+	}
+	syncedBy := annotations[annotationSyncedBy]
+	if syncedBy == "" {
+		return true
+	}
+	return syncedBy != s.instance && (s.robotName == "" || !strings.HasPrefix(syncedBy, s.robotName+"/"))
+}
+
+// markOwnedByUpstream sets the owned-by-upstream annotation on a downstream
+// object that is about to be written, if adoption is strict.
+func (s *crSyncer) markOwnedByUpstream(o *unstructured.Unstructured) {
+	if s.strictAdoption {
+		setAnnotation(o, annotationOwnedByUpstream, "true")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSync_strictAdoptionSkipsForeignObjects(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationAdoption] = adoptionStrict
+	f := newFixture(t)
+
+	// resource1 exists downstream, but belongs to another system.
+	f.addRemoteObjects(newTestCR("resource1", "spec1", "status1"))
+	f.addLocalObjects(newTestCR("resource1", "foreign-spec", "foreign-status"))
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The foreign object is neither updated nor is its status synced.
+	f.verifyWriteActions()
+}
+
+func TestSyncUpstream_strictAdoptionManagesOwnedObjects(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationAdoption] = adoptionStrict
+	f := newFixture(t)
+
+	// resource1 was adopted explicitly, resource2 isn't synced yet.
+	tcrAdopted := newTestCR("resource1", "spec1", "status1")
+	setAnnotation(tcrAdopted, annotationOwnedByUpstream, "true")
+	f.addRemoteObjects(
+		newTestCR("resource1", "spec1-new", "status1"),
+		newTestCR("resource2", "spec2", nil),
+	)
+	f.addLocalObjects(tcrAdopted)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+	for _, key := range []string{"default/resource1", "default/resource2"} {
+		if err := crs.syncUpstream(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Created objects are marked, so they stay managed.
+	tcrUpdated := newTestCR("resource1", "spec1-new", "status1")
+	setAnnotation(tcrUpdated, annotationOwnedByUpstream, "true")
+	tcrCreated := newTestCR("resource2", "spec2", nil)
+	setAnnotation(tcrCreated, annotationOwnedByUpstream, "true")
+	f.expectLocalActions(
+		k8stest.NewUpdateAction(gvr, "default", tcrUpdated),
+		k8stest.NewCreateAction(gvr, "default", tcrCreated),
+	)
+	f.verifyWriteActions()
+}
+
+func TestIsForeign(t *testing.T) {
+	crs := &crSyncer{strictAdoption: true, robotName: "robot1", instance: "robot1/cr-syncer-abc"}
+	for _, tc := range []struct {
+		annotations map[string]string
+		want        bool
+	}{
+		{nil, true},
+		{map[string]string{annotationOwnedByUpstream: "true"}, false},
+		{map[string]string{annotationSyncedBy: "robot1/cr-syncer-abc"}, false},
+		// Written by an earlier pod of the syncer.
+		{map[string]string{annotationSyncedBy: "robot1/cr-syncer-xyz"}, false},
+		{map[string]string{annotationSyncedBy: "robot2/cr-syncer-abc"}, true},
+		{map[string]string{annotationOwnedByUpstream: "false"}, true},
+	} {
+		o := newTestCR("resource1", "spec1", nil)
+		o.SetAnnotations(tc.annotations)
+		if got := crs.isForeign(o); got != tc.want {
+			t.Errorf("isForeign(%v) = %t, want %t", tc.annotations, got, tc.want)
+		}
+	}
+	crs.strictAdoption = false
+	if crs.isForeign(newTestCR("resource1", "spec1", nil)) {
+		t.Error("isForeign() = true without strict adoption")
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Replaces the values of redacted fields in audit diffs.
+const redactedValue = "<redacted>"
+
+// Formats of the audit file: JSON lines or a stream of YAML documents.
+const (
+	auditFormatJSON = "json"
+	auditFormatYAML = "yaml"
+)
+
+// auditLog receives an entry for each object written downstream or each
+// status written upstream, nil if -audit-file isn't set.
+var auditLog *auditWriter
+
+// auditWriter writes audit entries as JSON lines, or as YAML documents if
+// the format is auditFormatYAML.
+type auditWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	// Dotted paths of fields whose values are masked in diffs.
+	redact []string
+	format string
+}
+
+// auditEntry describes a single write.
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	CRD       string    `json:"crd"`
+	Key       string    `json:"key"`
+	Direction string    `json:"direction"`
+	Result    Result    `json:"result"`
+	// Changed fields by dotted path.
+	Diff map[string]fieldChange `json:"diff,omitempty"`
+}
+
+// fieldChange holds the old and new value of a changed field. Missing values
+// are null.
+type fieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+func newAuditWriter(w io.Writer, redact []string) *auditWriter {
+	return &auditWriter{w: w, redact: redact}
+}
+
+// openAuditLog opens the file for appending audit entries in the given
+// format.
+func openAuditLog(path string, redact []string, format string) (*auditWriter, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %s", err)
+	}
+	a := newAuditWriter(f, redact)
+	a.format = format
+	return a, nil
+}
+
+// encode returns the entry as a JSON line, or as a YAML document that starts
+// with a separator, so that appended entries form a multi-document stream.
+func (a *auditWriter) encode(entry auditEntry) ([]byte, error) {
+	if a.format != auditFormatYAML {
+		b, err := json.Marshal(entry)
+		return append(b, '\n'), err
+	}
+	b, err := yaml.Marshal(entry)
+	return append([]byte("---\n"), b...), err
+}
+
+// parseRedactFields parses a comma-separated list of dotted field paths.
+func parseRedactFields(value string) []string {
+	var paths []string
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// isRedacted returns true if the field at the dotted path is or is inside a
+// redacted field.
+func (a *auditWriter) isRedacted(path string) bool {
+	for _, r := range a.redact {
+		if path == r || strings.HasPrefix(path, r+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// record writes an entry with the changes to the spec and status from old
+// to new. Failures are logged, as they mustn't block syncing.
+func (a *auditWriter) record(crd, key, direction string, result Result, old, new *unstructured.Unstructured) {
+	if a == nil {
+		return
+	}
+	diff := map[string]fieldChange{}
+	for _, field := range []string{"spec", "status"} {
+		var o, n interface{}
+		if old != nil {
+			o = old.Object[field]
+		}
+		if new != nil {
+			n = new.Object[field]
+		}
+		diffValues(field, o, n, diff)
+	}
+	for path, c := range diff {
+		if a.isRedacted(path) {
+			if c.Old != nil {
+				c.Old = redactedValue
+			}
+			if c.New != nil {
+				c.New = redactedValue
+			}
+			diff[path] = c
+		}
+	}
+	entry := auditEntry{
+		Time:      time.Now().UTC(),
+		CRD:       crd,
+		Key:       key,
+		Direction: direction,
+		Result:    result,
+		Diff:      diff,
+	}
+	b, err := a.encode(entry)
+	if err != nil {
+		log.Printf("Failed to encode audit entry for %s: %s", key, err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.w.Write(b); err != nil {
+		log.Printf("Failed to write audit entry for %s: %s", key, err)
+	}
+}
+
+// diffValues adds the changed leaves between old and new to diff. Dicts are
+// compared by key, all other values, including lists, as a whole.
+func diffValues(path string, old, new interface{}, diff map[string]fieldChange) {
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	// Added or removed dicts are diffed against an empty dict, so that
+	// their fields are listed and can be redacted.
+	if old == nil && newIsMap {
+		oldMap, oldIsMap = map[string]interface{}{}, true
+	}
+	if new == nil && oldIsMap {
+		newMap, newIsMap = map[string]interface{}{}, true
+	}
+	if !oldIsMap || !newIsMap {
+		if !reflect.DeepEqual(old, new) {
+			diff[path] = fieldChange{Old: old, New: new}
+		}
+		return
+	}
+	for k, v := range oldMap {
+		diffValues(path+"."+k, v, newMap[k], diff)
+	}
+	for k, v := range newMap {
+		if _, ok := oldMap[k]; !ok {
+			diffValues(path+"."+k, nil, v, diff)
+		}
+	}
+}
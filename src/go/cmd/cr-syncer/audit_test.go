@@ -0,0 +1,132 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+func TestDiffValues(t *testing.T) {
+	old := map[string]interface{}{
+		"a": "1",
+		"b": map[string]interface{}{"c": "2", "d": "3"},
+		"e": []interface{}{"x"},
+	}
+	new := map[string]interface{}{
+		"a": "1",
+		"b": map[string]interface{}{"c": "4"},
+		"e": []interface{}{"x", "y"},
+		"f": map[string]interface{}{"g": "5"},
+	}
+	diff := map[string]fieldChange{}
+	diffValues("spec", old, new, diff)
+
+	want := map[string]fieldChange{
+		"spec.b.c": {Old: "2", New: "4"},
+		"spec.b.d": {Old: "3", New: nil},
+		"spec.e":   {Old: []interface{}{"x"}, New: []interface{}{"x", "y"}},
+		"spec.f.g": {Old: nil, New: "5"},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("diffValues() = %v, want %v", diff, want)
+	}
+}
+
+func TestSyncUpstream_auditsRedactedSpecDiff(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	f.addRemoteObjects(newTestCR("resource1", map[string]interface{}{
+		"replicas": int64(2),
+		"password": "new-secret",
+	}, nil))
+	f.addLocalObjects(newTestCR("resource1", map[string]interface{}{
+		"replicas": int64(1),
+		"password": "old-secret",
+	}, nil))
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	var buf bytes.Buffer
+	crs.audit = newAuditWriter(&buf, []string{"spec.password"})
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	var entry auditEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to parse audit entry %q: %s", buf.String(), err)
+	}
+	if entry.Key != "default/resource1" || entry.Direction != "upstream" || entry.Result != ResultUpdated {
+		t.Errorf("got entry for %s %s %s, want default/resource1 upstream %s", entry.Key, entry.Direction, entry.Result, ResultUpdated)
+	}
+	want := map[string]fieldChange{
+		"spec.replicas": {Old: float64(1), New: float64(2)},
+		"spec.password": {Old: redactedValue, New: redactedValue},
+	}
+	if !reflect.DeepEqual(entry.Diff, want) {
+		t.Errorf("got diff %v, want %v", entry.Diff, want)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("secret")) {
+		t.Errorf("audit entry contains redacted value: %s", buf.String())
+	}
+}
+
+func TestAuditWriter_yamlDocuments(t *testing.T) {
+	var buf bytes.Buffer
+	a := newAuditWriter(&buf, nil)
+	a.format = auditFormatYAML
+	old := newTestCR("resource1", "spec1", "status1")
+	a.record("goals.crds.example.com", "default/resource1", "upstream", ResultUpdated, old, newTestCR("resource1", "spec2", "status1"))
+	a.record("goals.crds.example.com", "default/resource1", "downstream", ResultUpdated, old, newTestCR("resource1", "spec1", "status2"))
+
+	r := utilyaml.NewYAMLReader(bufio.NewReader(&buf))
+	var entries []auditEntry
+	for {
+		doc, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entry auditEntry
+		if err := yaml.UnmarshalStrict(doc, &entry); err != nil {
+			t.Fatalf("failed to parse audit document %q: %s", doc, err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit documents, want 2", len(entries))
+	}
+	if entries[0].Direction != "upstream" || entries[1].Direction != "downstream" {
+		t.Errorf("got directions %s, %s; want upstream, downstream", entries[0].Direction, entries[1].Direction)
+	}
+	want := map[string]fieldChange{"spec": {Old: "spec1", New: "spec2"}}
+	if !reflect.DeepEqual(entries[0].Diff, want) {
+		t.Errorf("got diff %v, want %v", entries[0].Diff, want)
+	}
+}
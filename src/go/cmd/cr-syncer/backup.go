@@ -0,0 +1,151 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// Timeout of requests to backup clusters, so that an unreachable
+	// backup doesn't hold on to its worker.
+	backupRequestTimeout = 10 * time.Second
+	// Number of retries of a failed mirror before it's given up until the
+	// object changes again.
+	maxBackupRetries = 5
+)
+
+// backupClient is a client for a cluster to which upstream specs are
+// mirrored. Backups are write-only: their status isn't synced and changes
+// or deletions in the backup cluster are never propagated. Upstream
+// deletions aren't mirrored either, so that the backup keeps the last known
+// spec of all objects.
+type backupClient struct {
+	server string
+	client dynamic.Interface
+}
+
+// Backup clusters for the syncers created by newCRSyncer.
+var backupClients []backupClient
+
+// backupResource is the client for the synced resource in a backup cluster,
+// and the queue of the keys of upstream objects to mirror to it.
+type backupResource struct {
+	server string
+	client dynamic.NamespaceableResourceInterface
+	queue  workqueue.RateLimitingInterface
+}
+
+func newBackupResource(server string, client dynamic.NamespaceableResourceInterface) backupResource {
+	return backupResource{
+		server: server,
+		client: client,
+		queue:  workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+}
+
+// mirrorToBackups queues the upstream object for mirroring to all backup
+// clusters. The backups are written by their own workers, so that failing
+// or slow backups never delay or fail the sync with the downstream cluster.
+func (s *crSyncer) mirrorToBackups(src *unstructured.Unstructured) {
+	key, ok := keyFunc(src)
+	if !ok {
+		return
+	}
+	for _, b := range s.backups {
+		b.queue.Add(key)
+	}
+}
+
+// runBackupWorkers starts a worker for each backup cluster.
+func (s *crSyncer) runBackupWorkers() {
+	for _, b := range s.backups {
+		go func(b backupResource) {
+			for s.processBackupItem(b) {
+			}
+		}(b)
+	}
+}
+
+// shutDownBackups stops the backup workers.
+func (s *crSyncer) shutDownBackups() {
+	for _, b := range s.backups {
+		b.queue.ShutDown()
+	}
+}
+
+// processBackupItem writes the labels, annotations and spec of the next
+// queued upstream object to the backup cluster. Failures are retried with
+// backoff a few times. It returns false once the queue is shut down.
+func (s *crSyncer) processBackupItem(b backupResource) bool {
+	item, quit := b.queue.Get()
+	if quit {
+		return false
+	}
+	defer b.queue.Done(item)
+	key := item.(string)
+	src, exists, err := s.getObject(s.informers().upstream, s.upstream, key)
+	if err == nil && !exists {
+		// Deletions aren't mirrored.
+		b.queue.Forget(item)
+		return true
+	}
+	if err == nil {
+		gvk := src.GroupVersionKind()
+		gvk.Group = s.remoteGroup
+		err = mirrorSpec(b.client.Namespace(src.GetNamespace()), gvk, src)
+	}
+	if err != nil {
+		if b.queue.NumRequeues(item) < maxBackupRetries {
+			log.Printf("Mirroring %s to backup %s failed, retrying: %s", key, b.server, err)
+			b.queue.AddRateLimited(item)
+			return true
+		}
+		log.Printf("Mirroring %s to backup %s failed, giving up until it changes: %s", key, b.server, err)
+	}
+	b.queue.Forget(item)
+	return true
+}
+
+func mirrorSpec(client dynamic.ResourceInterface, gvk schema.GroupVersionKind, src *unstructured.Unstructured) error {
+	o, err := client.Get(src.GetName(), metav1.GetOptions{})
+	exists := err == nil
+	if err != nil {
+		if !isNotFoundError(err) {
+			return err
+		}
+		o = &unstructured.Unstructured{Object: make(map[string]interface{})}
+		o.SetGroupVersionKind(gvk)
+		o.SetNamespace(src.GetNamespace())
+		o.SetName(src.GetName())
+	}
+	o.SetLabels(src.GetLabels())
+	o.SetAnnotations(src.GetAnnotations())
+	deleteAnnotation(o, annotationResourceVersion)
+	copySpec(src, o)
+	if exists {
+		_, err = client.Update(o, metav1.UpdateOptions{})
+	} else {
+		_, err = client.Create(o, metav1.CreateOptions{})
+	}
+	return err
+}
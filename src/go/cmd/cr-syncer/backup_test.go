@@ -0,0 +1,88 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sfake "k8s.io/client-go/dynamic/fake"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func newBackupClient(crd crdtypes.CustomResourceDefinition) *k8sfake.FakeDynamicClient {
+	s := runtime.NewScheme()
+	s.AddKnownTypeWithName(schema.GroupVersionKind{
+		Group:   crd.Spec.Group,
+		Version: crd.Spec.Version,
+		Kind:    crd.Spec.Names.Kind,
+	}, &unstructured.Unstructured{})
+	return k8sfake.NewSimpleDynamicClient(s)
+}
+
+func TestSyncUpstream_mirrorsToBackups(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	tcrRemote := newTestCR("resource1", "spec1", "status1")
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	// The second backup fails, which must not affect the others or the sync.
+	backup := newBackupClient(crd)
+	failing := newBackupClient(crd)
+	failing.PrependReactor("*", "*", func(k8stest.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("backup unavailable")
+	})
+	crs.backups = []backupResource{
+		newBackupResource("backup", backup.Resource(gvr)),
+		newBackupResource("failing", failing.Resource(gvr)),
+	}
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The primary write doesn't wait for the backups.
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", newTestCR("resource1", "spec1", "status1")))
+	f.verifyWriteActions()
+	if n := len(filterReadActions(backup.Actions())); n != 0 {
+		t.Errorf("got %d backup writes during the sync, want 0", n)
+	}
+	for _, b := range crs.backups {
+		crs.processBackupItem(b)
+	}
+	// The failing backup is retried with backoff.
+	if n := crs.backups[1].queue.NumRequeues("default/resource1"); n != 1 {
+		t.Errorf("got %d retries of the failing backup, want 1", n)
+	}
+
+	// Backups get the spec, but not the status.
+	backupWrites := filterReadActions(backup.Actions())
+	if len(backupWrites) != 1 {
+		t.Fatalf("got %d backup writes, want 1", len(backupWrites))
+	}
+	got := backupWrites[0].(k8stest.CreateActionImpl).Object.(*unstructured.Unstructured)
+	if got.GetName() != "resource1" || got.Object["spec"] != "spec1" || got.Object["status"] != nil {
+		t.Errorf("unexpected backup object %v", got)
+	}
+}
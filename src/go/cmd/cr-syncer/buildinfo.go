@@ -0,0 +1,66 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+
+	"github.com/googlecloudrobotics/core/src/go/pkg/version"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	tagVersion   = mustNewTagKey("version")
+	tagGitCommit = mustNewTagKey("git_commit")
+	tagGoVersion = mustNewTagKey("go_version")
+)
+
+var mBuildInfo = stats.Int64(
+	"cr-syncer.cloudrobotics.com/build_info",
+	"Build information of the running cr-syncer",
+	stats.UnitDimensionless,
+)
+
+func init() {
+	if err := view.Register(
+		&view.View{
+			// Follows the Prometheus convention for build info
+			// metrics, so that dashboards can count pods per version.
+			Name:        "cr_syncer_build_info",
+			Description: "Always 1, labeled with the version of the running cr-syncer",
+			Measure:     mBuildInfo,
+			TagKeys:     []tag.Key{tagVersion, tagGitCommit, tagGoVersion},
+			Aggregation: view.LastValue(),
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// recordBuildInfo sets the build info metric to 1 with the version of the
+// binary as labels.
+func recordBuildInfo() {
+	ctx, err := tag.New(context.Background(),
+		tag.Insert(tagVersion, version.Version),
+		tag.Insert(tagGitCommit, version.GitCommit),
+		tag.Insert(tagGoVersion, version.GoVersion()),
+	)
+	if err != nil {
+		panic(err)
+	}
+	stats.Record(ctx, mBuildInfo.M(1))
+}
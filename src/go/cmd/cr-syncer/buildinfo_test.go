@@ -0,0 +1,51 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/googlecloudrobotics/core/src/go/pkg/version"
+	"go.opencensus.io/stats/view"
+)
+
+func TestRecordBuildInfo(t *testing.T) {
+	recordBuildInfo()
+
+	rows, err := view.RetrieveData("cr_syncer_build_info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows, want 1: %v", len(rows), rows)
+	}
+	labels := map[string]string{}
+	for _, tag := range rows[0].Tags {
+		labels[tag.Key.Name()] = tag.Value
+	}
+	want := map[string]string{
+		"version":    version.Version,
+		"git_commit": version.GitCommit,
+		"go_version": version.GoVersion(),
+	}
+	for k, v := range want {
+		if labels[k] != v {
+			t.Errorf("label %s = %q, want %q", k, labels[k], v)
+		}
+	}
+	if got := rows[0].Data.(*view.LastValueData).Value; got != 1 {
+		t.Errorf("value = %v, want 1", got)
+	}
+}
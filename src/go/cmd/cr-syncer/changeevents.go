@@ -0,0 +1,158 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// Change Events are created at most once per object in this interval,
+	// so that objects that change often don't flood their Events.
+	changeEventInterval = time.Minute
+
+	// Prefix of the annotations that the syncer maintains itself. Changes
+	// to them aren't reported in change Events.
+	syncerAnnotationPrefix = "cr-syncer.cloudrobotics.com/"
+)
+
+// changeEventLimiter remembers when change Events were last created.
+type changeEventLimiter struct {
+	mu sync.Mutex
+	// Time of the last Event, by direction and key.
+	last map[string]time.Time
+}
+
+func newChangeEventLimiter() *changeEventLimiter {
+	return &changeEventLimiter{last: make(map[string]time.Time)}
+}
+
+// allow returns true if an Event may be created for the key, and if so,
+// remembers that it was.
+func (l *changeEventLimiter) allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.last[key]) < changeEventInterval {
+		return false
+	}
+	l.last[key] = now
+	return true
+}
+
+// forget drops what was recorded for the key.
+func (l *changeEventLimiter) forget(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.last, key)
+}
+
+// userAnnotations returns the annotations of o that aren't maintained by
+// the syncer.
+func userAnnotations(o *unstructured.Unstructured) map[string]string {
+	annotations := map[string]string{}
+	for k, v := range o.GetAnnotations() {
+		if !strings.HasPrefix(k, syncerAnnotationPrefix) {
+			annotations[k] = v
+		}
+	}
+	return annotations
+}
+
+// changedFields returns the sorted names of the top-level fields, labels and
+// annotations that differ between old and new. Other metadata is ignored.
+func changedFields(old, new *unstructured.Unstructured) []string {
+	var fields []string
+	if !reflect.DeepEqual(old.GetLabels(), new.GetLabels()) {
+		fields = append(fields, "labels")
+	}
+	if !reflect.DeepEqual(userAnnotations(old), userAnnotations(new)) {
+		fields = append(fields, "annotations")
+	}
+	keys := map[string]bool{}
+	for k := range old.Object {
+		keys[k] = true
+	}
+	for k := range new.Object {
+		keys[k] = true
+	}
+	for k := range keys {
+		switch k {
+		case "apiVersion", "kind", "metadata":
+			continue
+		}
+		if !reflect.DeepEqual(old.Object[k], new.Object[k]) {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// recordChangeEvent creates a Normal Event on the object o, which was
+// updated from old, listing the fields that changed, if
+// -record-change-events is set. from is the cluster the changes were
+// synced from. Failures are logged, as Events are best-effort.
+func (s *crSyncer) recordChangeEvent(events dynamic.NamespaceableResourceInterface, key, from string, old, o *unstructured.Unstructured) {
+	if !s.recordChangeEvents || old == nil {
+		return
+	}
+	fields := changedFields(old, o)
+	if len(fields) == 0 || !s.changeEvents.allow(from+"/"+key, time.Now()) {
+		return
+	}
+	namespace := o.GetNamespace()
+	if namespace == "" {
+		// Events of cluster-scoped objects live in the default namespace.
+		namespace = metav1.NamespaceDefault
+	}
+	now := time.Now()
+	ref := map[string]interface{}{
+		"apiVersion":      o.GetAPIVersion(),
+		"kind":            o.GetKind(),
+		"namespace":       o.GetNamespace(),
+		"name":            o.GetName(),
+		"resourceVersion": o.GetResourceVersion(),
+	}
+	if uid := o.GetUID(); uid != "" {
+		ref["uid"] = string(uid)
+	}
+	event := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion":     "v1",
+		"kind":           "Event",
+		"involvedObject": ref,
+		"type":           "Normal",
+		"reason":         "Synced",
+		"message":        fmt.Sprintf("Synced changes to %s from %s", strings.Join(fields, ", "), from),
+		"source":         map[string]interface{}{"component": "cr-syncer"},
+		"count":          int64(1),
+		"firstTimestamp": now.UTC().Format(time.RFC3339),
+		"lastTimestamp":  now.UTC().Format(time.RFC3339),
+	}}
+	event.SetNamespace(namespace)
+	event.SetName(fmt.Sprintf("%s.%x", o.GetName(), now.UnixNano()))
+	if _, err := events.Namespace(namespace).Create(event, metav1.CreateOptions{}); err != nil {
+		log.Printf("Failed to create change event for %s: %s", key, err)
+	}
+}
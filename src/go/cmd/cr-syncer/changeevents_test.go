@@ -0,0 +1,98 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestChangedFields(t *testing.T) {
+	old := newTestCR("resource1", map[string]interface{}{"foo": "spec1"}, "status1")
+	new := old.DeepCopy()
+	new.SetLabels(map[string]string{"foo": "bar"})
+	new.SetAnnotations(map[string]string{annotationResourceVersion: "2"})
+	new.SetResourceVersion("2")
+	if err := unstructured.SetNestedField(new.Object, "spec2", "spec", "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Metadata and the syncer's own annotations are ignored.
+	want := []string{"labels", "spec"}
+	if got := changedFields(old, new); !reflect.DeepEqual(got, want) {
+		t.Errorf("changedFields() = %v, want %v", got, want)
+	}
+}
+
+func TestSyncUpstream_recordsChangeEvent(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	f.addLocalObjects(newTestCR("resource1", "spec1", "status2"))
+	f.addRemoteObjects(newTestCR("resource1", "spec2", "status1"))
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.recordChangeEvents = true
+
+	crs.startInformers()
+	for i := 0; i < 2; i++ {
+		if err := crs.syncUpstream("default/resource1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := f.local.Resource(eventsResource).Namespace("default").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second sync is within the rate limit.
+	if len(list.Items) != 1 {
+		t.Fatalf("got %d downstream events, want 1: %v", len(list.Items), list.Items)
+	}
+	event := list.Items[0]
+	if typ, _, _ := unstructured.NestedString(event.Object, "type"); typ != "Normal" {
+		t.Errorf("got event type %q, want Normal", typ)
+	}
+	want := "Synced changes to spec from upstream"
+	if msg, _, _ := unstructured.NestedString(event.Object, "message"); msg != want {
+		t.Errorf("got message %q, want %q", msg, want)
+	}
+	if name, _, _ := unstructured.NestedString(event.Object, "involvedObject", "name"); name != "resource1" {
+		t.Errorf("got involved object %q, want resource1", name)
+	}
+}
+
+func TestChangeEventLimiter(t *testing.T) {
+	l := newChangeEventLimiter()
+	now := time.Now()
+	if !l.allow("default/a", now) {
+		t.Error("first event not allowed")
+	}
+	if l.allow("default/a", now.Add(time.Second)) {
+		t.Error("event within interval allowed")
+	}
+	if !l.allow("default/b", now) {
+		t.Error("event of another object not allowed")
+	}
+	if !l.allow("default/a", now.Add(changeEventInterval)) {
+		t.Error("event after interval not allowed")
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Annotation on downstream objects with a checksum of the upstream spec they
+// were last written with, written if -write-spec-checksums is set. Tooling
+// can compare it against the checksum of the upstream spec to check whether
+// the downstream object is current.
+const annotationSpecChecksum = "cr-syncer.cloudrobotics.com/spec-checksum"
+
+// specChecksum returns a stable checksum of the spec. It only covers the
+// spec, so metadata that changes on every write, like the resource version,
+// doesn't affect it. encoding/json sorts map keys, so equal specs have equal
+// checksums.
+func specChecksum(spec interface{}) (string, error) {
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b)), nil
+}
+
+// addSpecChecksum sets the spec-checksum annotation of dst if
+// -write-spec-checksums is set. The checksum covers the upstream spec
+// without create defaults, so that it can be recomputed from upstream.
+func (s *crSyncer) addSpecChecksum(src, dst *unstructured.Unstructured) error {
+	if !s.writeSpecChecksum {
+		return nil
+	}
+	checksum, err := specChecksum(src.Object["spec"])
+	if err != nil {
+		return fmt.Errorf("failed to compute spec checksum: %s", err)
+	}
+	setAnnotation(dst, annotationSpecChecksum, checksum)
+	return nil
+}
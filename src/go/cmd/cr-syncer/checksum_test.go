@@ -0,0 +1,102 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSpecChecksum(t *testing.T) {
+	a, err := specChecksum(map[string]interface{}{"a": int64(1), "b": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := specChecksum(map[string]interface{}{"b": "x", "a": int64(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Errorf("checksums of equal specs differ: %s != %s", a, b)
+	}
+	c, err := specChecksum(map[string]interface{}{"a": int64(2), "b": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == c {
+		t.Errorf("checksums of different specs are equal: %s", a)
+	}
+}
+
+func TestSyncUpstream_writesSpecChecksum(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	tcrRemote := newTestCR("resource1", "spec1", "status1")
+	tcrRemote.SetResourceVersion("1")
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.writeSpecChecksum = true
+
+	crs.startInformers()
+	checksum := func() string {
+		t.Helper()
+		if err := crs.syncUpstream("default/resource1"); err != nil {
+			t.Fatal(err)
+		}
+		o, err := f.local.Resource(gvr).Namespace("default").Get("resource1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return o.GetAnnotations()[annotationSpecChecksum]
+	}
+	want, err := specChecksum("spec1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := checksum(); got != want {
+		t.Errorf("got checksum %q after create, want %q", got, want)
+	}
+
+	// Wait for the downstream informer to see the created object, so that
+	// the next sync is an update.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, exists, _ := crs.downstreamInf.GetIndexer().GetByKey("default/resource1"); exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("informer didn't see the created object")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := checksum(); got != want {
+		t.Errorf("got checksum %q after no-op sync, want %q", got, want)
+	}
+
+	// A spec change changes the checksum.
+	tcrRemote.Object["spec"] = "spec2"
+	tcrRemote.SetResourceVersion("2")
+	if err := crs.upstreamInf.GetIndexer().Update(tcrRemote); err != nil {
+		t.Fatal(err)
+	}
+	if got := checksum(); got == want {
+		t.Errorf("checksum didn't change with the spec, got %q", got)
+	}
+}
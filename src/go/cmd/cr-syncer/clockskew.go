@@ -0,0 +1,170 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"k8s.io/client-go/rest"
+)
+
+// Interval between clock skew checks after the one at startup.
+const clockSkewCheckInterval = 10 * time.Minute
+
+var mClockSkew = stats.Float64(
+	"cr-syncer.cloudrobotics.com/clock_skew",
+	"Time of the remote API server minus the time of the local API server",
+	"s",
+)
+
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "cr-syncer.cloudrobotics.com/clock_skew",
+			Description: "Time of the remote API server minus the time of the local API server",
+			Measure:     mClockSkew,
+			Aggregation: view.LastValue(),
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// clockSkew checks the clocks of the clusters if -max-clock-skew is set,
+// nil otherwise.
+var clockSkew *clockSkewMonitor
+
+// serverOffset returns how far the clock of an API server is ahead of the
+// local clock, eg as measured by serverTimeOffset.
+type serverOffset func() (time.Duration, error)
+
+// serverTimeOffset measures the clock offset of the API server of the config
+// from the Date header of a version request, which is cheap and allowed
+// for all clients. The server time is attributed to the middle of the
+// request. The Date header has a resolution of a second.
+func serverTimeOffset(config *rest.Config) (time.Duration, error) {
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return 0, err
+	}
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+	host := config.Host
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	start := time.Now()
+	resp, err := client.Get(strings.TrimSuffix(host, "/") + "/version")
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	rtt := time.Since(start)
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid Date header %q: %s", resp.Header.Get("Date"), err)
+	}
+	return date.Sub(start.Add(rtt / 2)), nil
+}
+
+// clockSkewMonitor compares the clocks of the local and remote API servers.
+// Comparisons of timestamps written in one cluster with the time in the
+// other, such as for -max-object-age, are wrong if the clocks are skewed.
+type clockSkewMonitor struct {
+	local, remote serverOffset
+	threshold     time.Duration
+	// If set, timestamps aren't compared while the skew exceeds the
+	// threshold.
+	disableTimestamps bool
+
+	mu        sync.Mutex
+	skew      time.Duration
+	excessive bool
+}
+
+func newClockSkewMonitor(local, remote serverOffset, threshold time.Duration, disableTimestamps bool) *clockSkewMonitor {
+	return &clockSkewMonitor{
+		local:             local,
+		remote:            remote,
+		threshold:         threshold,
+		disableTimestamps: disableTimestamps,
+	}
+}
+
+// check measures the skew between the clusters, records it and logs if it
+// starts or stops exceeding the threshold.
+func (m *clockSkewMonitor) check() (time.Duration, error) {
+	local, err := m.local()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get local server time: %s", err)
+	}
+	remote, err := m.remote()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get remote server time: %s", err)
+	}
+	skew := remote - local
+	stats.Record(context.Background(), mClockSkew.M(skew.Seconds()))
+	excessive := skew > m.threshold || -skew > m.threshold
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if excessive && !m.excessive {
+		msg := ""
+		if m.disableTimestamps {
+			msg = ", timestamp comparisons are disabled until it recovers"
+		}
+		log.Printf("Warning: Clock skew between the clusters is %s, more than %s%s", skew, m.threshold, msg)
+	} else if !excessive && m.excessive {
+		log.Printf("Clock skew between the clusters is %s, back within %s", skew, m.threshold)
+	}
+	m.skew = skew
+	m.excessive = excessive
+	return skew, nil
+}
+
+// run checks the skew at the given interval until done is closed. Failed
+// checks are logged and keep the previous result.
+func (m *clockSkewMonitor) run(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if _, err := m.check(); err != nil {
+			log.Printf("Clock skew check failed: %s", err)
+		}
+	}
+}
+
+// timestampsTrusted returns false if timestamps from the other cluster
+// mustn't be compared with the local time because of clock skew.
+func (m *clockSkewMonitor) timestampsTrusted() bool {
+	if m == nil {
+		return true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !(m.disableTimestamps && m.excessive)
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestServerTimeOffset(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	offset, err := serverTimeOffset(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := offset - time.Hour; d < -2*time.Second || d > 2*time.Second {
+		t.Errorf("serverTimeOffset() = %s, want about 1h", offset)
+	}
+}
+
+func TestClockSkewMonitor_disablesTimestampComparison(t *testing.T) {
+	remoteOffset := 2 * time.Minute
+	m := newClockSkewMonitor(
+		func() (time.Duration, error) { return 0, nil },
+		func() (time.Duration, error) { return remoteOffset, nil },
+		30*time.Second, true)
+	clockSkew = m
+	defer func() { clockSkew = nil }()
+
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.maxObjectAge = time.Hour
+	old := newTestCR("resource1", "spec1", nil)
+	old.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-2 * time.Hour)))
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	if skew, err := m.check(); err != nil || skew != remoteOffset {
+		t.Fatalf("check() = %s, %v; want %s, nil", skew, err, remoteOffset)
+	}
+	if !strings.Contains(buf.String(), "Warning: Clock skew") {
+		t.Errorf("got no clock skew warning:\n%s", buf.String())
+	}
+	if m.timestampsTrusted() {
+		t.Error("timestamps trusted despite clock skew")
+	}
+	if crs.isTooOld(old) {
+		t.Error("isTooOld() = true while timestamps are not trusted")
+	}
+
+	// Once the clocks agree again, timestamps are compared.
+	remoteOffset = time.Second
+	if _, err := m.check(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.timestampsTrusted() {
+		t.Error("timestamps not trusted after the skew recovered")
+	}
+	if !crs.isTooOld(old) {
+		t.Error("isTooOld() = false after the skew recovered")
+	}
+}
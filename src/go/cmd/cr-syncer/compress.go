@@ -0,0 +1,69 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// CRD annotation that enables compression of the status subtree. If set, the
+// subtree value is written upstream as a base64-encoded gzipped JSON string,
+// which keeps objects with many robots' status below the object size limit.
+const annotationCompressSubtree = "cr-syncer.cloudrobotics.com/compress-subtree"
+
+// compressSubtree encodes a status subtree value for storage upstream.
+func compressSubtree(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decompressSubtree decodes a status subtree value written by
+// compressSubtree.
+func decompressSubtree(s string) (interface{}, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %s", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip: %s", err)
+	}
+	defer zr.Close()
+	b, err = ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip: %s", err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("invalid json: %s", err)
+	}
+	return v, nil
+}
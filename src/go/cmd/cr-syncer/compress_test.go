@@ -0,0 +1,89 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestCompressSubtree_roundTrip(t *testing.T) {
+	v := map[string]interface{}{
+		"phase":   "Running",
+		"retries": float64(3),
+		"log":     []interface{}{"started", "connected"},
+	}
+	compressed, err := compressSubtree(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decompressSubtree(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("round trip returned %v, want %v", got, v)
+	}
+}
+
+func TestDecompressSubtree_invalid(t *testing.T) {
+	if _, err := decompressSubtree("not compressed"); err == nil {
+		t.Error("decompressSubtree succeeded on invalid input")
+	}
+}
+
+func TestSyncDownstream_compressesSubtree(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationStatusSubtree] = "robots.{robotName}"
+	crd.ObjectMeta.Annotations[annotationCompressSubtree] = "true"
+	f := newFixture(t)
+
+	subtree := map[string]interface{}{"phase": "Running"}
+	tcrLocal := newTestCR("resource1", "spec1", map[string]interface{}{
+		"robots": map[string]interface{}{"robot1": subtree},
+	})
+	tcrLocal.SetResourceVersion("123")
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", nil))
+
+	crs, _ := f.newCRSyncer(crd, "robot1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	actions := filterReadActions(f.remote.Actions())
+	if len(actions) != 1 {
+		t.Fatalf("got %d remote writes, want 1", len(actions))
+	}
+	written := actions[0].(k8stest.UpdateAction).GetObject().(*unstructured.Unstructured)
+	compressed, _, err := unstructured.NestedString(written.Object, "status", "robots", "robot1")
+	if err != nil {
+		t.Fatalf("subtree not written as string: %s", err)
+	}
+	got, err := decompressSubtree(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, subtree) {
+		t.Errorf("decompressed subtree %v, want %v", got, subtree)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// CRD annotation with the number of workers per direction, overriding
+// -max-sync-concurrency.
+const annotationConcurrency = "cr-syncer.cloudrobotics.com/concurrency"
+
+// parseConcurrency returns the number of workers per direction for the CRD,
+// or def if the annotation isn't set.
+func parseConcurrency(crd crdtypes.CustomResourceDefinition, def int) (int, error) {
+	value := crd.ObjectMeta.Annotations[annotationConcurrency]
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("must be a positive integer, got %q", value)
+	}
+	return n, nil
+}
+
+// workerPool tracks the workers that process a work queue.
+type workerPool struct {
+	active    int32 // Number of running workers, accessed atomically.
+	drainOnce sync.Once
+	drained   chan struct{} // Closed once the queue was empty.
+}
+
+// activeWorkers returns the number of running workers.
+func (p *workerPool) activeWorkers() int {
+	return int(atomic.LoadInt32(&p.active))
+}
+
+func (p *workerPool) isDrained() bool {
+	select {
+	case <-p.drained:
+		return true
+	default:
+		return false
+	}
+}
+
+// runWorkers processes the queue until it's shut down. It starts with
+// initial workers, if that's more than steady, to catch up with the backlog
+// of the initial list. Once the queue is empty for the first time, the extra
+// workers retire after finishing their current item. The queue never hands
+// out a key while it's being processed, so objects are still reconciled one
+// at a time.
+func (s *crSyncer) runWorkers(ctx context.Context, initial, steady int, q workqueue.RateLimitingInterface, syncf func(context.Context, string) (Result, error), direction string) *workerPool {
+	p := &workerPool{drained: make(chan struct{})}
+	if initial < steady {
+		initial = steady
+	}
+	for i := 0; i < initial; i++ {
+		retire := i >= steady
+		atomic.AddInt32(&p.active, 1)
+		go func() {
+			defer atomic.AddInt32(&p.active, -1)
+			for !(retire && p.isDrained()) && s.processNextWorkItem(ctx, q, syncf, direction) {
+				if q.Len() == 0 {
+					p.drainOnce.Do(func() { close(p.drained) })
+				}
+			}
+		}()
+	}
+	return p
+}
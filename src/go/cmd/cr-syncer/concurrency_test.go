@@ -0,0 +1,177 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestNewCRSyncer_concurrencyAnnotation(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", 1, false},
+		{"4", 4, false},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"many", 0, true},
+	} {
+		crd := testCRD(crdtypes.NamespaceScoped)
+		if tc.value != "" {
+			crd.ObjectMeta.Annotations[annotationConcurrency] = tc.value
+		}
+		f := newFixture(t)
+		f.newClients(crd)
+		crs, err := newCRSyncer(crd, f.local, f.remote, "")
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("concurrency %q: newCRSyncer succeeded, want error", tc.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("concurrency %q: %s", tc.value, err)
+			continue
+		}
+		if crs.workers != tc.want {
+			t.Errorf("concurrency %q: got %d workers, want %d", tc.value, crs.workers, tc.want)
+		}
+	}
+}
+
+// maxConcurrentSyncs processes three keys with the given number of workers
+// and returns the maximum number of keys that were synced at the same time.
+func maxConcurrentSyncs(t *testing.T, workers int) int {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	for i := 0; i < 3; i++ {
+		q.Add(fmt.Sprintf("default/resource%d", i))
+	}
+
+	var (
+		mu            sync.Mutex
+		running, peak int
+		done          sync.WaitGroup
+		enoughRunning = make(chan struct{})
+		closeOnce     sync.Once
+	)
+	done.Add(3)
+	crs.runWorkers(context.Background(), workers, workers, q, func(context.Context, string) (Result, error) {
+		defer done.Done()
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		if running == workers {
+			closeOnce.Do(func() { close(enoughRunning) })
+		}
+		mu.Unlock()
+		// Hold the worker until all workers are busy, so that the
+		// maximum is reached deterministically.
+		select {
+		case <-enoughRunning:
+		case <-time.After(10 * time.Second):
+		}
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return ResultUnchanged, nil
+	}, "upstream")
+	done.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	return peak
+}
+
+func TestRunWorkers_concurrency(t *testing.T) {
+	if got := maxConcurrentSyncs(t, 1); got != 1 {
+		t.Errorf("one worker synced %d objects concurrently, want 1", got)
+	}
+	if got := maxConcurrentSyncs(t, 3); got != 3 {
+		t.Errorf("three workers synced %d objects concurrently, want 3", got)
+	}
+}
+
+func TestRunWorkers_stepsDownAfterInitialBacklog(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	for i := 0; i < 3; i++ {
+		q.Add(fmt.Sprintf("default/resource%d", i))
+	}
+
+	var (
+		mu      sync.Mutex
+		running int
+		synced  = make(chan int, 10) // Number of syncs running at the start of each sync.
+		release = make(chan struct{})
+	)
+	pool := crs.runWorkers(context.Background(), 3, 1, q, func(context.Context, string) (Result, error) {
+		mu.Lock()
+		running++
+		synced <- running
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return ResultUnchanged, nil
+	}, "upstream")
+
+	// The initial backlog is synced with three workers.
+	for i := 0; i < 3; i++ {
+		<-synced
+	}
+	mu.Lock()
+	if running != 3 {
+		t.Errorf("%d syncs running for the initial backlog, want 3", running)
+	}
+	mu.Unlock()
+	close(release)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for pool.activeWorkers() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d workers after the backlog drained, want 1", pool.activeWorkers())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Later items are synced by the remaining worker.
+	q.Add("default/resource3")
+	if got := <-synced; got != 1 {
+		t.Errorf("%d syncs running after the backlog drained, want 1", got)
+	}
+}
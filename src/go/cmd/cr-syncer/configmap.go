@@ -0,0 +1,111 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// CRD annotation with the name of a ConfigMap in the downstream
+	// namespace of each object, into which the object's spec is rendered
+	// as JSON. "{name}" is replaced with the name of the object.
+	annotationProjectToConfigMap = "cr-syncer.cloudrobotics.com/project-to-configmap"
+	objectNamePlaceholder        = "{name}"
+	// Key of the spec in the data of the ConfigMap.
+	configMapSpecKey = "spec.json"
+)
+
+var configMapsResource = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+// configMapName returns the name of the ConfigMap the spec of the object is
+// projected to, or "" if there is none. ConfigMaps are namespaced, so specs
+// of cluster-scoped objects aren't projected.
+func (s *crSyncer) configMapName(o *unstructured.Unstructured) string {
+	if s.configMapTemplate == "" || o.GetNamespace() == "" {
+		return ""
+	}
+	return strings.Replace(s.configMapTemplate, objectNamePlaceholder, o.GetName(), -1)
+}
+
+// projectToConfigMap renders the spec of the upstream object into its
+// ConfigMap in the downstream namespace.
+func (s *crSyncer) projectToConfigMap(src *unstructured.Unstructured, downstreamNs string) error {
+	name := s.configMapName(src)
+	if name == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(src.Object["spec"], "", "  ")
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{configMapSpecKey: string(b)}
+
+	client := s.downstreamConfigMaps.Namespace(downstreamNs)
+	cm, err := client.Get(name, metav1.GetOptions{})
+	exists := err == nil
+	if err != nil {
+		if !isNotFoundError(err) {
+			return err
+		}
+		cm = &unstructured.Unstructured{Object: make(map[string]interface{})}
+		cm.SetAPIVersion("v1")
+		cm.SetKind("ConfigMap")
+		cm.SetNamespace(downstreamNs)
+		cm.SetName(name)
+	} else if reflect.DeepEqual(cm.Object["data"], data) &&
+		cm.GetAnnotations()[annotationMirroredFor] == src.GetName() {
+		return nil
+	}
+	cm.Object["data"] = data
+	setAnnotation(cm, annotationMirroredFor, src.GetName())
+	if exists {
+		_, err = client.Update(cm, metav1.UpdateOptions{})
+	} else {
+		_, err = client.Create(cm, metav1.CreateOptions{})
+	}
+	return err
+}
+
+// deleteConfigMapProjection deletes the ConfigMap the spec of the deleted
+// object was projected to, unless it was last written for another object.
+// Failures are logged.
+func (s *crSyncer) deleteConfigMapProjection(o *unstructured.Unstructured, downstreamNs string) {
+	name := s.configMapName(o)
+	if name == "" {
+		return
+	}
+	client := s.downstreamConfigMaps.Namespace(downstreamNs)
+	cm, err := client.Get(name, metav1.GetOptions{})
+	if err != nil {
+		if !isNotFoundError(err) {
+			log.Printf("Failed to get ConfigMap %s/%s of %s: %s", downstreamNs, name, o.GetName(), err)
+		}
+		return
+	}
+	if cm.GetAnnotations()[annotationMirroredFor] != o.GetName() {
+		return
+	}
+	if err := client.Delete(name, nil); err != nil && !isNotFoundError(err) {
+		log.Printf("Failed to delete ConfigMap %s/%s of %s: %s", downstreamNs, name, o.GetName(), err)
+	}
+}
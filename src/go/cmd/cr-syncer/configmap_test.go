@@ -0,0 +1,107 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSyncUpstream_projectsSpecToConfigMap(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationProjectToConfigMap] = "{name}-config"
+	f := newFixture(t)
+
+	tcrRemote := newTestCR("resource1", map[string]interface{}{"mode": "a"}, nil)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	configMaps := f.local.Resource(configMapsResource).Namespace("default")
+	expectSpec := func(want map[string]interface{}) {
+		t.Helper()
+		cm, err := configMaps.Get("resource1-config", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("ConfigMap not found: %s", err)
+		}
+		data, _, _ := unstructured.NestedString(cm.Object, "data", configMapSpecKey)
+		var got map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &got); err != nil {
+			t.Fatalf("invalid spec %q: %s", data, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got spec %v in ConfigMap, want %v", got, want)
+		}
+	}
+	expectSpec(map[string]interface{}{"mode": "a"})
+
+	// Spec changes are projected too.
+	tcrRemote.Object["spec"] = map[string]interface{}{"mode": "b"}
+	if _, err := f.remote.Resource(gvr).Namespace("default").Update(tcrRemote, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		o, _, _ := crs.upstreamInf.GetIndexer().GetByKey("default/resource1")
+		if mode, _, _ := unstructured.NestedString(o.(*unstructured.Unstructured).Object, "spec", "mode"); mode == "b" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("informer didn't see the spec change")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	expectSpec(map[string]interface{}{"mode": "b"})
+}
+
+func TestSyncUpstream_deletesConfigMapProjection(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationProjectToConfigMap] = "{name}-config"
+	f := newFixture(t)
+
+	cm := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	cm.SetAPIVersion("v1")
+	cm.SetKind("ConfigMap")
+	cm.SetNamespace("default")
+	cm.SetName("resource1-config")
+	cm.SetAnnotations(map[string]string{annotationMirroredFor: "resource1"})
+	f.addLocalObjects(newTestCR("resource1", map[string]interface{}{"mode": "a"}, nil), cm)
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := f.local.Resource(configMapsResource).Namespace("default").Get("resource1-config", metav1.GetOptions{})
+	if !isNotFoundError(err) {
+		t.Errorf("ConfigMap not deleted with the object, err: %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Suspected conflicts are logged at most once per object in this interval,
+// as two syncers fighting over an object conflict on every sync.
+const conflictLogInterval = time.Minute
+
+var mSuspectedConflicts = stats.Int64(
+	"cr-syncer.cloudrobotics.com/suspected_conflicts",
+	"Upstream statuses last written by another writer",
+	stats.UnitDimensionless,
+)
+
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "cr-syncer.cloudrobotics.com/suspected_conflicts_total",
+			Description: "Total number of upstream statuses last written by another writer",
+			Measure:     mSuspectedConflicts,
+			TagKeys:     []tag.Key{tagResource},
+			Aggregation: view.Count(),
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// conflictTracker remembers the remote resource versions this syncer wrote
+// into upstream objects, and when conflicts were last logged for them.
+type conflictTracker struct {
+	mu sync.Mutex
+	// Value of the remote-resource-version annotation last written, by
+	// downstream key.
+	written map[string]string
+	// Time of the last log message, by downstream key.
+	logged map[string]time.Time
+	// End of the backoff after a confirmed conflict, by downstream key.
+	pausedUntil map[string]time.Time
+}
+
+func newConflictTracker() *conflictTracker {
+	return &conflictTracker{
+		written:     make(map[string]string),
+		logged:      make(map[string]time.Time),
+		pausedUntil: make(map[string]time.Time),
+	}
+}
+
+// recordWrite remembers the remote resource version written for the key.
+func (c *conflictTracker) recordWrite(key, resourceVersion string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written[key] = resourceVersion
+}
+
+// forget drops what was recorded for the key.
+func (c *conflictTracker) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.written, key)
+	delete(c.logged, key)
+	delete(c.pausedUntil, key)
+}
+
+// wrote returns whether this syncer wrote the status of the key since it
+// started.
+func (c *conflictTracker) wrote(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.written[key]
+	return ok
+}
+
+// suspect returns whether the upstream object was last written by someone
+// else, and whether this should be logged. Nothing is suspected before this
+// syncer wrote the key: after a restart, the annotation may well be from its
+// own write before the restart.
+func (c *conflictTracker) suspect(key, resourceVersion string, now time.Time) (conflict, logIt bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	written, ok := c.written[key]
+	if !ok || resourceVersion == "" || resourceVersion == written {
+		return false, false
+	}
+	if now.Sub(c.logged[key]) < conflictLogInterval {
+		return true, false
+	}
+	c.logged[key] = now
+	return true, true
+}
+
+// pause returns how long writes to the object should be held back. A
+// confirmed conflict starts a backoff of the given window, after which the
+// next write goes through even if the conflict persists.
+func (c *conflictTracker) pause(key string, confirmed bool, now time.Time, window time.Duration) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if until, ok := c.pausedUntil[key]; ok {
+		if now.Before(until) {
+			return until.Sub(now)
+		}
+		delete(c.pausedUntil, key)
+		return 0
+	}
+	if !confirmed {
+		return 0
+	}
+	c.pausedUntil[key] = now.Add(window)
+	return window
+}
+
+// conflictWait returns how long to wait before writing the status of the
+// downstream object src to the upstream object dst, if -conflict-backoff is
+// set. A conflict is confirmed if dst claims to hold the status of the
+// current version of src, but the status differs: another writer overwrote
+// it without updating the annotation. Until this syncer wrote the status
+// itself, a difference may also come from its previous run, eg with another
+// configuration, so the first reconcile of each object after a restart never
+// confirms a conflict.
+func (s *crSyncer) conflictWait(key string, src, dst *unstructured.Unstructured) time.Duration {
+	if s.conflictBackoff <= 0 {
+		return 0
+	}
+	confirmed := false
+	if dst.GetAnnotations()[annotationResourceVersion] == src.GetResourceVersion() && s.conflicts.wrote(key) {
+		want := dst.DeepCopy()
+		if err := s.copyStatus(src, want); err == nil {
+			confirmed = !reflect.DeepEqual(s.syncedStatusValue(want), s.syncedStatusValue(dst))
+		}
+	}
+	wait := s.conflicts.pause(key, confirmed, time.Now(), s.conflictBackoff)
+	if confirmed && wait > 0 {
+		log.Printf("Conflict on %s %s: status was changed by another writer, backing off for %s",
+			dst.GetKind(), dst.GetName(), wait)
+	}
+	return wait
+}
+
+// checkResourceVersionAnnotation checks that the remote resource version in
+// the upstream object dst is the one this syncer wrote. If not, another
+// writer, eg a second syncer for the same robot, wrote the status in the
+// meantime.
+func (s *crSyncer) checkResourceVersionAnnotation(key string, dst *unstructured.Unstructured) {
+	rv := dst.GetAnnotations()[annotationResourceVersion]
+	conflict, logIt := s.conflicts.suspect(key, rv, time.Now())
+	if !conflict {
+		return
+	}
+	s.eventLog.emit(context.Background(), severityWarn, "suspected conflict", map[string]string{
+		"crd":              s.crd.GetName(),
+		"key":              key,
+		"resource-version": rv,
+	})
+	if logIt {
+		log.Printf("Suspected conflict on %s %s: status was written for remote resource version %s by another writer",
+			dst.GetKind(), dst.GetName(), rv)
+	}
+	ctx, err := tag.New(context.Background(), tag.Insert(tagResource, s.crd.GetName()))
+	if err != nil {
+		panic(err)
+	}
+	stats.Record(ctx, mSuspectedConflicts.M(1))
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	k8stest "k8s.io/client-go/testing"
+)
+
+// suspectedConflicts returns the number of suspected conflicts recorded for
+// the CRD.
+func suspectedConflicts(t *testing.T, crd crdtypes.CustomResourceDefinition) int64 {
+	rows, err := view.RetrieveData("cr-syncer.cloudrobotics.com/suspected_conflicts_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rows {
+		for _, tg := range r.Tags {
+			if tg.Key == tagResource && tg.Value == crd.GetName() {
+				return r.Data.(*view.CountData).Value
+			}
+		}
+	}
+	return 0
+}
+
+func TestConflictTracker(t *testing.T) {
+	c := newConflictTracker()
+	now := time.Now()
+
+	if conflict, _ := c.suspect("default/a", "1", now); conflict {
+		t.Error("conflict reported before anything was written")
+	}
+	c.recordWrite("default/a", "1")
+	if conflict, _ := c.suspect("default/a", "1", now); conflict {
+		t.Error("conflict reported for own write")
+	}
+	if conflict, logIt := c.suspect("default/a", "2", now); !conflict || !logIt {
+		t.Errorf("suspect() = %v, %v; want true, true", conflict, logIt)
+	}
+	if conflict, logIt := c.suspect("default/a", "2", now.Add(time.Second)); !conflict || logIt {
+		t.Errorf("suspect() within interval = %v, %v; want true, false", conflict, logIt)
+	}
+	if conflict, logIt := c.suspect("default/a", "2", now.Add(conflictLogInterval)); !conflict || !logIt {
+		t.Errorf("suspect() after interval = %v, %v; want true, true", conflict, logIt)
+	}
+	c.forget("default/a")
+	if conflict, _ := c.suspect("default/a", "2", now); conflict {
+		t.Error("conflict reported after forget")
+	}
+}
+
+func TestCheckResourceVersionAnnotation_dedupsLogs(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Name = "conflicts.crds.example.com"
+	f := newFixture(t)
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	before := suspectedConflicts(t, crd)
+	crs.conflicts.recordWrite("default/resource1", "1")
+	dst := newTestCR("resource1", "spec1", "status1")
+	dst.SetAnnotations(map[string]string{annotationResourceVersion: "2"})
+	for i := 0; i < 3; i++ {
+		crs.checkResourceVersionAnnotation("default/resource1", dst)
+	}
+
+	if n := strings.Count(buf.String(), "Suspected conflict"); n != 1 {
+		t.Errorf("got %d log messages, want 1:\n%s", n, buf.String())
+	}
+	if got := suspectedConflicts(t, crd) - before; got != 3 {
+		t.Errorf("got %d suspected conflicts, want 3", got)
+	}
+}
+
+func TestConflictTrackerPause(t *testing.T) {
+	c := newConflictTracker()
+	now := time.Now()
+
+	if wait := c.pause("default/a", false, now, time.Minute); wait != 0 {
+		t.Errorf("pause() without conflict = %s, want 0", wait)
+	}
+	if wait := c.pause("default/a", true, now, time.Minute); wait != time.Minute {
+		t.Errorf("pause() on conflict = %s, want 1m", wait)
+	}
+	if wait := c.pause("default/a", true, now.Add(20*time.Second), time.Minute); wait != 40*time.Second {
+		t.Errorf("pause() within window = %s, want 40s", wait)
+	}
+	// Once the window has passed, the next write goes through.
+	if wait := c.pause("default/a", true, now.Add(time.Minute), time.Minute); wait != 0 {
+		t.Errorf("pause() after window = %s, want 0", wait)
+	}
+}
+
+func TestSyncDownstream_conflictBackoff(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	tcrLocal := newTestCR("resource1", "spec1", "status2")
+	tcrLocal.SetResourceVersion("123")
+	// Another writer changed the status without changing the annotation.
+	tcrRemote := newTestCR("resource1", "spec1", "other")
+	tcrRemote.SetAnnotations(map[string]string{
+		annotationResourceVersion: "123",
+	})
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.conflictBackoff = time.Minute
+	// The syncer wrote the status before, so the conflict is not caused by
+	// a restart.
+	crs.conflicts.recordWrite("default/resource1", "123")
+
+	crs.startInformers()
+	for i := 0; i < 2; i++ {
+		if err := crs.syncDownstream("default/resource1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Writes are paused during the window.
+	f.verifyWriteActions()
+
+	// Once the window has passed, the status is overwritten.
+	crs.conflicts.mu.Lock()
+	crs.conflicts.pausedUntil["default/resource1"] = time.Now().Add(-time.Second)
+	crs.conflicts.mu.Unlock()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	tcrRemoteNew := newTestCR("resource1", "spec1", "status2")
+	tcrRemoteNew.SetAnnotations(map[string]string{
+		annotationResourceVersion: "123",
+	})
+	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+	f.verifyWriteActions()
+}
+
+func TestSyncDownstream_noConflictAfterRestart(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Name = "restarts.crds.example.com"
+	f := newFixture(t)
+
+	tcrLocal := newTestCR("resource1", "spec1", "status2")
+	tcrLocal.SetResourceVersion("123")
+	// The previous run of the syncer wrote the annotation and a status
+	// that differs from what this run would write.
+	tcrRemote := newTestCR("resource1", "spec1", "status1")
+	tcrRemote.SetAnnotations(map[string]string{
+		annotationResourceVersion: "123",
+	})
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.conflictBackoff = time.Minute
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	before := suspectedConflicts(t, crd)
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(buf.String(), "onflict") {
+		t.Errorf("got conflict log messages after restart:\n%s", buf.String())
+	}
+	if got := suspectedConflicts(t, crd) - before; got != 0 {
+		t.Errorf("got %d suspected conflicts, want 0", got)
+	}
+	tcrRemoteNew := newTestCR("resource1", "spec1", "status2")
+	tcrRemoteNew.SetAnnotations(map[string]string{
+		annotationResourceVersion: "123",
+	})
+	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+	f.verifyWriteActions()
+}
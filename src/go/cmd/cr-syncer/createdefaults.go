@@ -0,0 +1,115 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// CRD annotation with a JSON object that is deep-merged into the spec of
+// objects when they are created downstream.
+const annotationCreateDefaults = "cr-syncer.cloudrobotics.com/create-defaults"
+
+// parseCreateDefaults returns the value of the create-defaults annotation,
+// or nil if it is unset or invalid.
+func parseCreateDefaults(crd crdtypes.CustomResourceDefinition) map[string]interface{} {
+	value := crd.ObjectMeta.Annotations[annotationCreateDefaults]
+	if value == "" {
+		return nil
+	}
+	var defaults map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &defaults); err != nil {
+		log.Printf("Value for %s must be a JSON object on %s, got %q",
+			annotationCreateDefaults, crd.ObjectMeta.Name, value)
+		return nil
+	}
+	return defaults
+}
+
+// applyCreateDefaults merges the create defaults into the spec of created
+// objects. Existing objects keep the current values of the defaulted fields,
+// as defaults are only applied on create.
+func (s *crSyncer) applyCreateDefaults(_, old, dst *unstructured.Unstructured) error {
+	if s.createDefaults == nil {
+		return nil
+	}
+	if old == nil {
+		dst.Object["spec"] = mergeDefaults(runtime.DeepCopyJSONValue(dst.Object["spec"]), s.createDefaults)
+		return nil
+	}
+	if spec := keepDefaults(runtime.DeepCopyJSONValue(dst.Object["spec"]), old.Object["spec"], s.createDefaults); spec != nil {
+		dst.Object["spec"] = spec
+	}
+	return nil
+}
+
+// mergeDefaults returns the spec with the fields from defaults that it
+// doesn't set. Nested objects are merged recursively, other values in the
+// spec take precedence.
+func mergeDefaults(spec interface{}, defaults map[string]interface{}) interface{} {
+	if spec == nil {
+		return runtime.DeepCopyJSONValue(defaults)
+	}
+	m, ok := spec.(map[string]interface{})
+	if !ok {
+		return spec
+	}
+	for k, v := range defaults {
+		if _, ok := m[k]; !ok {
+			m[k] = runtime.DeepCopyJSONValue(v)
+		} else if d, ok := v.(map[string]interface{}); ok {
+			m[k] = mergeDefaults(m[k], d)
+		}
+	}
+	return m
+}
+
+// keepDefaults returns the spec with the defaulted fields that it doesn't
+// set taken from the current downstream spec. This keeps the defaults that
+// were applied on create, or the values downstream controllers changed them
+// to, when the spec is updated.
+func keepDefaults(spec, current interface{}, defaults map[string]interface{}) interface{} {
+	c, ok := current.(map[string]interface{})
+	if !ok {
+		return spec
+	}
+	if spec == nil {
+		spec = map[string]interface{}{}
+	}
+	m, ok := spec.(map[string]interface{})
+	if !ok {
+		return spec
+	}
+	for k, v := range defaults {
+		cv, ok := c[k]
+		if !ok {
+			continue
+		}
+		if _, ok := m[k]; !ok {
+			m[k] = cv
+		} else if d, ok := v.(map[string]interface{}); ok {
+			m[k] = keepDefaults(m[k], cv, d)
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
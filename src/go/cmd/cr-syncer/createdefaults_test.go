@@ -0,0 +1,98 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testCreateDefaults = `{"storageClass": "fast", "resources": {"cpu": "1", "memory": "1Gi"}}`
+
+func TestSyncUpstream_appliesCreateDefaults(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationCreateDefaults] = testCreateDefaults
+	f := newFixture(t)
+
+	f.addRemoteObjects(newTestCR("resource1", map[string]interface{}{
+		"resources": map[string]interface{}{"cpu": "2"},
+	}, nil))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := f.local.Resource(gvr).Namespace("default").Get("resource1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"storageClass": "fast",
+		"resources":    map[string]interface{}{"cpu": "2", "memory": "1Gi"},
+	}
+	if !reflect.DeepEqual(o.Object["spec"], want) {
+		t.Errorf("got downstream spec %v, want %v", o.Object["spec"], want)
+	}
+
+	// The cached upstream object is unchanged.
+	cached, _, _ := crs.upstreamInf.GetIndexer().GetByKey("default/resource1")
+	if _, found, _ := unstructured.NestedString(cached.(*unstructured.Unstructured).Object, "spec", "storageClass"); found {
+		t.Errorf("defaults were applied to the cached upstream object")
+	}
+}
+
+func TestSyncUpstream_doesNotReapplyCreateDefaults(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationCreateDefaults] = testCreateDefaults
+	f := newFixture(t)
+
+	// A downstream controller changed the storage class and dropped the
+	// memory default after the object was created.
+	f.addLocalObjects(newTestCR("resource1", map[string]interface{}{
+		"storageClass": "slow",
+		"resources":    map[string]interface{}{"cpu": "2"},
+	}, nil))
+	f.addRemoteObjects(newTestCR("resource1", map[string]interface{}{
+		"resources": map[string]interface{}{"cpu": "3"},
+	}, nil))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := f.local.Resource(gvr).Namespace("default").Get("resource1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"storageClass": "slow",
+		"resources":    map[string]interface{}{"cpu": "3"},
+	}
+	if !reflect.DeepEqual(o.Object["spec"], want) {
+		t.Errorf("got downstream spec %v, want %v", o.Object["spec"], want)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// resyncResult is returned by the /debug/resync endpoint.
+type resyncResult struct {
+	CRD        string `json:"crd"`
+	Key        string `json:"key"`
+	Upstream   string `json:"upstream"`   // Result of syncing the spec downstream.
+	Downstream string `json:"downstream"` // Result of syncing the status upstream.
+}
+
+// resyncHandler synchronizes a single object on request. It expects a POST
+// request with the form values "crd" (name of the CRD) and "key" (key of the
+// upstream object, [<namespace>/]<name>).
+type resyncHandler struct {
+	// lookup returns the running syncer for a CRD, or nil.
+	lookup func(crd string) *crSyncer
+}
+
+func (h *resyncHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	crd, key := r.FormValue("crd"), r.FormValue("key")
+	s := h.lookup(crd)
+	if s == nil {
+		http.Error(w, fmt.Sprintf("CRD %q is not synced", crd), http.StatusNotFound)
+		return
+	}
+	if err := validateKey(s.crd, key); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	upstreamErr, downstreamErr := s.resync(key)
+	result := resyncResult{
+		CRD:        crd,
+		Key:        key,
+		Upstream:   errString(upstreamErr),
+		Downstream: errString(downstreamErr),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// validateKey checks that the key has a namespace iff the CRD is namespaced.
+func validateKey(crd crdtypes.CustomResourceDefinition, key string) error {
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("key %q has no name", key)
+	}
+	if namespaced := crd.Spec.Scope == crdtypes.NamespaceScoped; namespaced != (ns != "") {
+		return fmt.Errorf("key %q doesn't match scope %s of %s", key, crd.Spec.Scope, crd.GetName())
+	}
+	return nil
+}
+
+func errString(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
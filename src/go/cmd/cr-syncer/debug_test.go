@@ -0,0 +1,82 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func postResync(h http.Handler, crd, key string) *httptest.ResponseRecorder {
+	form := url.Values{"crd": {crd}, "key": {key}}
+	req := httptest.NewRequest("POST", "/debug/resync", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestResyncHandler(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	tcrRemote := newTestCR("resource1", "spec1", "status1")
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+
+	h := &resyncHandler{lookup: func(name string) *crSyncer {
+		if name == crd.GetName() {
+			return crs
+		}
+		return nil
+	}}
+
+	if rec := postResync(h, "unknown.crds.example.com", "default/resource1"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown CRD got status %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := postResync(h, crd.GetName(), "resource1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("key without namespace got status %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec := postResync(h, crd.GetName(), "default/resource1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var result resyncResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Upstream != "ok" {
+		t.Errorf("upstream result %q; want ok", result.Upstream)
+	}
+
+	// The status sync may or may not see the new downstream object yet, so
+	// only the creation is checked.
+	want := k8stest.NewCreateAction(gvr, "default", newTestCR("resource1", "spec1", "status1"))
+	if writes := filterReadActions(f.local.Actions()); len(writes) != 1 || !reflect.DeepEqual(writes[0], want) {
+		t.Errorf("got local writes %v; want %s", writes, sprintAction(want))
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// Object annotation with a reference <crd>/<name> to another object in
+	// the same namespace, eg a child of the object. The deletion of the
+	// object is propagated downstream only once the referenced object is
+	// gone downstream.
+	annotationDeleteAfter = "cr-syncer.cloudrobotics.com/delete-after"
+
+	// Interval in which deferred deletions are retried.
+	deleteAfterRetryInterval = 5 * time.Second
+)
+
+// deletionBlocked returns true if the object references another object with
+// the delete-after annotation that still exists in the downstream namespace.
+// Invalid references are logged and don't block the deletion.
+func (s *crSyncer) deletionBlocked(o *unstructured.Unstructured, downstreamNs string) (bool, error) {
+	ref := o.GetAnnotations()[annotationDeleteAfter]
+	if ref == "" {
+		return false, nil
+	}
+	i := strings.LastIndex(ref, "/")
+	if i <= 0 || i == len(ref)-1 {
+		log.Printf("Ignoring invalid %s annotation %q on %s", annotationDeleteAfter, ref, o.GetName())
+		return false, nil
+	}
+	crdName, name := ref[:i], ref[i+1:]
+	gvr, namespaced, err := s.downstreamResource(crdName)
+	if err != nil {
+		if isNotFoundError(err) {
+			// Without the CRD, there can't be objects of it.
+			return false, nil
+		}
+		return false, err
+	}
+	client := s.downstreamClient.Resource(gvr)
+	if namespaced {
+		_, err = client.Namespace(downstreamNs).Get(name, metav1.GetOptions{})
+	} else {
+		_, err = client.Get(name, metav1.GetOptions{})
+	}
+	if isNotFoundError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// downstreamResource returns the resource of the CRD with the given name in
+// the downstream cluster, and whether it's namespaced.
+func (s *crSyncer) downstreamResource(crdName string) (schema.GroupVersionResource, bool, error) {
+	crd, err := s.downstreamCRDs.Get(crdName, metav1.GetOptions{})
+	if err != nil {
+		return schema.GroupVersionResource{}, false, err
+	}
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	scope, _, _ := unstructured.NestedString(crd.Object, "spec", "scope")
+	version, _, _ := unstructured.NestedString(crd.Object, "spec", "version")
+	if version == "" {
+		versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+		if len(versions) > 0 {
+			version, _, _ = unstructured.NestedString(versions[0].(map[string]interface{}), "name")
+		}
+	}
+	if group == "" || plural == "" || version == "" {
+		return schema.GroupVersionResource{}, false, fmt.Errorf("CRD %s has no group, version or plural name", crdName)
+	}
+	return schema.GroupVersionResource{Group: group, Version: version, Resource: plural}, scope != "Cluster", nil
+}
+
+// deferDeletion returns true if the deletion of the downstream counterpart
+// of the object with the given upstream key is blocked by its delete-after
+// annotation. In that case, the key is requeued to retry later.
+func (s *crSyncer) deferDeletion(key string, o *unstructured.Unstructured, downstreamNs string) (bool, error) {
+	blocked, err := s.deletionBlocked(o, downstreamNs)
+	if err != nil {
+		return false, fmt.Errorf("failed to check %s of %s: %s", annotationDeleteAfter, key, err)
+	}
+	if !blocked {
+		return false, nil
+	}
+	log.Printf("Deferring deletion of %s until %s is deleted", key, o.GetAnnotations()[annotationDeleteAfter])
+	s.upstreamQueue.AddAfter(key, deleteAfterRetryInterval)
+	return true, nil
+}
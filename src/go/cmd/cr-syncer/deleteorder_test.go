@@ -0,0 +1,54 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSyncUpstream_deleteAfterDependency(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	// Both objects were deleted upstream, the parent must only be deleted
+	// downstream after the child.
+	parent := newTestCR("parent1", "spec1", "status1")
+	parent.SetAnnotations(map[string]string{annotationDeleteAfter: "goals.crds.example.com/child1"})
+	f.addLocalObjects(crdObject(t, crd), parent, newTestCR("child1", "spec2", "status2"))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/parent1"); err != nil {
+		t.Fatal(err)
+	}
+	f.verifyWriteActions()
+
+	if err := crs.syncUpstream("default/child1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := crs.syncUpstream("default/parent1"); err != nil {
+		t.Fatal(err)
+	}
+	f.expectLocalActions(
+		k8stest.NewDeleteAction(gvr, "default", "child1"),
+		k8stest.NewDeleteAction(gvr, "default", "parent1"),
+	)
+	f.verifyWriteActions()
+}
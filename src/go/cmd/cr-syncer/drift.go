@@ -0,0 +1,149 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+// driftChange is a write that the next sync of an object would make.
+type driftChange struct {
+	CRD string `json:"crd"`
+	Key string `json:"key"` // Key of the upstream object.
+	// "upstream" for changes of the downstream object by the spec sync,
+	// "downstream" for changes of the upstream object by the status sync,
+	// like the queues the change events come from.
+	Direction string `json:"direction"`
+	Action    string `json:"action"` // "create", "update" or "delete".
+}
+
+// drift returns the writes that syncing all objects would make, without
+// making them. It mirrors the decisions of reconcileUpstream and
+// reconcileDownstream for the common cases, but doesn't account for
+// deferred writes, eg because of status batching.
+func (s *crSyncer) drift() ([]driftChange, error) {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+
+	var changes []driftChange
+	add := func(key, direction, action string) {
+		changes = append(changes, driftChange{CRD: s.crd.GetName(), Key: key, Direction: direction, Action: action})
+	}
+	for _, key := range s.upstreamInf.GetIndexer().ListKeys() {
+		if s.isExcluded(key) {
+			continue
+		}
+		src, srcExists, err := s.getObject(s.upstreamInf, s.upstream, key)
+		if err != nil {
+			return nil, err
+		}
+		if !srcExists || s.isGated(src) {
+			continue
+		}
+		dst, dstExists, err := s.getObject(s.downstreamInf, s.downstream, s.downstreamKey(key))
+		if err != nil {
+			return nil, err
+		}
+		if dstExists && s.isForeign(dst) {
+			continue
+		}
+		switch {
+		case src.GetDeletionTimestamp() != nil:
+			if dstExists && dst.GetDeletionTimestamp() == nil {
+				add(key, "upstream", "delete")
+			}
+			continue
+		case !dstExists:
+			if !s.isTooOld(src) {
+				add(key, "upstream", "create")
+			}
+			continue
+		}
+		want := dst.DeepCopy()
+		if err := s.applySpec(src, dst, want, true); err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(want.Object, dst.Object) {
+			add(key, "upstream", "update")
+		}
+		if !reflect.DeepEqual(s.syncedStatusValue(dst), s.syncedStatusValue(src)) {
+			add(key, "downstream", "update")
+		}
+	}
+	// Downstream objects without upstream counterpart are deleted by
+	// reconcileDownstream.
+	for _, key := range s.downstreamInf.GetIndexer().ListKeys() {
+		if s.isExcludedDownstream(key) {
+			continue
+		}
+		upstreamKey := s.upstreamKey(key)
+		dst, exists, err := s.getObject(s.downstreamInf, s.downstream, key)
+		if err != nil {
+			return nil, err
+		}
+		if !exists || dst.GetDeletionTimestamp() != nil || s.isForeign(dst) {
+			continue
+		}
+		if _, srcExists, err := s.getObject(s.upstreamInf, s.upstream, upstreamKey); err != nil {
+			return nil, err
+		} else if !srcExists {
+			add(upstreamKey, "downstream", "delete")
+		}
+	}
+	return changes, nil
+}
+
+// driftReport is returned by the /debug/drift endpoint.
+type driftReport struct {
+	Changes []driftChange `json:"changes"`
+}
+
+// driftHandler reports the pending changes of all synced CRDs. Nothing is
+// written, so it can be used to audit the drift between the clusters.
+type driftHandler struct {
+	// list returns the running syncers.
+	list func() []*crSyncer
+}
+
+func (h *driftHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	report := driftReport{Changes: []driftChange{}}
+	for _, s := range h.list() {
+		changes, err := s.drift()
+		if err != nil {
+			http.Error(w, "computing drift of "+s.crd.GetName()+" failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		report.Changes = append(report.Changes, changes...)
+	}
+	sort.Slice(report.Changes, func(i, j int) bool {
+		a, b := report.Changes[i], report.Changes[j]
+		if a.CRD != b.CRD {
+			return a.CRD < b.CRD
+		}
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.Direction > b.Direction // Spec before status.
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDriftHandler(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(
+		newTestCR("resource1", "spec1", "status1"),
+		newTestCR("resource2", "spec2", "status2"),
+	)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+
+	// Sync both objects and make sure that the cache has the downstream
+	// copies.
+	for _, name := range []string{"resource1", "resource2"} {
+		if err := crs.syncUpstream("default/" + name); err != nil {
+			t.Fatal(err)
+		}
+		o, err := f.local.Resource(gvr).Namespace("default").Get(name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		crs.downstreamInf.GetIndexer().Update(o)
+	}
+	// Change the spec of resource2 upstream.
+	drifted := newTestCR("resource2", "spec3", "status2")
+	crs.upstreamInf.GetIndexer().Update(drifted)
+	writes := len(filterReadActions(f.local.Actions())) + len(filterReadActions(f.remote.Actions()))
+
+	h := &driftHandler{list: func() []*crSyncer { return []*crSyncer{crs} }}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/drift", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var report driftReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	want := []driftChange{{CRD: crd.GetName(), Key: "default/resource2", Direction: "upstream", Action: "update"}}
+	if !reflect.DeepEqual(report.Changes, want) {
+		t.Errorf("got changes %+v; want %+v", report.Changes, want)
+	}
+	if got := len(filterReadActions(f.local.Actions())) + len(filterReadActions(f.remote.Actions())); got != writes {
+		t.Errorf("computing the drift made %d writes; want none", got-writes)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// CRD annotation that enables mirroring the Events of downstream objects to
+// their upstream counterparts.
+const annotationMirrorEvents = "cr-syncer.cloudrobotics.com/mirror-events"
+
+var eventsResource = schema.GroupVersionResource{Version: "v1", Resource: "events"}
+
+// eventMirror remembers the resource versions of the downstream Events that
+// were mirrored upstream, so that unchanged Events aren't written again.
+type eventMirror struct {
+	mu sync.Mutex
+	// Maps object keys to the names and resource versions of their
+	// mirrored Events.
+	mirrored map[string]map[string]string
+}
+
+func newEventMirror() *eventMirror {
+	return &eventMirror{mirrored: make(map[string]map[string]string)}
+}
+
+// forget drops what was mirrored for the object with the given key.
+func (m *eventMirror) forget(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.mirrored, key)
+}
+
+// involves returns true if the Event references the object.
+func involves(event, o *unstructured.Unstructured) bool {
+	ref, _, _ := unstructured.NestedStringMap(event.Object, "involvedObject")
+	if ref["kind"] != o.GetKind() || ref["name"] != o.GetName() {
+		return false
+	}
+	return ref["uid"] == "" || o.GetUID() == "" || ref["uid"] == string(o.GetUID())
+}
+
+// watchEvents watches the downstream Events of objects of the CRD and
+// enqueues the objects they reference, so that Events are mirrored even if
+// the status of their object doesn't change. It runs until stop is closed.
+func (s *crSyncer) watchEvents(stop <-chan struct{}) {
+	client := s.downstreamEvents.Namespace(s.namespace)
+	selector := fields.OneTermEqualSelector("involvedObject.kind", s.crd.Spec.Names.Kind).String()
+	inf := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.FieldSelector = selector
+				list, err := client.List(options)
+				if err != nil {
+					return nil, err
+				}
+				return list, nil
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.FieldSelector = selector
+				return client.Watch(options)
+			},
+		},
+		&unstructured.Unstructured{},
+		0,
+		nil,
+	)
+	inf.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: s.enqueueInvolvedObject,
+		UpdateFunc: func(_, obj interface{}) {
+			s.enqueueInvolvedObject(obj)
+		},
+	})
+	go inf.Run(stop)
+}
+
+// enqueueInvolvedObject adds the downstream object that the Event references
+// to the downstream queue, whose sync mirrors the Event.
+func (s *crSyncer) enqueueInvolvedObject(obj interface{}) {
+	if !s.mirrorEvents {
+		return
+	}
+	ref, _, _ := unstructured.NestedStringMap(obj.(*unstructured.Unstructured).Object, "involvedObject")
+	if ref["kind"] != s.crd.Spec.Names.Kind || ref["name"] == "" {
+		return
+	}
+	key := ref["name"]
+	if ref["namespace"] != "" {
+		key = ref["namespace"] + "/" + key
+	}
+	if s.isExcludedDownstream(key) {
+		return
+	}
+	s.downstreamQueue.Add(key)
+}
+
+// copyEvents copies the Events that reference the downstream object src to
+// the namespace of the upstream object dst, with the involved object
+// rewritten to dst. Failures are logged, as Events are best-effort.
+func (s *crSyncer) copyEvents(key string, src, dst *unstructured.Unstructured) {
+	if !s.mirrorEvents {
+		return
+	}
+	list, err := s.downstreamEvents.Namespace(src.GetNamespace()).List(metav1.ListOptions{
+		FieldSelector: "involvedObject.name=" + src.GetName(),
+	})
+	if err != nil {
+		log.Printf("Failed to list events of %s: %s", key, err)
+		return
+	}
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	previous := s.events.mirrored[key]
+	current := make(map[string]string)
+	for i := range list.Items {
+		event := &list.Items[i]
+		if !involves(event, src) {
+			continue
+		}
+		if rv, ok := previous[event.GetName()]; ok && rv == event.GetResourceVersion() {
+			current[event.GetName()] = event.GetResourceVersion()
+			continue
+		}
+		if err := s.mirrorEvent(event, dst); err != nil {
+			log.Printf("Failed to mirror event %s of %s: %s", event.GetName(), key, err)
+			continue
+		}
+		current[event.GetName()] = event.GetResourceVersion()
+	}
+	s.events.mirrored[key] = current
+}
+
+// mirrorEvent creates or updates the upstream copy of a downstream Event.
+// Copies are prefixed with the cluster name, so that Events from different
+// robots don't collide.
+func (s *crSyncer) mirrorEvent(event, dst *unstructured.Unstructured) error {
+	mirror := &unstructured.Unstructured{Object: make(map[string]interface{})}
+	for k, v := range event.Object {
+		if k != "metadata" {
+			mirror.Object[k] = v
+		}
+	}
+	mirror.SetNamespace(dst.GetNamespace())
+	mirror.SetName(s.clusterName + "." + event.GetName())
+	ref := map[string]interface{}{
+		"apiVersion": dst.GetAPIVersion(),
+		"kind":       dst.GetKind(),
+		"namespace":  dst.GetNamespace(),
+		"name":       dst.GetName(),
+	}
+	if uid := dst.GetUID(); uid != "" {
+		ref["uid"] = string(uid)
+	}
+	mirror.Object["involvedObject"] = ref
+
+	client := s.upstreamEvents.Namespace(dst.GetNamespace())
+	_, err := client.Create(mirror, metav1.CreateOptions{})
+	if !errors.IsAlreadyExists(err) {
+		return err
+	}
+	existing, err := client.Get(mirror.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	mirror.SetResourceVersion(existing.GetResourceVersion())
+	_, err = client.Update(mirror, metav1.UpdateOptions{})
+	return err
+}
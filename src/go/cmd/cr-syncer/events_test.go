@@ -0,0 +1,143 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newTestEvent(name string, involved *unstructured.Unstructured, message string) *unstructured.Unstructured {
+	o := &unstructured.Unstructured{Object: map[string]interface{}{
+		"involvedObject": map[string]interface{}{
+			"apiVersion": involved.GetAPIVersion(),
+			"kind":       involved.GetKind(),
+			"namespace":  involved.GetNamespace(),
+			"name":       involved.GetName(),
+			"uid":        string(involved.GetUID()),
+		},
+		"reason":  "Failed",
+		"message": message,
+		"type":    "Warning",
+	}}
+	o.SetAPIVersion("v1")
+	o.SetKind("Event")
+	o.SetNamespace(involved.GetNamespace())
+	o.SetName(name)
+	return o
+}
+
+func TestSyncDownstream_mirrorsEvents(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationMirrorEvents] = "true"
+	f := newFixture(t)
+
+	tcrRemote := newTestCR("resource1", "spec1", "status1")
+	tcrRemote.SetUID(types.UID("remote-uid"))
+	tcrLocal := newTestCR("resource1", "spec1", "status1")
+	tcrLocal.SetUID(types.UID("local-uid"))
+	tcrOther := newTestCR("resource2", "spec2", "status2")
+	f.addRemoteObjects(tcrRemote)
+	f.addLocalObjects(
+		tcrLocal,
+		newTestEvent("resource1.1", tcrLocal, "pull failed"),
+		newTestEvent("resource2.1", tcrOther, "unrelated"),
+	)
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	for i := 0; i < 2; i++ {
+		if err := crs.syncDownstream("default/resource1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events := f.remote.Resource(eventsResource).Namespace("default")
+	list, err := events.List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("got %d upstream events, want 1: %v", len(list.Items), list.Items)
+	}
+	event := list.Items[0]
+	if want := "robot-cluster1.resource1.1"; event.GetName() != want {
+		t.Errorf("got event %s, want %s", event.GetName(), want)
+	}
+	ref, _, _ := unstructured.NestedStringMap(event.Object, "involvedObject")
+	wantRef := map[string]string{
+		"apiVersion": "crds.example.com/v1beta1",
+		"kind":       "Goal",
+		"namespace":  "default",
+		"name":       "resource1",
+		"uid":        "remote-uid",
+	}
+	if !reflect.DeepEqual(ref, wantRef) {
+		t.Errorf("got involvedObject %v, want %v", ref, wantRef)
+	}
+	if msg, _, _ := unstructured.NestedString(event.Object, "message"); msg != "pull failed" {
+		t.Errorf("got message %q, want %q", msg, "pull failed")
+	}
+
+	// The second sync didn't write the unchanged event again.
+	var writes int
+	for _, a := range filterReadActions(f.remote.Actions()) {
+		if a.GetResource() == eventsResource {
+			writes++
+		}
+	}
+	if writes != 1 {
+		t.Errorf("got %d event writes, want 1", writes)
+	}
+}
+
+func TestWatchEvents_enqueuesInvolvedObject(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationMirrorEvents] = "true"
+	f := newFixture(t)
+
+	tcrLocal := newTestCR("resource1", "spec1", "status1")
+	f.addLocalObjects(tcrLocal)
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	stop := make(chan struct{})
+	defer close(stop)
+	crs.watchEvents(stop)
+
+	// An Event is added while the status of its object doesn't change.
+	event := newTestEvent("resource1.1", tcrLocal, "pull failed")
+	if _, err := f.local.Resource(eventsResource).Namespace("default").Create(event, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for crs.downstreamQueue.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the object of the Event wasn't enqueued")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if key, _ := crs.downstreamQueue.Get(); key != "default/resource1" {
+		t.Errorf("got key %v, want default/resource1", key)
+	}
+}
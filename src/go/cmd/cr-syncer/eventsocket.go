@@ -0,0 +1,174 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+)
+
+// Number of events buffered per client of the event socket. Events for
+// clients that fall further behind are dropped.
+const eventSocketBufferSize = 256
+
+var mEventSocketDrops = stats.Int64(
+	"cr-syncer.cloudrobotics.com/event_socket_drops",
+	"Reconcile events dropped for slow clients of the event socket",
+	stats.UnitDimensionless,
+)
+
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "cr-syncer.cloudrobotics.com/event_socket_drops_total",
+			Description: "Total number of reconcile events dropped for slow clients of the event socket",
+			Measure:     mEventSocketDrops,
+			Aggregation: view.Count(),
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// eventStream receives the reconcile events of all syncers, nil if
+// -event-socket isn't set.
+var eventStream *eventSocket
+
+// reconcileEvent is streamed to the clients of the event socket as a JSON
+// line.
+type reconcileEvent struct {
+	Time      time.Time `json:"time"`
+	CRD       string    `json:"crd"`
+	Key       string    `json:"key"`
+	Direction string    `json:"direction"`
+	Result    Result    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// eventSocket streams reconcile events to the clients connected to a Unix
+// domain socket, eg for local debugging tools.
+type eventSocket struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	clients map[chan []byte]bool
+}
+
+// listenEventSocket creates the socket at path, replacing a stale socket
+// left behind by a previous process, and accepts clients in the background.
+func listenEventSocket(path string) (*eventSocket, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	e := &eventSocket{listener: l, clients: make(map[chan []byte]bool)}
+	go e.accept()
+	return e, nil
+}
+
+func (e *eventSocket) accept() {
+	for {
+		conn, err := e.listener.Accept()
+		if err != nil {
+			return
+		}
+		events := make(chan []byte, eventSocketBufferSize)
+		e.mu.Lock()
+		e.clients[events] = true
+		e.mu.Unlock()
+		go e.serve(conn, events)
+		go func() {
+			// Clients don't send anything, so a read only returns
+			// once they disconnect.
+			io.Copy(ioutil.Discard, conn)
+			e.drop(events)
+		}()
+	}
+}
+
+// serve writes events to the client until it is dropped.
+func (e *eventSocket) serve(conn net.Conn, events chan []byte) {
+	defer conn.Close()
+	for b := range events {
+		if _, err := conn.Write(b); err != nil {
+			return
+		}
+	}
+}
+
+// drop stops sending events to a client.
+func (e *eventSocket) drop(events chan []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.clients[events] {
+		delete(e.clients, events)
+		close(events)
+	}
+}
+
+// numClients returns the number of connected clients.
+func (e *eventSocket) numClients() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.clients)
+}
+
+// publish sends the event to all clients. It never blocks: events for
+// clients whose buffer is full are dropped and counted.
+func (e *eventSocket) publish(event reconcileEvent) {
+	if e == nil {
+		return
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode reconcile event: %s", err)
+		return
+	}
+	b = append(b, '\n')
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for events := range e.clients {
+		select {
+		case events <- b:
+		default:
+			stats.Record(context.Background(), mEventSocketDrops.M(1))
+		}
+	}
+}
+
+// close stops accepting clients and disconnects the connected ones.
+func (e *eventSocket) close() error {
+	err := e.listener.Close()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for events := range e.clients {
+		close(events)
+		delete(e.clients, events)
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// connectEventSocket listens on a socket in a temporary directory and
+// connects a client to it.
+func connectEventSocket(t *testing.T) (*eventSocket, net.Conn, func()) {
+	dir, err := ioutil.TempDir("", "event-socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := listenEventSocket(filepath.Join(dir, "events.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("unix", filepath.Join(dir, "events.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wait until the client was accepted.
+	for deadline := time.Now().Add(5 * time.Second); e.numClients() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("client wasn't accepted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return e, conn, func() {
+		conn.Close()
+		e.close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestEventSocket_streamsReconciles(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", nil))
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	e, conn, cleanup := connectEventSocket(t)
+	defer cleanup()
+	crs.eventStream = e
+	crs.startInformers()
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	q.Add("default/resource1")
+	crs.processNextWorkItem(context.Background(), q, crs.reconcileUpstream, "upstream")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event reconcileEvent
+	if err := json.Unmarshal(line, &event); err != nil {
+		t.Fatalf("invalid event %q: %s", line, err)
+	}
+	if event.CRD != crd.GetName() || event.Key != "default/resource1" || event.Direction != "upstream" || event.Result != ResultCreated {
+		t.Errorf("got event %+v, want created default/resource1 from upstream", event)
+	}
+}
+
+func TestEventSocket_dropsEventsForSlowClients(t *testing.T) {
+	e, _, cleanup := connectEventSocket(t)
+	defer cleanup()
+
+	// The client doesn't read, so the events beyond what fits into the
+	// buffer and the socket are dropped without blocking.
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100*eventSocketBufferSize; i++ {
+			e.publish(reconcileEvent{Key: "default/resource1", Result: ResultUpdated})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("publish blocked on a slow client")
+	}
+}
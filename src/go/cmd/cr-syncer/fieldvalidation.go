@@ -0,0 +1,75 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"k8s.io/client-go/rest"
+)
+
+// Values of the fieldValidation query parameter of write requests.
+var fieldValidationModes = map[string]bool{
+	"Ignore": true,
+	"Warn":   true,
+	"Strict": true,
+}
+
+// fieldValidationRoundTripper adds the fieldValidation query parameter to
+// write requests, as the client-go version in use has no option for it. In
+// Warn mode, the server reports unknown fields in Warning headers, which are
+// logged.
+type fieldValidationRoundTripper struct {
+	base http.RoundTripper
+	mode string
+}
+
+func (r *fieldValidationRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return r.base.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the request.
+	req = req.Clone(req.Context())
+	query := req.URL.Query()
+	query.Set("fieldValidation", r.mode)
+	req.URL.RawQuery = query.Encode()
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range resp.Header["Warning"] {
+		log.Printf("Warning for %s %s: %s", req.Method, req.URL.Path, warning)
+	}
+	return resp, nil
+}
+
+// applyFieldValidation makes the writes of clients created from config
+// request the server-side field validation given by -field-validation, if
+// it is set.
+func applyFieldValidation(config *rest.Config) {
+	if *fieldValidation == "" {
+		return
+	}
+	wrap, mode := config.WrapTransport, *fieldValidation
+	config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		if wrap != nil {
+			rt = wrap(rt)
+		}
+		return &fieldValidationRoundTripper{base: rt, mode: mode}
+	}
+}
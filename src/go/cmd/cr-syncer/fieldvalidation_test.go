@@ -0,0 +1,95 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+func TestApplyFieldValidation_setsQueryParameterOnWrites(t *testing.T) {
+	defer func(orig string) { *fieldValidation = orig }(*fieldValidation)
+	*fieldValidation = "Strict"
+
+	var mu sync.Mutex
+	modes := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		modes[r.Method] = r.URL.Query().Get("fieldValidation")
+		mu.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method == http.MethodGet {
+			body = []byte(`{"apiVersion": "crds.example.com/v1beta1", "kind": "Goal", "metadata": {"name": "resource1"}}`)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	config := &rest.Config{Host: server.URL}
+	applyFieldValidation(config)
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goals := client.Resource(schema.GroupVersionResource{Group: "crds.example.com", Version: "v1beta1", Resource: "goals"}).Namespace("default")
+	if _, err := goals.Create(newTestCR("resource1", "spec1", nil), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goals.Update(newTestCR("resource1", "spec2", nil), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goals.Get("resource1", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		if got := modes[method]; got != "Strict" {
+			t.Errorf("%s has fieldValidation=%q, want Strict", method, got)
+		}
+	}
+	if got := modes[http.MethodGet]; got != "" {
+		t.Errorf("GET has fieldValidation=%q, want none", got)
+	}
+}
+
+func TestApplyFieldValidation_unset(t *testing.T) {
+	config := &rest.Config{}
+	applyFieldValidation(config)
+	if config.WrapTransport != nil {
+		t.Error("transport is wrapped without -field-validation")
+	}
+}
+
+func TestValidateFlagsRejectsUnknownFieldValidation(t *testing.T) {
+	defer func(orig string) { *remoteServer = orig }(*remoteServer)
+	defer func(orig string) { *fieldValidation = orig }(*fieldValidation)
+
+	*remoteServer = "www.endpoints.my-project.cloud.goog"
+	*fieldValidation = "strict"
+	if err := validateFlags(); err == nil {
+		t.Error("validateFlags() succeeded for lower-case mode, want error")
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Annotation on upstream objects that makes the next status sync copy the
+// full status, even if the CRD has a status-subtree annotation. It's removed
+// once the full status was written, eg for one-off remediation during a
+// migration.
+const annotationForceFullStatus = "cr-syncer.cloudrobotics.com/force-full-status"
+
+// forceFullStatus returns true if the full status should be synced to the
+// upstream object o.
+func forceFullStatus(o *unstructured.Unstructured) bool {
+	v, err := strconv.ParseBool(o.GetAnnotations()[annotationForceFullStatus])
+	return err == nil && v
+}
+
+// clearForceFullStatus removes the force-full-status annotation from the
+// upstream object o after its full status was written. If status is a
+// subresource, the status update ignores the annotations, so it's removed
+// with a separate request.
+func (s *crSyncer) clearForceFullStatus(o *unstructured.Unstructured) *unstructured.Unstructured {
+	if _, ok := o.GetAnnotations()[annotationForceFullStatus]; !ok {
+		return o
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				annotationForceFullStatus: nil,
+			},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	updated, err := s.upstream.Namespace(o.GetNamespace()).Patch(o.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		log.Printf("Failed to remove %s from %s %s: %s", annotationForceFullStatus, o.GetKind(), o.GetName(), err)
+		return o
+	}
+	return updated
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSyncDownstream_forceFullStatus(t *testing.T) {
+	for _, force := range []bool{false, true} {
+		crd := testCRD(crdtypes.NamespaceScoped)
+		f := newFixture(t)
+
+		tcrLocal := newTestCR("resource1", "spec1", map[string]interface{}{
+			"cloud": "cloud_1",
+			"robot": "robot_2",
+		})
+		tcrLocal.SetResourceVersion("123")
+		tcrRemote := newTestCR("resource1", "spec1", map[string]interface{}{
+			"cloud": "cloud_2",
+			"robot": "robot_1",
+		})
+		if force {
+			setAnnotation(tcrRemote, annotationForceFullStatus, "true")
+		}
+		f.addLocalObjects(tcrLocal)
+		f.addRemoteObjects(tcrRemote)
+
+		crs, gvr := f.newCRSyncer(crd, "")
+		crs.subtree = "robot"
+		crs.startInformers()
+		if err := crs.syncDownstream("default/resource1"); err != nil {
+			t.Fatal(err)
+		}
+		crs.stop()
+
+		// Only the subtree is synced, unless the full status is forced.
+		// The annotation is removed with the status update.
+		want := newTestCR("resource1", "spec1", map[string]interface{}{
+			"cloud": "cloud_2",
+			"robot": "robot_2",
+		})
+		if force {
+			want.Object["status"] = tcrLocal.Object["status"]
+		}
+		want.SetAnnotations(map[string]string{
+			annotationResourceVersion: "123",
+		})
+		f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", want))
+		f.verifyWriteActions()
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// CRD annotation that makes the syncer guard upstream objects with a
+	// finalizer until they were written downstream.
+	annotationGuardUntilSynced = "cr-syncer.cloudrobotics.com/guard-until-synced"
+
+	// Prefix of the guard finalizer, followed by the name of the
+	// downstream cluster. It differs from finalizerPrefix, so that it
+	// isn't removed as a stale finalizer.
+	guardFinalizerPrefix = "guard.cr-syncer.cloudrobotics.com/"
+)
+
+// guardFinalizer returns the finalizer that keeps upstream objects from
+// being deleted before they were written downstream.
+func (s *crSyncer) guardFinalizer() string {
+	return guardFinalizerPrefix + s.clusterName
+}
+
+func hasFinalizer(o *unstructured.Unstructured, finalizer string) bool {
+	for _, f := range o.GetFinalizers() {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// awaitsFirstSync returns true if the upstream object src is guarded and
+// was never written downstream. Its deletion must not be propagated until
+// it was.
+func (s *crSyncer) awaitsFirstSync(src *unstructured.Unstructured, dstExists bool) bool {
+	return !dstExists && hasFinalizer(src, s.guardFinalizer())
+}
+
+// addGuard adds the guard finalizer to the upstream object src, which is
+// about to be created downstream, and updates src.
+func (s *crSyncer) addGuard(key string, src *unstructured.Unstructured) error {
+	if !s.guardUntilSynced || src.GetDeletionTimestamp() != nil || hasFinalizer(src, s.guardFinalizer()) {
+		return nil
+	}
+	o := src.DeepCopy()
+	o.SetFinalizers(append(o.GetFinalizers(), s.guardFinalizer()))
+	return s.updateGuard(key, src, o)
+}
+
+// releaseGuard removes the guard finalizer from the upstream object src once
+// it exists downstream, and updates src. Objects that were guarded before
+// the annotation was removed are released, too.
+func (s *crSyncer) releaseGuard(key string, src *unstructured.Unstructured) error {
+	if !hasFinalizer(src, s.guardFinalizer()) {
+		return nil
+	}
+	o := src.DeepCopy()
+	var finalizers []string
+	for _, f := range o.GetFinalizers() {
+		if f != s.guardFinalizer() {
+			finalizers = append(finalizers, f)
+		}
+	}
+	o.SetFinalizers(finalizers)
+	return s.updateGuard(key, src, o)
+}
+
+func (s *crSyncer) updateGuard(key string, src, o *unstructured.Unstructured) error {
+	updated, err := s.upstream.Namespace(o.GetNamespace()).Update(o, metav1.UpdateOptions{})
+	if err != nil {
+		return newAPIErrorf(src, "failed to update guard finalizer: %s", err)
+	}
+	s.recordSelfWrite(key, updated.GetResourceVersion())
+	src.Object = updated.Object
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSyncUpstream_guardsUntilSynced(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationGuardUntilSynced] = "true"
+	f := newFixture(t)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", nil))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+
+	// The first create fails, eg because the robot is offline.
+	failing := true
+	f.local.PrependReactor("create", "*", func(k8stest.Action) (bool, runtime.Object, error) {
+		if failing {
+			return true, nil, errors.New("connection refused")
+		}
+		return false, nil, nil
+	})
+	if err := crs.syncUpstream("default/resource1"); err == nil {
+		t.Fatal("sync succeeded, want error")
+	}
+	o, err := f.remote.Resource(gvr).Namespace("default").Get("resource1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := crs.guardFinalizer(); !hasFinalizer(o, want) {
+		t.Errorf("got finalizers %v, want %s", o.GetFinalizers(), want)
+	}
+
+	failing = false
+	crs.upstreamInf.GetIndexer().Update(o)
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if o, err = f.remote.Resource(gvr).Namespace("default").Get("resource1", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := o.GetFinalizers(); len(got) != 0 {
+		t.Errorf("got finalizers %v after the downstream write, want none", got)
+	}
+}
+
+func TestSyncUpstream_guardedObjectIsCreatedBeforeDeletion(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationGuardUntilSynced] = "true"
+	f := newFixture(t)
+
+	// The object was deleted upstream before it was written downstream.
+	tcrRemote := newTestCR("resource1", "spec1", nil)
+	now := metav1.Now()
+	tcrRemote.SetDeletionTimestamp(&now)
+	tcrRemote.SetFinalizers([]string{guardFinalizerPrefix + "robot-cluster1"})
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	tcrRemoteNew := tcrRemote.DeepCopy()
+	tcrRemoteNew.SetFinalizers(nil)
+
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", newTestCR("resource1", "spec1", nil)))
+	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+	f.verifyWriteActions()
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Time for which writes to an object are suspended when its ownership is
+// handed off to the downstream cluster.
+const handoffDelay = 10 * time.Second
+
+// Ownership of single objects can be handed off from the spec source of the
+// CRD to the other cluster by setting the spec-source annotation on the
+// downstream object. The hand-off happens in two steps, so that the clusters
+// never write the spec at the same time:
+//
+// 1. When the syncer first sees the new owner on the downstream object, it
+//    suspends all writes to the object for one sync cycle. This keeps the
+//    upstream spec from clobbering the changes made by the new owner.
+// 2. In the next cycle, the upstream object is marked with the new owner as
+//    well. From then on, the annotation on both objects agrees, and the spec
+//    is synced from downstream to upstream and the status the other way.
+
+// ownerOf returns the spec source recorded on the object, or "" if unset.
+func ownerOf(o *unstructured.Unstructured) string {
+	return o.GetAnnotations()[annotationObjectSpecSource]
+}
+
+// otherSpecSource returns the cluster that is not the given spec source.
+func otherSpecSource(source string) string {
+	if source == "cloud" {
+		return "robot"
+	}
+	return "cloud"
+}
+
+// handOff drives the ownership hand-off of an object that exists in both
+// clusters. It returns true if the object is being or has been handed off to
+// the downstream cluster, in which case the regular sync must be skipped.
+func (s *crSyncer) handOff(key string, src, dst *unstructured.Unstructured) (bool, Result, error) {
+	newOwner := otherSpecSource(s.specSource)
+	if ownerOf(dst) != newOwner {
+		s.setHandoffPending(key, false)
+		return false, ResultUnchanged, nil
+	}
+	if ownerOf(src) == newOwner {
+		// Hand-off complete.
+		s.setHandoffPending(key, false)
+		if err := s.copyStatusReversed(src, dst); err != nil {
+			return true, ResultFailed, err
+		}
+		return true, ResultUpdated, nil
+	}
+	if !s.handoffPending(key) {
+		log.Printf("Ownership of %s %s moves to %s, suspending writes",
+			src.GetKind(), src.GetName(), newOwner)
+		s.setHandoffPending(key, true)
+		s.upstreamQueue.AddAfter(key, handoffDelay)
+		return true, ResultUnchanged, nil
+	}
+	setAnnotation(src, annotationObjectSpecSource, newOwner)
+	if _, err := s.upstream.Namespace(src.GetNamespace()).Update(src, metav1.UpdateOptions{}); err != nil {
+		return true, ResultFailed, newAPIErrorf(src, "failed to hand off ownership: %s", err)
+	}
+	s.setHandoffPending(key, false)
+	log.Printf("Handed off ownership of %s %s to %s", src.GetKind(), src.GetName(), newOwner)
+	return true, ResultUpdated, nil
+}
+
+func (s *crSyncer) handoffPending(key string) bool {
+	s.handoffMu.Lock()
+	defer s.handoffMu.Unlock()
+	return s.handoffs[key]
+}
+
+func (s *crSyncer) setHandoffPending(key string, pending bool) {
+	s.handoffMu.Lock()
+	defer s.handoffMu.Unlock()
+	if pending {
+		s.handoffs[key] = true
+	} else {
+		delete(s.handoffs, key)
+	}
+}
+
+// copyStatusReversed copies the status of an upstream object that has been
+// handed off to its downstream counterpart, which now owns the spec.
+func (s *crSyncer) copyStatusReversed(up, down *unstructured.Unstructured) error {
+	down.Object["status"] = up.Object["status"]
+	setAnnotation(down, annotationResourceVersion, up.GetResourceVersion())
+	downstream := s.downstream.Namespace(down.GetNamespace())
+	if s.statusIsSubresource() {
+		if down.Object["status"] == nil {
+			down.Object["status"] = struct{}{}
+		}
+		if _, err := downstream.UpdateStatus(down, metav1.UpdateOptions{}); err != nil {
+			return newAPIErrorf(down, "update status failed: %s", err)
+		}
+		return nil
+	}
+	if _, err := downstream.Update(down, metav1.UpdateOptions{}); err != nil {
+		return newAPIErrorf(down, "update failed: %s", err)
+	}
+	return nil
+}
+
+// copySpecReversed copies labels, annotations and spec of a downstream
+// object that owns its spec to its upstream counterpart.
+func (s *crSyncer) copySpecReversed(down, up *unstructured.Unstructured) error {
+	up.SetLabels(down.GetLabels())
+	removeManagedLabel(up)
+	up.SetAnnotations(down.GetAnnotations())
+	copySpec(down, up)
+	deleteAnnotation(up, annotationResourceVersion)
+	if _, err := s.upstream.Namespace(up.GetNamespace()).Update(up, metav1.UpdateOptions{}); err != nil {
+		return newAPIErrorf(up, "update failed: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSyncUpstream_handOffSuspendsWrites(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	// The robot claimed ownership of the object and changed its spec.
+	var (
+		tcrLocal  = newTestCR("resource1", "spec2", "status1")
+		tcrRemote = newTestCR("resource1", "spec1", "status1")
+	)
+	tcrLocal.SetAnnotations(map[string]string{annotationObjectSpecSource: "robot"})
+	tcrRemote.SetAnnotations(map[string]string{annotationObjectSpecSource: "cloud"})
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	// The first cycle must not write anything, the second one hands off
+	// ownership in the upstream cluster without touching the robot's spec.
+	for i := 0; i < 2; i++ {
+		if err := crs.syncUpstream("default/resource1"); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			f.verifyWriteActions()
+		}
+	}
+	tcrRemoteNew := newTestCR("resource1", "spec1", "status1")
+	tcrRemoteNew.SetAnnotations(map[string]string{annotationObjectSpecSource: "robot"})
+
+	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+	f.verifyWriteActions()
+}
+
+func TestSyncDownstream_handedOffCopiesSpecUpstream(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	var (
+		tcrLocal  = newTestCR("resource1", "spec2", "status1")
+		tcrRemote = newTestCR("resource1", "spec1", "status1")
+	)
+	tcrLocal.SetAnnotations(map[string]string{annotationObjectSpecSource: "robot"})
+	tcrRemote.SetAnnotations(map[string]string{annotationObjectSpecSource: "robot"})
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	tcrRemoteNew := newTestCR("resource1", "spec2", "status1")
+	tcrRemoteNew.SetAnnotations(map[string]string{annotationObjectSpecSource: "robot"})
+
+	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+	f.verifyWriteActions()
+}
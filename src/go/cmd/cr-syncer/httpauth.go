@@ -0,0 +1,90 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// authHandler protects the metrics and debug endpoints with a bearer token
+// and/or a client certificate. Health checks are always allowed, as they are
+// made by the kubelet without credentials. If neither a token nor client
+// certificates are configured, all requests are allowed.
+type authHandler struct {
+	token      string // Accepted bearer token, if non-empty.
+	clientCert bool   // If true, a verified client certificate is accepted.
+	openPaths  map[string]bool
+	base       http.Handler
+}
+
+func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.openPaths[r.URL.Path] || h.authorized(r) {
+		h.base.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+func (h *authHandler) authorized(r *http.Request) bool {
+	if h.token == "" && !h.clientCert {
+		return true
+	}
+	if h.token != "" {
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(h.token)) == 1 {
+			return true
+		}
+	}
+	return h.clientCert && r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
+// readToken reads a bearer token from a file, ignoring surrounding whitespace.
+func readToken(file string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", file)
+	}
+	return token, nil
+}
+
+// clientCATLSConfig returns a TLS config that verifies client certificates
+// against the CAs in caFile. Certificates are optional on the TLS level, so
+// that health checks keep working without one.
+func clientCATLSConfig(caFile string) (*tls.Config, error) {
+	b, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+	}, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthHandler(t *testing.T) {
+	h := &authHandler{
+		token:     "secret",
+		openPaths: map[string]bool{"/healthz": true},
+		base: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+	tests := []struct {
+		desc  string
+		path  string
+		token string
+		want  int
+	}{
+		{"metrics without token", "/metrics", "", http.StatusUnauthorized},
+		{"metrics with wrong token", "/metrics", "wrong", http.StatusUnauthorized},
+		{"metrics with token", "/metrics", "secret", http.StatusOK},
+		{"debug without token", "/debug/rpcz", "", http.StatusUnauthorized},
+		{"health without token", "/healthz", "", http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Errorf("GET %s got status %d; want %d", tc.path, rec.Code, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// CRD annotation with the dotted path of a string field in the spec,
+	// eg deviceID, that identifies objects instead of their name. Upstream
+	// and downstream objects with the same identity are counterparts, so
+	// that renamed objects are reconciled with their existing copy.
+	annotationKeyField = "cr-syncer.cloudrobotics.com/key-field"
+
+	// Name of the informer index of objects by namespace and identity.
+	identityIndex = "identity"
+
+	// Marks queue keys that hold the identity of an object instead of its
+	// name. Names can't contain "@".
+	identityKeyPrefix = "@"
+)
+
+// identity returns the value of the key field of the object, or "" if
+// objects are identified by name or the field isn't set.
+func (s *crSyncer) identity(o *unstructured.Unstructured) string {
+	if s.keyField == nil {
+		return ""
+	}
+	id, _, _ := unstructured.NestedString(o.Object, s.keyField...)
+	return id
+}
+
+// identityIndexFunc indexes objects by namespace and identity.
+func (s *crSyncer) identityIndexFunc(obj interface{}) ([]string, error) {
+	o, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, nil
+	}
+	id := s.identity(o)
+	if id == "" {
+		return nil, nil
+	}
+	return []string{o.GetNamespace() + "/" + id}, nil
+}
+
+// indexedKey returns the key of the object in the cache of inf with the
+// given identity in namespace ns, or "" if there is none.
+func indexedKey(inf cache.SharedIndexInformer, ns, id string) string {
+	objs, err := inf.GetIndexer().ByIndex(identityIndex, ns+"/"+id)
+	if err != nil || len(objs) == 0 {
+		return ""
+	}
+	key, _ := keyFunc(objs[0])
+	return key
+}
+
+// counterpartKey returns the key of the object in the cache of inf that has
+// the same identity as o in namespace ns, or "" if there is none or objects
+// are identified by name.
+func (s *crSyncer) counterpartKey(inf cache.SharedIndexInformer, ns string, o *unstructured.Unstructured) string {
+	id := s.identity(o)
+	if id == "" {
+		return ""
+	}
+	return indexedKey(inf, ns, id)
+}
+
+// queueKey returns the key under which changes to o, whose name key is key,
+// are queued. If objects are identified by a key field, this is their
+// identity, so that the deletion and creation events of a rename are
+// reconciled together instead of deleting the downstream copy.
+func (s *crSyncer) queueKey(o *unstructured.Unstructured, key string) string {
+	id := s.identity(o)
+	if id == "" {
+		return key
+	}
+	if ns := o.GetNamespace(); ns != "" {
+		return ns + "/" + identityKeyPrefix + id
+	}
+	return identityKeyPrefix + id
+}
+
+// resolveKey returns the name key of the object that the queue key refers
+// to. Identity keys resolve to the object with that identity in the cache
+// of inf or, if it's gone, to the name key of its counterpart in the cache
+// of other, mapped by toOther and fromOther. Other keys, and identities
+// that are found in neither cache, are returned unchanged.
+func (s *crSyncer) resolveKey(key string, inf, other cache.SharedIndexInformer, toOther, fromOther func(string) string) string {
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil || !strings.HasPrefix(name, identityKeyPrefix) {
+		return key
+	}
+	id := strings.TrimPrefix(name, identityKeyPrefix)
+	if k := indexedKey(inf, ns, id); k != "" {
+		return k
+	}
+	otherNs, _, _ := cache.SplitMetaNamespaceKey(toOther(key))
+	if k := indexedKey(other, otherNs, id); k != "" {
+		return fromOther(k)
+	}
+	return key
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSyncUpstream_keyField(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationKeyField] = "spec.deviceID"
+	f := newFixture(t)
+
+	// device-a was renamed upstream, its copy has the old name.
+	f.addRemoteObjects(
+		newTestCR("device-a-renamed", map[string]interface{}{"deviceID": "a", "mode": "new"}, nil),
+		newTestCR("device-b", map[string]interface{}{"deviceID": "b"}, nil),
+	)
+	tcrLocal := newTestCR("device-a", map[string]interface{}{"deviceID": "a", "mode": "old"}, "status1")
+	f.addLocalObjects(tcrLocal)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	for _, key := range []string{"default/device-a-renamed", "default/device-b"} {
+		if err := crs.syncUpstream(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f.expectLocalActions(
+		k8stest.NewUpdateAction(gvr, "default",
+			newTestCR("device-a", map[string]interface{}{"deviceID": "a", "mode": "new"}, "status1")),
+		k8stest.NewCreateAction(gvr, "default",
+			newTestCR("device-b", map[string]interface{}{"deviceID": "b"}, nil)),
+	)
+	f.verifyWriteActions()
+
+	// The copy isn't deleted as an orphan, as it has an upstream
+	// counterpart.
+	if err := crs.syncDownstream("default/device-a"); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range f.local.Actions() {
+		if a.GetVerb() == "delete" {
+			t.Errorf("unexpected local delete: %s", sprintAction(a))
+		}
+	}
+}
+
+func TestSyncUpstream_renameKeepsDownstreamCopy(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationKeyField] = "spec.deviceID"
+	f := newFixture(t)
+
+	tcrRemote := newTestCR("device-a", map[string]interface{}{"deviceID": "a", "mode": "old"}, nil)
+	f.addRemoteObjects(tcrRemote)
+	f.addLocalObjects(newTestCR("device-a", map[string]interface{}{"deviceID": "a", "mode": "old"}, "status1"))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+
+	// The rename arrives as a deletion of the old and a creation of the
+	// new name, which are queued under the same identity.
+	renamed := newTestCR("device-a-renamed", map[string]interface{}{"deviceID": "a", "mode": "new"}, nil)
+	if err := crs.upstreamInf.GetIndexer().Delete(tcrRemote); err != nil {
+		t.Fatal(err)
+	}
+	if err := crs.upstreamInf.GetIndexer().Add(renamed); err != nil {
+		t.Fatal(err)
+	}
+	oldKey, newKey := crs.queueKey(tcrRemote, "default/device-a"), crs.queueKey(renamed, "default/device-a-renamed")
+	if oldKey != newKey {
+		t.Errorf("got queue keys %q and %q for the same identity", oldKey, newKey)
+	}
+
+	// A sync of the old name doesn't delete the copy either.
+	for _, key := range []string{"default/device-a", newKey} {
+		if err := crs.syncUpstream(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.expectLocalActions(k8stest.NewUpdateAction(gvr, "default",
+		newTestCR("device-a", map[string]interface{}{"deviceID": "a", "mode": "new"}, "status1")))
+	f.verifyWriteActions()
+}
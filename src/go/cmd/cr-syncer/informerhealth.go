@@ -0,0 +1,235 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// Number of consecutive list or watch failures after which an
+	// informer is considered broken, eg because permissions were revoked.
+	informerFailureThreshold = 10
+	// Initial and maximum delay before broken informers are restarted.
+	informerRestartBackoff    = 10 * time.Second
+	maxInformerRestartBackoff = 5 * time.Minute
+)
+
+var mInformerRestarts = stats.Int64(
+	"cr-syncer.cloudrobotics.com/informer_restarts",
+	"Restarts of informers after repeated list or watch failures",
+	stats.UnitDimensionless,
+)
+
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "cr-syncer.cloudrobotics.com/informer_restarts_total",
+			Description: "Total number of informer restarts after repeated list or watch failures",
+			Measure:     mInformerRestarts,
+			TagKeys:     []tag.Key{tagResource},
+			Aggregation: view.Count(),
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// informerHealth tracks the list and watch failures of a syncer's informers.
+// Informers retry failed requests forever, so without it a syncer whose
+// informers can't list or watch anymore silently stops syncing.
+type informerHealth struct {
+	threshold int
+	mu        sync.Mutex
+	failures  map[string]int  // Consecutive failures by direction.
+	unhealthy map[string]bool // Set at the threshold until a request of the direction succeeds.
+	backoff   time.Duration   // Delay before the next restart.
+	restarts  int
+	failed    chan struct{} // Signals superviseInformers.
+}
+
+func newInformerHealth() *informerHealth {
+	return &informerHealth{
+		threshold: informerFailureThreshold,
+		failures:  make(map[string]int),
+		unhealthy: make(map[string]bool),
+		backoff:   informerRestartBackoff,
+		failed:    make(chan struct{}, 1),
+	}
+}
+
+// record records the result of a list or watch request of the informer for
+// the given direction.
+func (h *informerHealth) record(direction string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		// Only the direction that succeeded recovered, the other one
+		// may still be failing.
+		h.failures[direction] = 0
+		delete(h.unhealthy, direction)
+		if len(h.unhealthy) == 0 {
+			h.backoff = informerRestartBackoff
+		}
+		return
+	}
+	h.failures[direction]++
+	if h.failures[direction] == h.threshold {
+		h.unhealthy[direction] = true
+		select {
+		case h.failed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (h *informerHealth) healthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.unhealthy) == 0
+}
+
+// restarted resets the failure counts for the new informers.
+func (h *informerHealth) restarted() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures = make(map[string]int)
+	h.restarts++
+}
+
+// nextBackoff returns the delay before the next restart and doubles it for
+// the one after.
+func (h *informerHealth) nextBackoff() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b := h.backoff
+	if h.backoff *= 2; h.backoff > maxInformerRestartBackoff {
+		h.backoff = maxInformerRestartBackoff
+	}
+	return b
+}
+
+// recordListWatch records the result of a list or watch request of the
+// informer for the given direction.
+func (s *crSyncer) recordListWatch(direction string, err error) {
+	if err != nil {
+		log.Printf("Listing or watching %s %s failed: %s", direction, s.crd.GetName(), err)
+	}
+	s.health.record(direction, err)
+}
+
+// healthy returns false if the informers of the syncer have failed
+// repeatedly and haven't recovered yet.
+func (s *crSyncer) healthy() bool {
+	return s.health.healthy()
+}
+
+// superviseInformers restarts the informers with backoff whenever they
+// failed repeatedly, until the syncer is stopped.
+func (s *crSyncer) superviseInformers() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.health.failed:
+		}
+		backoff := s.health.nextBackoff()
+		log.Printf("Informers for %s failed repeatedly, restarting them in %s", s.crd.GetName(), backoff)
+		select {
+		case <-s.done:
+			return
+		case <-time.After(backoff):
+		}
+		if err := s.restartInformers(); err != nil {
+			log.Printf("Restarting informers for %s failed: %s", s.crd.GetName(), err)
+			continue
+		}
+		go func() {
+			if err := s.startInformers(); err != nil {
+				log.Printf("Starting informers for %s failed: %s", s.crd.GetName(), err)
+			}
+		}()
+	}
+}
+
+// informerPair holds the informers of a syncer.
+type informerPair struct {
+	upstream, downstream cache.SharedIndexInformer
+}
+
+// informers returns the current informers. Unlike the upstreamInf and
+// downstreamInf fields, it can be used without holding configMu, eg by the
+// work queues, which are also called while configMu is held.
+func (s *crSyncer) informers() informerPair {
+	p, _ := s.liveInformers.Load().(informerPair)
+	return p
+}
+
+// restartInformers stops the current informers and replaces them with new
+// ones, which have to be started with startInformers. Their initial list
+// queues all objects, so anything missed in the meantime is synced.
+func (s *crSyncer) restartInformers() error {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	select {
+	case <-s.done:
+		return fmt.Errorf("syncer was stopped")
+	default:
+	}
+	close(s.informersDone)
+	s.informersDone = make(chan struct{})
+	if err := s.newInformers(); err != nil {
+		return err
+	}
+	s.health.restarted()
+
+	ctx, err := tag.New(context.Background(), tag.Insert(tagResource, s.crd.GetName()))
+	if err != nil {
+		panic(err)
+	}
+	stats.Record(ctx, mInformerRestarts.M(1))
+	return nil
+}
+
+// healthzHandler serves the health of the process. It fails if the
+// informers of any syncer have failed repeatedly, and lists those syncers.
+func healthzHandler(syncers func() []*crSyncer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var unhealthy []string
+		for _, s := range syncers() {
+			if !s.healthy() {
+				unhealthy = append(unhealthy, s.crd.GetName())
+			}
+		}
+		if len(unhealthy) > 0 {
+			sort.Strings(unhealthy)
+			http.Error(w, "informers failing for: "+strings.Join(unhealthy, ", "), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}
+}
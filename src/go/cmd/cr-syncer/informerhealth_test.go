@@ -0,0 +1,105 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestCRSyncer_restartsFailingInformers(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	// run() waits for the remote CRD before starting the informers.
+	f.addRemoteObjects(crdObject(t, crd))
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.health.threshold = 2
+	crs.health.backoff = 10 * time.Millisecond
+
+	// Simulate revoked permissions in the remote cluster.
+	var failing int32 = 1
+	f.remote.PrependReactor("list", "*", func(k8stest.Action) (bool, runtime.Object, error) {
+		if atomic.LoadInt32(&failing) == 1 {
+			return true, nil, fmt.Errorf("forbidden")
+		}
+		return false, nil, nil
+	})
+	handler := healthzHandler(func() []*crSyncer { return []*crSyncer{crs} })
+	healthz := func() int {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("GET", "/healthz", nil))
+		return rec.Code
+	}
+
+	go crs.run()
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("unhealthy syncer", func() bool { return healthz() == http.StatusServiceUnavailable })
+	waitFor("informer restart", func() bool {
+		crs.health.mu.Lock()
+		defer crs.health.mu.Unlock()
+		return crs.health.restarts > 0
+	})
+
+	// Once permissions are restored, the restarted informers recover.
+	atomic.StoreInt32(&failing, 0)
+	waitFor("healthy syncer", func() bool { return healthz() == http.StatusOK })
+}
+
+func TestInformerHealth_successInOtherDirectionDoesntMaskFailures(t *testing.T) {
+	h := newInformerHealth()
+	h.threshold = 3
+
+	// The local informer keeps succeeding while the remote one fails.
+	for i := 0; i < 5; i++ {
+		h.record("downstream", nil)
+		h.record("upstream", fmt.Errorf("forbidden"))
+	}
+	if h.healthy() {
+		t.Error("healthy() = true while the upstream informer keeps failing")
+	}
+	select {
+	case <-h.failed:
+	default:
+		t.Error("no restart was signaled")
+	}
+	h.record("downstream", nil)
+	if h.healthy() {
+		t.Error("healthy() = true after a downstream success")
+	}
+
+	h.record("upstream", nil)
+	if !h.healthy() {
+		t.Error("healthy() = false after the upstream informer recovered")
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// CRD annotation that defers the first status sync of each object after the
+// syncer started until the downstream cluster has observed the current spec.
+const annotationDeferInitialStatus = "cr-syncer.cloudrobotics.com/defer-initial-status"
+
+// deferInitialStatus returns true if the status of the downstream object src
+// must not be synced yet, because it's the first sync of key since the syncer
+// started and status.observedGeneration lags behind the generation. When
+// objects already exist in both clusters at startup, the downstream
+// controller may not have reconciled the latest spec yet, and its status
+// would overwrite a more accurate upstream status. After the first sync, the
+// status is synced as usual.
+func (s *crSyncer) deferInitialStatus(key string, src *unstructured.Unstructured) bool {
+	if !s.deferInitialStatusSync {
+		return false
+	}
+	s.initialStatusMu.Lock()
+	defer s.initialStatusMu.Unlock()
+	if s.initialStatusSynced[key] {
+		return false
+	}
+	if !observedCurrentGeneration(src) {
+		log.Printf("Deferring initial status sync of %s %s: generation %d not observed yet",
+			src.GetKind(), src.GetName(), src.GetGeneration())
+		return true
+	}
+	if s.initialStatusSynced == nil {
+		s.initialStatusSynced = map[string]bool{}
+	}
+	s.initialStatusSynced[key] = true
+	return false
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+func TestSyncDownstream_defersInitialStatus(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationDeferInitialStatus] = "true"
+	crd.Spec.Subresources = &crdtypes.CustomResourceSubresources{Status: &crdtypes.CustomResourceSubresourceStatus{}}
+	f := newFixture(t)
+
+	tcrLocal := newTestCR("resource1", "spec2", map[string]interface{}{
+		"observedGeneration": int64(1),
+		"phase":              "Ready",
+	})
+	tcrLocal.SetGeneration(2)
+	tcrLocal.SetResourceVersion("123")
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(newTestCR("resource1", "spec2", nil))
+
+	crs, _ := f.newCRSyncer(crd, "")
+	defer crs.stop()
+	crs.startInformers()
+
+	// The status belongs to generation 1 and must not be propagated on
+	// the first sync.
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if writes := filterReadActions(f.remote.Actions()); len(writes) != 0 {
+		t.Fatalf("got upstream writes %v before the generation was observed, want none", writes)
+	}
+
+	// Once the downstream controller caught up, the status is synced.
+	observed := tcrLocal.DeepCopy()
+	observed.Object["status"] = map[string]interface{}{
+		"observedGeneration": int64(2),
+		"phase":              "Ready",
+	}
+	observed.SetResourceVersion("124")
+	crs.downstreamInf.GetIndexer().Update(observed)
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if writes := filterReadActions(f.remote.Actions()); len(writes) != 1 {
+		t.Fatalf("got upstream writes %v, want 1", writes)
+	}
+
+	// Later status changes are synced even if the generation lags.
+	lagging := observed.DeepCopy()
+	lagging.SetGeneration(3)
+	lagging.Object["status"] = map[string]interface{}{
+		"observedGeneration": int64(2),
+		"phase":              "Updating",
+	}
+	lagging.SetResourceVersion("125")
+	crs.downstreamInf.GetIndexer().Update(lagging)
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if writes := filterReadActions(f.remote.Actions()); len(writes) != 2 {
+		t.Errorf("got upstream writes %v, want 2", writes)
+	}
+}
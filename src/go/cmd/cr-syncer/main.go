@@ -23,14 +23,39 @@
 //   cr-syncer.cloudrobotics.com/filter-by-robot-name: <bool>
 //
 // If true, only sync CRs that have a label 'cloudrobotics.com/robot-name: <robot-name>'
-// that matches the robot-name arg given on the command line.
+// that matches the robot-name arg given on the command line, or the contents
+// of the file given by robot-name-file.
 //
 // Annotation "status-subtree"
 //
 //   cr-syncer.cloudrobotics.com/status-subtree: <string>
 //
 // If specified, only sync the given subtree of the Status field. This is useful
-// if resources have a shared status.
+// if resources have a shared status. Nested subtrees are given as dotted paths,
+// and "{robotName}" is replaced by the robot-name arg, so that with eg
+// "robots.{robotName}" each robot writes into its own key of a shared map.
+//
+// For one-off remediation, eg during a migration, the annotation
+// "cr-syncer.cloudrobotics.com/force-full-status: true" can be set on an
+// upstream object. The next status sync then copies the full status and
+// removes the annotation.
+//
+// Annotation "spec-subtree"
+//
+//   cr-syncer.cloudrobotics.com/spec-subtree: <string>
+//
+// If specified, only sync the given subtree of the spec downstream, and keep
+// the other spec fields of the downstream objects. This is useful if specs
+// have a shared section and a per-cluster section that is set downstream.
+// Like for status-subtree, "{robotName}" is replaced by the robot-name arg.
+//
+// Annotation "clear-status-when-empty"
+//
+//   cr-syncer.cloudrobotics.com/clear-status-when-empty: <bool>
+//
+// If true, the upstream status is cleared when the downstream object has no
+// status. By default, the upstream status is kept until the downstream object
+// has a status, so that eg a recreated downstream object doesn't wipe it.
 //
 // Annotation "spec-source"
 //
@@ -39,29 +64,271 @@
 // If set to "cloud", the source of truth for object existence and specs (upstream) is
 // the remote cluster and for status it's local (downstream). If set to "robot", the roles
 // are reversed. Otherwise, eg when using the empty string "", synchronization is disabled.
+//
+// The same annotation can be set on single objects in the downstream cluster to
+// hand off the ownership of their spec. Writes to the object are suspended for
+// one sync cycle, then the upstream object is marked with the new owner and its
+// spec is synced from the downstream cluster from then on.
+//
+// Annotation "validate-schema"
+//
+//   cr-syncer.cloudrobotics.com/validate-schema: <bool>
+//
+// If true, objects are validated against the schema of the CRD in the
+// downstream cluster before they are written. Objects that don't match are
+// skipped instead of being retried until they are changed again.
+//
+// Annotation "require-observed-generation"
+//
+//   cr-syncer.cloudrobotics.com/require-observed-generation: <bool>
+//
+// If true, the status is only copied upstream once status.observedGeneration
+// matches metadata.generation in the downstream cluster, so that the upstream
+// never sees a status that belongs to an older spec. This requires the status
+// to be declared as a subresource, as generation tracking is disabled
+// otherwise. Without it, a warning is logged and the annotation is ignored.
+//
+// Annotation "defer-initial-status"
+//
+//   cr-syncer.cloudrobotics.com/defer-initial-status: <bool>
+//
+// If true, the first status sync of each object after the syncer started
+// waits until status.observedGeneration matches metadata.generation in the
+// downstream cluster. This keeps a downstream status that predates the
+// current spec from overwriting the upstream status when the syncer starts
+// with objects that exist in both clusters. Later status syncs aren't
+// deferred. Like require-observed-generation, this requires the status to be
+// declared as a subresource.
+//
+// Annotation "namespace-map"
+//
+//   cr-syncer.cloudrobotics.com/namespace-map: <src>=<dst>[,<src>=<dst>...]
+//
+// If set on a namespaced CRD, CRs in the <src> namespaces are synced in
+// addition to the "default" namespace. Upstream objects in namespace <src> are
+// synced to namespace <dst> downstream and vice versa. The "default" namespace
+// is kept as-is unless it's mapped. The map must be one-to-one: each <src> and
+// each <dst> may only appear once. Objects in the namespaces given by
+// excluded-namespaces, by default the Kubernetes system namespaces, are never
+// synced.
+//
+// Annotation "deletion-grace-seconds"
+//
+//   cr-syncer.cloudrobotics.com/deletion-grace-seconds: <int>
+//
+// If set, downstream objects are deleted with the given grace period when
+// their upstream counterpart is deleted. Otherwise, the server default is used.
+//
+// Annotation "delete-propagation"
+//
+//   cr-syncer.cloudrobotics.com/delete-propagation: <Foreground|Background|Orphan>
+//
+// If set, downstream objects are deleted with the given propagation policy,
+// which controls whether the objects they own are deleted first, in the
+// background or not at all. Otherwise, the server default is used.
+//
+// Annotation "status-fields"
+//
+//   cr-syncer.cloudrobotics.com/status-fields: <field>=<immediate|batched>[,...]
+//   cr-syncer.cloudrobotics.com/status-batch-seconds: <int>
+//
+// Classifies top-level fields of the synced status. Changes to immediate fields,
+// which is the default, are synced right away. If only batched fields changed, eg
+// a heartbeat timestamp, the status is synced at most every status-batch-seconds
+// (default 30).
+//
+// Annotation "compress-subtree"
+//
+//   cr-syncer.cloudrobotics.com/compress-subtree: <bool>
+//
+// If true, the status subtree is written upstream as a base64-encoded gzipped
+// JSON string instead of a dict. Useful if many robots write large status into
+// the same object. Consumers of the upstream status have to decode it.
+//
+// Annotation "subtree-transform"
+//
+//   cr-syncer.cloudrobotics.com/subtree-transform: <identity|flatten>
+//
+// Reshapes the status subtree before it is written upstream, eg for aggregators
+// that expect a particular format. "flatten" turns nested dicts into a single
+// dict with dotted keys. The default is "identity".
+//
+// Annotation "sync-referenced-secret"
+//
+//   cr-syncer.cloudrobotics.com/sync-referenced-secret: <path>
+//
+// Dotted path of a field in the spec, eg credentials.secretName, that holds the
+// name of a Secret in the object's namespace. The Secret is mirrored downstream
+// before the object is written, and deleted along with the object.
+//
+// Annotation "key-field"
+//
+//   cr-syncer.cloudrobotics.com/key-field: <path>
+//
+// Dotted path of a string field in the spec, eg deviceID, that identifies
+// objects. Upstream and downstream objects with the same value in the same
+// namespace are counterparts, even if their names differ. Objects without the
+// field are matched by name.
+//
+// Annotation "project-to-configmap"
+//
+//   cr-syncer.cloudrobotics.com/project-to-configmap: <name>
+//
+// Renders the spec of each object as JSON into the "spec.json" key of a
+// ConfigMap in the object's downstream namespace, for components that read
+// their configuration from ConfigMaps. "{name}" in the ConfigMap name is
+// replaced with the name of the object. The ConfigMap is written alongside the
+// object and deleted along with it.
+//
+// Annotation "create-defaults"
+//
+//   cr-syncer.cloudrobotics.com/create-defaults: <json>
+//
+// JSON object that is deep-merged into the spec of objects when they are
+// created downstream, eg to set a cluster-specific storage class. Fields set
+// upstream take precedence. On updates, the defaulted fields keep their current
+// downstream values, so downstream controllers can change them.
+//
+// Annotation "mirror-events"
+//
+//   cr-syncer.cloudrobotics.com/mirror-events: <bool>
+//
+// If true, Events that reference downstream objects are copied to the upstream
+// cluster when they are added or updated, with the involved object rewritten
+// to the upstream object. Copies are prefixed with the cluster name.
+//
+// Annotation "require-sync-gate"
+//
+//   cr-syncer.cloudrobotics.com/require-sync-gate: <bool>
+//
+// If true, only objects labeled cloudrobotics.com/sync=enabled upstream are
+// synced, so that syncing can be rolled out object by object. Objects that lose
+// the label are left as-is downstream, but their deletion is still propagated.
+//
+// Annotation "sync-predicate"
+//
+//   cr-syncer.cloudrobotics.com/sync-predicate: <path>=<value>
+//   cr-syncer.cloudrobotics.com/sync-predicate-delete: <bool>
+//
+// If set, only upstream objects whose field at the dotted path, eg spec.phase,
+// has the given value are synced. Objects are checked again whenever they
+// change. Objects that stop matching are left as-is downstream, unless
+// sync-predicate-delete is true, in which case their downstream copies are
+// deleted. A malformed predicate matches no objects.
+//
+// Annotation "guard-until-synced"
+//
+//   cr-syncer.cloudrobotics.com/guard-until-synced: <bool>
+//
+// If true, upstream objects get the finalizer
+// guard.cr-syncer.cloudrobotics.com/<cluster> before they are created
+// downstream, which is removed once the downstream write succeeded. An object
+// that is deleted before it was ever written downstream, eg while the robot
+// is offline, is only deleted after it was created downstream.
+//
+// Annotation "adoption"
+//
+//   cr-syncer.cloudrobotics.com/adoption: <adopt|strict>
+//
+// Controls whether existing downstream objects with the name of an upstream
+// object are managed by the syncer. With "adopt", the default, they are taken
+// over. With "strict", only objects that the syncer created, or that carry the
+// cr-syncer.cloudrobotics.com/owned-by-upstream: "true" annotation, are
+// managed. Other objects are considered foreign and are left untouched, so
+// that objects of another system with similar names aren't taken over.
+//
+// Annotation "remote-group"
+//
+//   cr-syncer.cloudrobotics.com/remote-group: <group>
+//
+// API group of the CRD in the remote cluster, eg while it is being renamed. The
+// remote CRD must have the same kind, scope and schema, which is checked when
+// the syncer starts.
+//
+// Annotation "create-namespace"
+//
+//   cr-syncer.cloudrobotics.com/create-namespace: <bool>
+//   cr-syncer.cloudrobotics.com/create-namespace-labels: <key>,...
+//
+// If true, missing downstream namespaces are created before objects are
+// created in them, copying the listed labels from the upstream namespace.
+// Created namespaces are labeled cr-syncer.cloudrobotics.com/created-namespace
+// so that they can be cleaned up. Only objects in the default namespace are
+// synced without a namespace-map, so it's needed for other namespaces.
+//
+// Annotation "concurrency"
+//
+//   cr-syncer.cloudrobotics.com/concurrency: <int>
+//
+// Number of objects that are synced concurrently in each direction, overriding
+// -max-sync-concurrency, eg to give a high-churn CRD more workers. Changes to a
+// single object are always synced in order.
+//
+// Annotation "startup-delay"
+//
+//   cr-syncer.cloudrobotics.com/startup-delay: <duration>
+//
+// Time to wait after the syncer started before objects are synced, eg "30s".
+// Gives the objects and admission webhooks of a freshly added CRD time to
+// appear. Changes in the meantime are queued and synced afterwards.
+//
+// Annotation "ordered"
+//
+//   cr-syncer.cloudrobotics.com/ordered: true
+//
+// If true, the objects of the CRD are synced one at a time in the order of
+// their creation timestamps, overriding the concurrency. This trades
+// throughput for a deterministic order, eg for workflows where later objects
+// depend on earlier ones. Failed syncs are retried with backoff without
+// holding back the other objects. Can't be used with -enable-priority-queue.
+//
+// Object annotation "delete-after"
+//
+//   cr-syncer.cloudrobotics.com/delete-after: <crd>/<name>
+//
+// Set on an object, eg goals.example.com/child1, to defer propagating its
+// deletion downstream until the referenced object in the same namespace has
+// been deleted downstream. This keeps the teardown order of related objects.
+//
+// Object label "sync-paused"
+//
+//   cloudrobotics.com/sync-paused: "true"
+//
+// Set on the upstream or downstream copy of an object to pause its sync in
+// both directions, eg to freeze a problematic object while the other objects
+// of the CRD are still synced. Removing the label resumes the sync.
 package main
 
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/googlecloudrobotics/core/src/go/pkg/kubeutils"
+	"github.com/googlecloudrobotics/core/src/go/pkg/version"
 	"github.com/motemen/go-loghttp"
 	"go.opencensus.io/exporter/prometheus"
 	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
 	"go.opencensus.io/zpages"
 	"golang.org/x/net/context"
 	"golang.org/x/net/http2"
-	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	crdclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	crdinformer "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
@@ -82,6 +349,161 @@ var (
 	verbose      = flag.Bool("verbose", false, "Enable verbose logging")
 	listenAddr   = flag.String("listen-address", ":80", "HTTP listen address")
 
+	remoteServerFrom = flag.String("remote-server-from", "",
+		"Read the remote server from a ConfigMap or Secret in the local cluster instead of -remote-server, given as "+
+			"configmap:<namespace>/<name>[/<key>] or secret:<namespace>/<name>[/<key>], with the key defaulting to "+
+			defaultRemoteServerKey+". When the value changes, the syncers reconnect to the new server.")
+
+	waitForRemote = flag.Bool("wait-for-remote", false,
+		"Before starting the syncers, wait until the remote server answers a discovery request, retrying with backoff. "+
+			"Otherwise the syncers start right away and log failing lists until the remote server is reachable.")
+
+	tcpKeepAlive = flag.Duration("tcp-keepalive", 30*time.Second,
+		"Interval of TCP keepalive probes on connections to the remote server. Negative values disable them.")
+	http2ReadIdleTimeout = flag.Duration("http2-read-idle-timeout", 30*time.Second,
+		"Send an HTTP/2 ping on connections to the remote server if nothing was received for this long, eg on idle watches")
+	http2PingTimeout = flag.Duration("http2-ping-timeout", 15*time.Second,
+		"Close connections to the remote server if an HTTP/2 ping isn't answered within this time, so that watches fail fast")
+
+	kubeAPIQPS = flag.Float64("kube-api-qps", 0,
+		"Maximum queries per second to the local and remote Kubernetes APIs. The client-go default (5) is used if unset.")
+	kubeAPIBurst = flag.Int("kube-api-burst", 0,
+		"Maximum burst of queries to the local and remote Kubernetes APIs. The client-go default (10) is used if unset.")
+
+	tokenScopes = flag.String("token-scopes", "https://www.googleapis.com/auth/cloud-platform",
+		"Comma-separated list of OAuth2 scopes requested for the token used to access the remote server")
+
+	backupServers = flag.String("backup-servers", "",
+		"Comma-separated list of Kubernetes servers, accessed like the remote server, to which upstream specs are mirrored for disaster recovery")
+
+	robotNameFile = flag.String("robot-name-file", "",
+		"File with the name of the robot we are running on, eg mounted through the downward API. Overrides -robot-name.")
+
+	metricsTokenFile = flag.String("metrics-token-file", "",
+		"File with a bearer token that is required to access /metrics and /debug")
+	tlsCertFile  = flag.String("tls-cert-file", "", "Certificate for serving HTTPS on the listen address")
+	tlsKeyFile   = flag.String("tls-key-file", "", "Private key for serving HTTPS on the listen address")
+	clientCAFile = flag.String("client-ca-file", "",
+		"CA bundle for verifying client certificates, which grant access to /metrics and /debug. Requires -tls-cert-file.")
+
+	stripCachedFields = flag.Bool("strip-cached-fields", false,
+		"Remove managedFields and the paths given by -cache-strip-paths from cached objects to reduce memory usage. "+
+			"The sync functions fetch full objects from the API server instead.")
+	extraCacheStripPaths = flag.String("cache-strip-paths", "",
+		"Comma-separated list of dotted field paths (eg spec.payload) that are removed from cached objects if -strip-cached-fields is set")
+
+	listPageSize = flag.Int64("list-page-size", 0,
+		"If set, informers list objects in pages of this size instead of in a single response, "+
+			"which avoids timeouts when listing large numbers of objects")
+
+	fieldValidation = flag.String("field-validation", "",
+		"If set to Ignore, Warn or Strict, writes request this server-side field validation, so that unknown fields in synced "+
+			"objects are reported or rejected instead of being dropped silently. Strict may reject objects that were accepted before. "+
+			"Requires Kubernetes 1.25 or later, older servers ignore it.")
+
+	maxSyncConcurrency = flag.Int("max-sync-concurrency", 1,
+		"Number of objects of a CRD that are synced concurrently in each direction. "+
+			"Can be overridden per CRD with the "+annotationConcurrency+" annotation.")
+	initialConcurrency = flag.Int("initial-concurrency", 0,
+		"If higher than the sync concurrency, this many objects are synced concurrently until the backlog of the initial "+
+			"list is drained, to catch up quickly after startup")
+
+	metadataOnlyCache = flag.Bool("metadata-only-cache", false,
+		"List and watch only the metadata of objects, which greatly reduces memory usage and the watch traffic. "+
+			"The sync functions fetch full objects from the API server, costing a request per sync.")
+
+	traceSampleProbability = flag.Float64("trace-sample-probability", 0,
+		"Fraction of syncs that are traced. Traces are shown on /debug/tracez, exported to -otlp-endpoint if set, and "+
+			"attached as exemplars to the cr_syncer_sync_duration_seconds histogram.")
+	otlpEndpoint = flag.String("otlp-endpoint", "",
+		"If set, traces of sampled syncs and log records of lifecycle events (syncers started and stopped, writes, "+
+			"failed syncs) are exported to this OpenTelemetry collector using OTLP/HTTP, eg http://otel-collector:4318")
+
+	verifyStatusWrites = flag.Bool("verify-status-writes", false,
+		"Read back upstream objects after writing their status to check that the write took effect. Costs an extra request per write.")
+
+	recordSyncResults = flag.Bool("record-sync-results", false,
+		"Write the outcome of the last sync of each object to the "+annotationLastSyncResult+" and "+annotationLastSyncError+" annotations "+
+			"of both its copies. Costs two extra requests whenever the outcome changes.")
+
+	recordChangeEvents = flag.Bool("record-change-events", false,
+		"Create a Normal Event on each updated object that lists the changed top-level fields, eg spec or status, so "+
+			"that kubectl describe shows what the syncer changed. Limited to one Event per object per minute.")
+
+	statusMinInterval = flag.Duration("status-min-interval", 0,
+		"Minimum interval between upstream status writes of an object. Status changes in between are coalesced into "+
+			"a single write of the latest status. Spec syncs are not affected.")
+
+	conflictBackoff = flag.Duration("conflict-backoff", 0,
+		"If set, upstream status writes of an object are held back for this long after another writer changed its status, "+
+			"instead of overwriting it immediately")
+
+	writeSpecChecksums = flag.Bool("write-spec-checksums", false,
+		"Annotate downstream objects with "+annotationSpecChecksum+", a checksum of the upstream spec, "+
+			"so that tooling can check whether they are current without comparing the specs")
+
+	labelManagedObjects = flag.Bool("label-managed-objects", false,
+		"Label downstream objects with "+labelManaged+"=true, so that the objects managed by the syncer can be selected "+
+			"with kubectl get -l. The label isn't copied upstream.")
+
+	enablePriorityQueue = flag.Bool("enable-priority-queue", false,
+		"Sync objects with a higher "+annotationPriority+" annotation first when there is a backlog")
+
+	stuckDeletionThreshold = flag.Duration("stuck-deletion-threshold", 0,
+		"If set, downstream objects whose deletion was propagated but that are still terminating after this long, "+
+			"eg because of a finalizer, are counted as stuck and their upstream objects are annotated with "+
+			annotationBlockingFinalizers)
+
+	maxObjectSize = flag.Int64("max-object-size", defaultMaxObjectSize,
+		"Objects that would exceed this size in bytes when written aren't synced, as etcd would reject them. "+
+			"Skipped objects are logged, counted and annotated with "+annotationOversized+". 0 disables the check.")
+
+	networkRetryMaxDelay = flag.Duration("network-retry-max-delay", 5*time.Second,
+		"Maximum delay between retries of syncs that failed with a network error, eg a connection reset. "+
+			"These are retried sooner than syncs that the API server rejected, which back off further.")
+
+	excludedNamespacesFlag = flag.String("excluded-namespaces", "kube-system,kube-public,kube-node-lease",
+		"Comma-separated list of namespaces whose objects are never synced if a CRD is synced in all namespaces")
+
+	maxObjectAge = flag.Duration("max-object-age", 0,
+		"If set, upstream objects that were last modified longer ago are not created downstream until they are updated again. "+
+			"Bounds the initial catch-up when backfilling.")
+	objectAgeAnnotation = flag.String("object-age-annotation", "",
+		"Annotation holding the RFC 3339 last-modified time of objects for -max-object-age. If unset, the time of the last "+
+			"spec change in the managedFields is used, or the creationTimestamp if there is none.")
+
+	maxClockSkew = flag.Duration("max-clock-skew", 30*time.Second,
+		"Clock skew between the local and remote API servers beyond which a warning is logged. The skew is checked at "+
+			"startup and every 10 minutes, and exported as a metric. 0 disables the checks.")
+	disableTimestampsOnSkew = flag.Bool("disable-timestamps-on-clock-skew", false,
+		"Don't compare timestamps from the other cluster with the local time, eg for -max-object-age, while the clock "+
+			"skew exceeds -max-clock-skew")
+
+	resyncBatchSize = flag.Int("resync-batch-size", 0,
+		"If set, the objects of a periodic resync are enqueued in batches of this size instead of all at once, to smooth the load on the remote cluster")
+	resyncBatchInterval = flag.Duration("resync-batch-interval", time.Second,
+		"Interval between the batches of -resync-batch-size")
+
+	statusStateDir = flag.String("status-state-dir", "",
+		"If set, the resource versions of the last status writes are persisted in this directory, so that the status "+
+			"of unchanged objects isn't written again after a restart. Should be on a volume that survives restarts.")
+
+	eventSocketPath = flag.String("event-socket", "",
+		"If set, reconcile events are streamed as JSON lines to clients of a Unix domain socket at this path, eg for local debugging tools")
+
+	auditFile = flag.String("audit-file", "",
+		"If set, an entry with the changed spec and status fields is appended to this file for each write")
+	auditRedactFields = flag.String("audit-redact-fields", "",
+		"Comma-separated list of dotted field paths (eg spec.credentials) whose values are masked in -audit-file")
+	auditFormat = flag.String("audit-format", auditFormatJSON,
+		"Format of -audit-file: json for JSON lines, or yaml for a stream of YAML documents")
+
+	migrateCRD = flag.String("migrate-spec-source", "",
+		"Name of a CRD whose spec-source annotation was changed. Before syncing starts, the objects are "+
+			"snapshotted and their spec-source annotations are set to the new source.")
+	migrationSnapshotDir = flag.String("migration-snapshot-dir", os.TempDir(),
+		"Directory for the snapshots written by -migrate-spec-source")
+
 	sizeDistribution    = view.Distribution(0, 1024, 2048, 4096, 16384, 65536, 262144, 1048576, 4194304, 33554432)
 	latencyDistribution = view.Distribution(0, 1, 2, 5, 10, 15, 25, 50, 100, 200, 400, 800, 1500, 3000, 6000)
 
@@ -123,25 +545,6 @@ func init() {
 	}
 }
 
-// PrefixingRoundtripper is a HTTP roundtripper that adds a specified prefix to
-// all HTTP requests. We need to use it instead of setting APIPath because
-// autogenerated and dynamic Kubernetes clients overwrite the REST config's
-// APIPath.
-type PrefixingRoundtripper struct {
-	Prefix string
-	Base   http.RoundTripper
-}
-
-func (pr *PrefixingRoundtripper) RoundTrip(r *http.Request) (*http.Response, error) {
-	// Avoid an extra roundtrip for the protocol upgrade
-	r.URL.Scheme = "https"
-	if !strings.HasPrefix(r.URL.Path, pr.Prefix+"/") {
-		r.URL.Path = pr.Prefix + r.URL.Path
-	}
-	resp, err := pr.Base.RoundTrip(r)
-	return resp, err
-}
-
 // ctxRoundTripper injects a fixed context into all requests. This is used to
 // provide static OpenCensus tags as Kubernetes' client-go provides no context hooks.
 type ctxRoundTripper struct {
@@ -153,57 +556,223 @@ func (r *ctxRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	return r.base.RoundTrip(req.WithContext(r.ctx))
 }
 
-// Configure HTTP/2 liveness checking on the connection, so that dropouts are
-// noticed and handled appropriately. Errors are ignored, as this is not
-// essential in normal conditions.
+// newDialer returns the dialer for connections to the remote server. It's a
+// variable so tests can inspect the settings.
+var newDialer = func(keepAlive time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: keepAlive,
+	}
+}
+
+// Configure TCP keepalives and HTTP/2 liveness checking on the connection, so
+// that dropouts are noticed and handled appropriately, eg when a NAT drops
+// idle connections. Errors are ignored, as this is not essential in normal
+// conditions.
 func configureTransport(base http.RoundTripper) {
 	t1, ok := base.(*http.Transport)
 	if !ok {
 		log.Printf("failed to configure transport: expected http.Transport, got %T", base)
+		return
 	}
+	t1.DialContext = newDialer(*tcpKeepAlive).DialContext
 	t2, err := http2.ConfigureTransports(t1)
 	if err != nil {
 		log.Printf("failed to enable HTTP/2 on transport: %v", err)
+		return
 	}
-	t2.ReadIdleTimeout = 30 * time.Second
-	t2.PingTimeout = 15 * time.Second
+	t2.ReadIdleTimeout = *http2ReadIdleTimeout
+	t2.PingTimeout = *http2PingTimeout
 	// The transport has been modified in-place, no need to return it.
 }
 
+// readRobotName reads the robot name from file, ignoring surrounding
+// whitespace.
+func readRobotName(file string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// validateFlags checks the flags that are required to start the syncer, so
+// that a missing or malformed value doesn't show up as a confusing error on
+// the first request.
+func validateFlags() error {
+	if *remoteServerFrom != "" {
+		if *remoteServer != "" {
+			return fmt.Errorf("-remote-server and -remote-server-from are mutually exclusive")
+		}
+		if _, err := parseRemoteServerSource(*remoteServerFrom); err != nil {
+			return fmt.Errorf("invalid -remote-server-from: %s", err)
+		}
+	} else if *remoteServer == "" {
+		return fmt.Errorf("-remote-server is required, eg www.endpoints.my-project.cloud.goog")
+	} else if err := validateServer(*remoteServer); err != nil {
+		return fmt.Errorf("invalid -remote-server: %s", err)
+	}
+	if *listPageSize < 0 {
+		return fmt.Errorf("-list-page-size must not be negative")
+	}
+	if *maxSyncConcurrency < 1 {
+		return fmt.Errorf("-max-sync-concurrency must be positive")
+	}
+	if *networkRetryMaxDelay < networkRetryBaseDelay {
+		return fmt.Errorf("-network-retry-max-delay must be at least %s", networkRetryBaseDelay)
+	}
+	if *maxObjectSize < 0 {
+		return fmt.Errorf("-max-object-size must not be negative")
+	}
+	if *initialConcurrency < 0 {
+		return fmt.Errorf("-initial-concurrency must not be negative")
+	}
+	if *kubeAPIQPS < 0 || *kubeAPIBurst < 0 {
+		return fmt.Errorf("-kube-api-qps and -kube-api-burst must not be negative")
+	}
+	if *fieldValidation != "" && !fieldValidationModes[*fieldValidation] {
+		return fmt.Errorf("-field-validation must be Ignore, Warn or Strict, got %q", *fieldValidation)
+	}
+	if *auditFormat != auditFormatJSON && *auditFormat != auditFormatYAML {
+		return fmt.Errorf("-audit-format must be %s or %s, got %q", auditFormatJSON, auditFormatYAML, *auditFormat)
+	}
+	if *maxClockSkew < 0 {
+		return fmt.Errorf("-max-clock-skew must not be negative")
+	}
+	if *traceSampleProbability < 0 || *traceSampleProbability > 1 {
+		return fmt.Errorf("-trace-sample-probability must be between 0 and 1")
+	}
+	if *otlpEndpoint != "" {
+		if u, err := url.Parse(*otlpEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("-otlp-endpoint must be an http or https URL, got %q", *otlpEndpoint)
+		}
+	}
+	if *resyncBatchSize > 0 && *resyncBatchInterval <= 0 {
+		return fmt.Errorf("-resync-batch-interval must be positive if -resync-batch-size is set")
+	}
+	for _, server := range strings.Split(*backupServers, ",") {
+		if server = strings.TrimSpace(server); server == "" {
+			continue
+		}
+		if err := validateServer(server); err != nil {
+			return fmt.Errorf("invalid -backup-servers: %s", err)
+		}
+	}
+	return nil
+}
+
+// validateServer checks that server is a host name or URL that can be used
+// as the host of a REST config.
+func validateServer(server string) error {
+	u := server
+	if !strings.Contains(u, "://") {
+		u = "https://" + u
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("%q has no host", server)
+	}
+	return nil
+}
+
+// Creates the token source for the remote server, replaced in tests.
+var newTokenSource = google.DefaultTokenSource
+
+// parseScopes parses the comma-separated list of OAuth2 scopes.
+func parseScopes(value string) ([]string, error) {
+	var scopes []string
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("no token scopes given")
+	}
+	return scopes, nil
+}
+
 // restConfigForRemote assembles the K8s REST config for the remote server.
 func restConfigForRemote(ctx context.Context) (*rest.Config, error) {
-	tokenSource, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	return restConfigForServer(ctx, *remoteServer, "remote")
+}
+
+// newRemoteClient returns a client for the remote server, which also
+// supports discovery to resolve the remote resources.
+func newRemoteClient(ctx context.Context) (dynamic.Interface, error) {
+	config, err := restConfigForRemote(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applyClientLimits(config)
+	applyFieldValidation(config)
+	return newServerClient(config)
+}
+
+// restConfigForServer assembles the K8s REST config for a server that is
+// accessed like the remote server. Metrics are tagged with location.
+func restConfigForServer(ctx context.Context, server, location string) (*rest.Config, error) {
+	scopes, err := parseScopes(*tokenScopes)
+	if err != nil {
+		return nil, err
+	}
+	tokenSource, err := newTokenSource(ctx, scopes...)
 	if err != nil {
 		return nil, err
 	}
-	ctx, err = tag.New(ctx, tag.Insert(tagLocation, "remote"))
+	ctx, err = tag.New(ctx, tag.Insert(tagLocation, location))
 	if err != nil {
 		return nil, err
 	}
-	transport := func(base http.RoundTripper) (rt http.RoundTripper) {
+	return kubeutils.RemoteConfig(ctx, server, tokenSource,
+		kubeutils.WithVerboseLogging(*verbose),
 		// Configure the transport to better handle dropped connections.
 		// TODO(rodrigoq): remove when updating to client-go kubernetes-1.19.4
-		configureTransport(base)
+		kubeutils.WithBaseTransport(configureTransport),
+		kubeutils.WithTransportWrapper(func(rt http.RoundTripper) http.RoundTripper {
+			return &ochttp.Transport{Base: rt}
+		}),
+	), nil
+}
 
-		rt = &oauth2.Transport{
-			Source: tokenSource,
-			Base:   base,
-		}
-		rt = &PrefixingRoundtripper{
-			Prefix: "/apis/core.kubernetes",
-			Base:   rt,
+// applyClientLimits sets the client-side rate limits of the config from the
+// -kube-api-qps and -kube-api-burst flags, if they are set.
+func applyClientLimits(config *rest.Config) {
+	if *kubeAPIQPS > 0 {
+		config.QPS = float32(*kubeAPIQPS)
+	}
+	if *kubeAPIBurst > 0 {
+		config.Burst = *kubeAPIBurst
+	}
+}
+
+// excludedNamespaces returns the namespaces that are never synced.
+func excludedNamespaces() map[string]bool {
+	namespaces := map[string]bool{}
+	for _, ns := range strings.Split(*excludedNamespacesFlag, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces[ns] = true
 		}
-		if *verbose {
-			rt = &loghttp.Transport{Transport: rt}
+	}
+	return namespaces
+}
+
+// cacheStripPaths returns the field paths that are removed from objects in
+// the informer caches.
+func cacheStripPaths() [][]string {
+	if !*stripCachedFields {
+		return nil
+	}
+	paths := [][]string{{"metadata", "managedFields"}}
+	for _, p := range strings.Split(*extraCacheStripPaths, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, strings.Split(p, "."))
 		}
-		rt = &ochttp.Transport{Base: rt}
-		return &ctxRoundTripper{base: rt, ctx: ctx}
-	}
-	return &rest.Config{
-		Host:          *remoteServer,
-		APIPath:       "/apis",
-		WrapTransport: transport,
-	}, nil
+	}
+	return paths
 }
 
 type CrdChange struct {
@@ -242,6 +811,41 @@ func main() {
 	flag.Parse()
 	ctx := context.Background()
 
+	if *verbose {
+		reconcileObserver = logObserver{}
+	}
+
+	if *robotNameFile != "" {
+		name, err := readRobotName(*robotNameFile)
+		if err != nil {
+			log.Fatalf("Unable to read robot name: %v", err)
+		}
+		*robotName = name
+	}
+	if err := validateFlags(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("cr-syncer version %s (commit %s, %s)", version.Version, version.GitCommit, version.GoVersion())
+	recordBuildInfo()
+	if *otlpEndpoint != "" {
+		eventLog = newOTelLogExporter(strings.TrimSuffix(*otlpEndpoint, "/") + "/v1/logs")
+		// The exporter runs for the lifetime of the process.
+		go eventLog.run(nil)
+		eventLog.emit(ctx, severityInfo, "cr-syncer started", map[string]string{"robot": *robotName})
+	}
+	if *eventSocketPath != "" {
+		var err error
+		if eventStream, err = listenEventSocket(*eventSocketPath); err != nil {
+			log.Fatalf("Failed to listen on event socket: %v", err)
+		}
+	}
+	if *auditFile != "" {
+		var err error
+		if auditLog, err = openAuditLog(*auditFile, parseRedactFields(*auditRedactFields), *auditFormat); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	localConfig, err := rest.InClusterConfig()
 	if err != nil {
 		log.Fatal(err)
@@ -257,18 +861,64 @@ func main() {
 		base = &ochttp.Transport{Base: base}
 		return &ctxRoundTripper{base: base, ctx: localCtx}
 	}
-	local, err := dynamic.NewForConfig(localConfig)
+	applyClientLimits(localConfig)
+	applyFieldValidation(localConfig)
+	local, err := newServerClient(localConfig)
 	if err != nil {
 		log.Fatal(err)
 	}
-	remoteConfig, err := restConfigForRemote(ctx)
-	if err != nil {
-		log.Fatal(err)
+	var serverSource remoteServerSource
+	if *remoteServerFrom != "" {
+		// Validated by validateFlags.
+		serverSource, _ = parseRemoteServerSource(*remoteServerFrom)
+		if *remoteServer, err = serverSource.read(local); err != nil {
+			log.Fatalf("Unable to read remote server: %v", err)
+		}
 	}
-	remote, err := dynamic.NewForConfig(remoteConfig)
+	remote, err := newRemoteClient(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *waitForRemote {
+		if err := waitForRemoteServer(ctx); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *maxClockSkew > 0 {
+		clockSkew = newClockSkewMonitor(
+			func() (time.Duration, error) { return serverTimeOffset(localConfig) },
+			func() (time.Duration, error) {
+				// Assembled on each check, as the remote server may
+				// change with -remote-server-from.
+				config, err := restConfigForRemote(ctx)
+				if err != nil {
+					return 0, err
+				}
+				return serverTimeOffset(config)
+			},
+			*maxClockSkew, *disableTimestampsOnSkew)
+		if _, err := clockSkew.check(); err != nil {
+			log.Printf("Clock skew check failed: %v", err)
+		}
+		go clockSkew.run(clockSkewCheckInterval, ctx.Done())
+	}
+	for _, server := range strings.Split(*backupServers, ",") {
+		if server = strings.TrimSpace(server); server == "" {
+			continue
+		}
+		config, err := restConfigForServer(ctx, server, "backup")
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.Timeout = backupRequestTimeout
+		applyClientLimits(config)
+		applyFieldValidation(config)
+		client, err := dynamic.NewForConfig(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		backupClients = append(backupClients, backupClient{server: server, client: client})
+	}
 
 	exporter, err := prometheus.NewExporter(prometheus.Options{})
 	if err != nil {
@@ -276,44 +926,166 @@ func main() {
 	}
 	view.RegisterExporter(exporter)
 	view.SetReportingPeriod(time.Second)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(*traceSampleProbability)})
+	if *otlpEndpoint != "" {
+		spans := newOTelSpanExporter(strings.TrimSuffix(*otlpEndpoint, "/") + "/v1/traces")
+		trace.RegisterExporter(spans)
+		go spans.run(nil)
+	}
 	zpages.Handle(nil, "/debug")
 	http.Handle("/metrics", exporter)
+	var syncersMu sync.Mutex
+	syncers := make(map[string]*crSyncer)
+	listSyncers := func() []*crSyncer {
+		syncersMu.Lock()
+		defer syncersMu.Unlock()
+		list := make([]*crSyncer, 0, len(syncers))
+		for _, s := range syncers {
+			list = append(list, s)
+		}
+		return list
+	}
+	http.Handle("/healthz", healthzHandler(listSyncers))
 
+	handler := &authHandler{
+		openPaths: map[string]bool{"/healthz": true},
+		base:      http.DefaultServeMux,
+	}
+	if *metricsTokenFile != "" {
+		if handler.token, err = readToken(*metricsTokenFile); err != nil {
+			log.Fatalf("Unable to read metrics token: %v", err)
+		}
+	}
+	server := &http.Server{Addr: *listenAddr, Handler: handler}
+	if *clientCAFile != "" {
+		if *tlsCertFile == "" {
+			log.Fatal("-client-ca-file requires -tls-cert-file")
+		}
+		if server.TLSConfig, err = clientCATLSConfig(*clientCAFile); err != nil {
+			log.Fatalf("Unable to load client CAs: %v", err)
+		}
+		handler.clientCert = true
+	}
 	go func() {
-		if err := http.ListenAndServe(*listenAddr, nil); err != nil {
-			log.Fatalln(err)
+		var err error
+		if *tlsCertFile != "" {
+			err = server.ListenAndServeTLS(*tlsCertFile, *tlsKeyFile)
+		} else {
+			err = server.ListenAndServe()
 		}
+		log.Fatalln(err)
 	}()
 
+	if *migrateCRD != "" {
+		// No syncers are running yet, so the migration can't race with
+		// the sync of the objects.
+		crd, err := crdclientset.NewForConfigOrDie(localConfig).ApiextensionsV1beta1().CustomResourceDefinitions().Get(*migrateCRD, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Unable to get CRD %s for migration: %v", *migrateCRD, err)
+		}
+		if err := migrateSpecSource(*crd, local, remote, *migrationSnapshotDir); err != nil {
+			log.Fatalf("Migrating spec source of %s failed: %v", *migrateCRD, err)
+		}
+	}
+
 	crds := make(chan CrdChange)
 	if err := streamCrds(ctx.Done(), crdclientset.NewForConfigOrDie(localConfig), crds); err != nil {
 		log.Fatalf("Unable to stream CRDs from local Kubernetes: %v", err)
 	}
-	syncers := make(map[string]*crSyncer)
+	http.Handle("/debug/resync", &resyncHandler{
+		lookup: func(crd string) *crSyncer {
+			syncersMu.Lock()
+			defer syncersMu.Unlock()
+			return syncers[crd]
+		},
+	})
+	http.Handle("/debug/drift", &driftHandler{list: listSyncers})
+	if *remoteServerFrom != "" {
+		// The process runs until the CRD stream ends, so the watch
+		// isn't stopped.
+		go serverSource.watch(local, *remoteServer, nil, func(server string) {
+			syncersMu.Lock()
+			defer syncersMu.Unlock()
+			*remoteServer = server
+			client, err := newRemoteClient(ctx)
+			if err != nil {
+				log.Printf("Failed to reconnect to %s: %v", server, err)
+				return
+			}
+			remote = client
+			reconnectSyncers(syncers, local, remote)
+		})
+	}
+	var active string
 	for crd := range crds {
-		name := crd.CRD.GetName()
+		syncersMu.Lock()
+		handleCrdChange(syncers, crd, local, remote)
+		if summary := activeSyncers(syncers); summary != active {
+			log.Printf("Active syncers: %s", summary)
+			active = summary
+		}
+		syncersMu.Unlock()
+	}
+}
 
-		if cur, ok := syncers[name]; ok {
-			if crd.Type == watch.Added {
-				log.Printf("Warning: Already had a running sync for freshly added %s", name)
-			}
-			cur.stop()
-			delete(syncers, name)
+// activeSyncers returns the sorted names of the CRDs that are synced.
+func activeSyncers(syncers map[string]*crSyncer) string {
+	names := make([]string, 0, len(syncers))
+	for name := range syncers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("%d [%s]", len(names), strings.Join(names, ", "))
+}
+
+// handleCrdChange starts, updates or stops the syncer for a changed CRD.
+func handleCrdChange(syncers map[string]*crSyncer, crd CrdChange, local, remote dynamic.Interface) {
+	name := crd.CRD.GetName()
+
+	if cur, ok := syncers[name]; ok {
+		if crd.Type == watch.Modified && canUpdateInPlace(cur.crd, *crd.CRD) {
+			// Only settings changed that don't affect the informers,
+			// so we can keep the cached data.
+			cur.update(*crd.CRD)
+			return
 		}
-		if crd.Type == watch.Added || crd.Type == watch.Modified {
-			// The modify procedure is very heavyweight: We throw away
-			// the informer for the CRD (read: all cached data) on every
-			// modification and recreate it. If that ever turns out to
-			// be a problem, we should use a shared informer cache
-			// instead.
-			s, err := newCRSyncer(*crd.CRD, local, remote, *robotName)
-			if err != nil {
-				log.Printf("skipping custom resource %s: %s", name, err)
-				continue
-			}
-			syncers[name] = s
-			go s.run()
+		if crd.Type == watch.Added {
+			log.Printf("Warning: Already had a running sync for freshly added %s", name)
+		}
+		cur.stop()
+		delete(syncers, name)
+	}
+	if crd.Type == watch.Added || crd.Type == watch.Modified {
+		// The modify procedure is very heavyweight: We throw away
+		// the informer for the CRD (read: all cached data) on every
+		// modification that changes its schema or what is watched,
+		// and recreate it. If that ever turns out to be a problem, we
+		// should use a shared informer cache instead.
+		s, err := newCRSyncer(*crd.CRD, local, remote, *robotName)
+		if err != nil {
+			log.Printf("skipping custom resource %s: %s", name, err)
+			eventLog.emit(context.Background(), severityWarn, "skipping custom resource", map[string]string{
+				"crd":   name,
+				"error": err.Error(),
+			})
+			return
 		}
+		syncers[name] = s
+		go s.run()
+	}
+}
+
+// reconnectSyncers recreates the syncers with a new remote client, eg after
+// the remote server changed.
+func reconnectSyncers(syncers map[string]*crSyncer, local, remote dynamic.Interface) {
+	var crds []crdtypes.CustomResourceDefinition
+	for name, s := range syncers {
+		crds = append(crds, s.crd)
+		s.stop()
+		delete(syncers, name)
+	}
+	for i := range crds {
+		handleCrdChange(syncers, CrdChange{Type: watch.Added, CRD: &crds[i]}, local, remote)
 	}
 }
 
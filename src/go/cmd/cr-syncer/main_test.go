@@ -15,16 +15,25 @@
 package main
 
 import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
 	. "github.com/onsi/gomega"
+	"golang.org/x/oauth2"
 	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	fakecrdclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
+	k8sfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
 )
 
 func TestStreamCrdsSeesPreexistingObject(t *testing.T) {
@@ -136,3 +145,212 @@ func TestStreamCrdsSeesUpdate(t *testing.T) {
 		t.Errorf("Received no watch event; wanted modified for later")
 	}
 }
+
+func TestHandleCrdChangeUpdatesAnnotationsInPlace(t *testing.T) {
+	g := NewGomegaWithT(t)
+	local := k8sfake.NewSimpleDynamicClient(runtime.NewScheme())
+	remote := k8sfake.NewSimpleDynamicClient(runtime.NewScheme())
+	syncers := make(map[string]*crSyncer)
+	defer func() {
+		for _, s := range syncers {
+			s.stop()
+		}
+	}()
+
+	crd := testCRD(crdtypes.NamespaceScoped)
+	handleCrdChange(syncers, CrdChange{Type: watch.Added, CRD: &crd}, local, remote)
+	orig := syncers[crd.Name]
+	g.Expect(orig).NotTo(BeNil())
+	origInf := orig.upstreamInf
+
+	// An annotation-only change keeps the syncer and its informers.
+	annotated := crd.DeepCopy()
+	annotated.Annotations[annotationStatusSubtree] = "robot"
+	handleCrdChange(syncers, CrdChange{Type: watch.Modified, CRD: annotated}, local, remote)
+	g.Expect(syncers[crd.Name]).To(BeIdenticalTo(orig))
+	g.Expect(syncers[crd.Name].upstreamInf).To(BeIdenticalTo(origInf))
+	g.Expect(syncers[crd.Name].subtree).To(Equal("robot"))
+
+	// A schema change recreates the syncer.
+	changed := annotated.DeepCopy()
+	changed.Spec.Version = "v1"
+	handleCrdChange(syncers, CrdChange{Type: watch.Modified, CRD: changed}, local, remote)
+	g.Expect(syncers[crd.Name]).NotTo(BeIdenticalTo(orig))
+}
+
+func TestReadRobotNameFiltersByFileContents(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir, err := ioutil.TempDir("", "robot-name")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "robot-name")
+	g.Expect(ioutil.WriteFile(file, []byte("robot1\n"), 0644)).To(Succeed())
+
+	name, err := readRobotName(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(name).To(Equal("robot1"))
+
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.Annotations[annotationFilterByRobotName] = "true"
+	s, err := newCRSyncer(crd,
+		k8sfake.NewSimpleDynamicClient(runtime.NewScheme()),
+		k8sfake.NewSimpleDynamicClient(runtime.NewScheme()),
+		name)
+	g.Expect(err).NotTo(HaveOccurred())
+	defer s.stop()
+	g.Expect(s.labelSelector).To(Equal(labelRobotName + "=robot1"))
+}
+
+func TestRestConfigForRemotePassesTokenScopes(t *testing.T) {
+	g := NewGomegaWithT(t)
+	defer func(orig string) { *tokenScopes = orig }(*tokenScopes)
+	defer func(orig func(context.Context, ...string) (oauth2.TokenSource, error)) { newTokenSource = orig }(newTokenSource)
+
+	var gotScopes []string
+	newTokenSource = func(_ context.Context, scopes ...string) (oauth2.TokenSource, error) {
+		gotScopes = scopes
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}), nil
+	}
+	*tokenScopes = "https://www.googleapis.com/auth/a, https://www.googleapis.com/auth/b"
+	_, err := restConfigForRemote(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(gotScopes).To(Equal([]string{
+		"https://www.googleapis.com/auth/a",
+		"https://www.googleapis.com/auth/b",
+	}))
+
+	*tokenScopes = " , "
+	_, err = restConfigForRemote(context.Background())
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestValidateFlagsRequiresRemoteServer(t *testing.T) {
+	g := NewGomegaWithT(t)
+	defer func(orig string) { *remoteServer = orig }(*remoteServer)
+
+	*remoteServer = ""
+	err := validateFlags()
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("-remote-server is required"))
+
+	*remoteServer = "https://"
+	g.Expect(validateFlags()).NotTo(Succeed())
+
+	*remoteServer = "www.endpoints.my-project.cloud.goog"
+	g.Expect(validateFlags()).To(Succeed())
+}
+
+func TestValidateFlagsRequiresResyncBatchInterval(t *testing.T) {
+	g := NewGomegaWithT(t)
+	defer func(orig string) { *remoteServer = orig }(*remoteServer)
+	defer func(orig int) { *resyncBatchSize = orig }(*resyncBatchSize)
+	defer func(orig time.Duration) { *resyncBatchInterval = orig }(*resyncBatchInterval)
+
+	*remoteServer = "www.endpoints.my-project.cloud.goog"
+	*resyncBatchSize = 10
+	*resyncBatchInterval = 0
+	g.Expect(validateFlags()).NotTo(Succeed())
+
+	*resyncBatchInterval = time.Second
+	g.Expect(validateFlags()).To(Succeed())
+}
+
+func TestValidateFlagsRequiresHTTPOTLPEndpoint(t *testing.T) {
+	g := NewGomegaWithT(t)
+	defer func(orig string) { *remoteServer = orig }(*remoteServer)
+	defer func(orig string) { *otlpEndpoint = orig }(*otlpEndpoint)
+
+	*remoteServer = "www.endpoints.my-project.cloud.goog"
+	*otlpEndpoint = "otel-collector:4318"
+	g.Expect(validateFlags()).NotTo(Succeed())
+
+	*otlpEndpoint = "http://otel-collector:4318"
+	g.Expect(validateFlags()).To(Succeed())
+}
+
+func TestNewCRSyncerRequiresRobotNameForFilter(t *testing.T) {
+	g := NewGomegaWithT(t)
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.Annotations[annotationFilterByRobotName] = "true"
+	_, err := newCRSyncer(crd,
+		k8sfake.NewSimpleDynamicClient(runtime.NewScheme()),
+		k8sfake.NewSimpleDynamicClient(runtime.NewScheme()),
+		"")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("robot-name"))
+}
+
+func TestConfigSummaryIncludesResolvedConfig(t *testing.T) {
+	g := NewGomegaWithT(t)
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.Annotations[annotationFilterByRobotName] = "true"
+	crd.Annotations[annotationStatusSubtree] = "robots.{robotName}"
+	crd.Annotations[annotationNamespaceMap] = "team-b=robot-team-b,team-a=robot-team-a"
+	s, err := newCRSyncer(crd,
+		k8sfake.NewSimpleDynamicClient(runtime.NewScheme()),
+		k8sfake.NewSimpleDynamicClient(runtime.NewScheme()),
+		"robot1")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer s.stop()
+
+	summary := s.configSummary()
+	g.Expect(summary).To(ContainSubstring(`crd="goals.crds.example.com"`))
+	g.Expect(summary).To(ContainSubstring(`gvr="crds.example.com/v1beta1/goals"`))
+	g.Expect(summary).To(ContainSubstring(`scope="Namespaced"`))
+	g.Expect(summary).To(ContainSubstring(`namespace="default,team-a,team-b"`))
+	g.Expect(summary).To(ContainSubstring(`spec-source="cloud"`))
+	g.Expect(summary).To(ContainSubstring(`status-subtree="robots.robot1"`))
+	g.Expect(summary).To(ContainSubstring(`label-selector="cloudrobotics.com/robot-name=robot1"`))
+	g.Expect(summary).To(ContainSubstring(`namespace-map="team-a=robot-team-a,team-b=robot-team-b"`))
+}
+
+func TestActiveSyncersListsSortedNames(t *testing.T) {
+	g := NewGomegaWithT(t)
+	syncers := map[string]*crSyncer{"b.example.com": nil, "a.example.com": nil}
+	g.Expect(activeSyncers(syncers)).To(Equal("2 [a.example.com, b.example.com]"))
+}
+
+func TestConfigureTransportUsesKeepAliveFlag(t *testing.T) {
+	g := NewGomegaWithT(t)
+	defer func(orig time.Duration) { *tcpKeepAlive = orig }(*tcpKeepAlive)
+	defer func(orig func(time.Duration) *net.Dialer) { newDialer = orig }(newDialer)
+
+	var got time.Duration
+	newDialer = func(keepAlive time.Duration) *net.Dialer {
+		got = keepAlive
+		return &net.Dialer{KeepAlive: keepAlive}
+	}
+	*tcpKeepAlive = 7 * time.Second
+
+	transport := &http.Transport{}
+	configureTransport(transport)
+	g.Expect(got).To(Equal(7 * time.Second))
+	g.Expect(transport.DialContext).NotTo(BeNil())
+}
+
+func TestApplyClientLimits(t *testing.T) {
+	g := NewGomegaWithT(t)
+	defer func(orig float64) { *kubeAPIQPS = orig }(*kubeAPIQPS)
+	defer func(orig int) { *kubeAPIBurst = orig }(*kubeAPIBurst)
+
+	config := &rest.Config{}
+	applyClientLimits(config)
+	g.Expect(config.QPS).To(BeZero())
+	g.Expect(config.Burst).To(BeZero())
+
+	*kubeAPIQPS = 50
+	*kubeAPIBurst = 100
+	applyClientLimits(config)
+	g.Expect(config.QPS).To(Equal(float32(50)))
+	g.Expect(config.Burst).To(Equal(100))
+}
+
+func TestValidateFlagsRejectsNegativeClientLimits(t *testing.T) {
+	g := NewGomegaWithT(t)
+	defer func(orig string) { *remoteServer = orig }(*remoteServer)
+	defer func(orig float64) { *kubeAPIQPS = orig }(*kubeAPIQPS)
+
+	*remoteServer = "www.endpoints.my-project.cloud.goog"
+	*kubeAPIQPS = -1
+	g.Expect(validateFlags()).NotTo(Succeed())
+}
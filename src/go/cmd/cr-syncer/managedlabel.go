@@ -0,0 +1,50 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Label on the downstream objects written by the syncer if
+// -label-managed-objects is set, so that they can be selected with
+// kubectl get -l.
+const labelManaged = "cr-syncer.cloudrobotics.com/managed"
+
+// markManaged sets the managed label on a downstream object that is about to
+// be written. As the labels are copied from the upstream object on every
+// sync, the label is kept in sync.
+func (s *crSyncer) markManaged(o *unstructured.Unstructured) {
+	if !s.labelManaged {
+		return
+	}
+	labels := o.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[labelManaged] = "true"
+	o.SetLabels(labels)
+}
+
+// removeManagedLabel removes the managed label from an object whose labels
+// were copied from a downstream object, so that it isn't echoed upstream.
+func removeManagedLabel(o *unstructured.Unstructured) {
+	labels := o.GetLabels()
+	if _, ok := labels[labelManaged]; !ok {
+		return
+	}
+	delete(labels, labelManaged)
+	o.SetLabels(labels)
+}
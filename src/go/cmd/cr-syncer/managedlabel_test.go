@@ -0,0 +1,74 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSyncUpstream_labelsManagedObjects(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", nil))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.labelManaged = true
+	crs.startInformers()
+
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tcrLocal := newTestCR("resource1", "spec1", nil)
+	tcrLocal.SetLabels(map[string]string{labelManaged: "true"})
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", tcrLocal))
+	f.verifyWriteActions()
+}
+
+func TestSyncDownstream_managedLabelNotCopiedUpstream(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	// The object was handed off to the robot, so its spec and labels are
+	// copied upstream.
+	var (
+		tcrLocal  = newTestCR("resource1", "spec2", "status1")
+		tcrRemote = newTestCR("resource1", "spec1", "status1")
+	)
+	tcrLocal.SetAnnotations(map[string]string{annotationObjectSpecSource: "robot"})
+	tcrLocal.SetLabels(map[string]string{labelManaged: "true", "app": "demo"})
+	tcrRemote.SetAnnotations(map[string]string{annotationObjectSpecSource: "robot"})
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.labelManaged = true
+	crs.startInformers()
+
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	tcrRemoteNew := newTestCR("resource1", "spec2", "status1")
+	tcrRemoteNew.SetAnnotations(map[string]string{annotationObjectSpecSource: "robot"})
+	tcrRemoteNew.SetLabels(map[string]string{"app": "demo"})
+
+	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+	f.verifyWriteActions()
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
+)
+
+// metadataSource lists and watches the metadata of the objects of a
+// resource, if -metadata-only-cache is set. The server then only sends the
+// metadata, instead of the full objects that are stripped on the client.
+type metadataSource struct {
+	client metadata.Getter // nil if the client has no metadata client.
+	gvk    schema.GroupVersionKind
+}
+
+// newMetadataSource returns the metadata source for the resource on the
+// server of the dynamic client.
+func newMetadataSource(c dynamic.Interface, gvr schema.GroupVersionResource, kind string) metadataSource {
+	src := metadataSource{gvk: gvr.GroupVersion().WithKind(kind)}
+	if m, ok := c.(interface{ Metadata() metadata.Interface }); ok && m.Metadata() != nil {
+		src.client = m.Metadata().Resource(gvr)
+	}
+	return src
+}
+
+// usesMetadataSource returns true if the informers list and watch src instead
+// of the full objects.
+func (s *crSyncer) usesMetadataSource(src metadataSource) bool {
+	// The identity index needs the key field from the spec.
+	return s.metadataOnlyCache && src.client != nil && s.keyField == nil
+}
+
+// listMetadata lists the metadata of the objects of src, converted to
+// unstructured objects with only apiVersion, kind and metadata.
+func (s *crSyncer) listMetadata(src metadataSource, options metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	list, err := src.client.Namespace(s.namespace).List(s.listOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.UnstructuredList{}
+	u.SetResourceVersion(list.GetResourceVersion())
+	u.SetContinue(list.GetContinue())
+	for i := range list.Items {
+		o, err := metadataObject(&list.Items[i], src.gvk)
+		if err != nil {
+			return nil, err
+		}
+		u.Items = append(u.Items, *o)
+	}
+	return u, nil
+}
+
+// watchMetadata watches the metadata of the objects of src, converted like
+// by listMetadata.
+func (s *crSyncer) watchMetadata(src metadataSource, options metav1.ListOptions) (watch.Interface, error) {
+	w, err := src.client.Namespace(s.namespace).Watch(options)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+		m, ok := e.Object.(*metav1.PartialObjectMetadata)
+		if !ok {
+			return e, true
+		}
+		o, err := metadataObject(m, src.gvk)
+		if err != nil {
+			log.Printf("Dropping %s event of %s/%s: %s", e.Type, m.GetNamespace(), m.GetName(), err)
+			return e, false
+		}
+		e.Object = o
+		return e, true
+	}), nil
+}
+
+// metadataObject returns the object of the given kind with the metadata m.
+func metadataObject(m *metav1.PartialObjectMetadata, gvk schema.GroupVersionKind) (*unstructured.Unstructured, error) {
+	meta, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&m.ObjectMeta)
+	if err != nil {
+		return nil, err
+	}
+	o := &unstructured.Unstructured{Object: map[string]interface{}{"metadata": meta}}
+	o.SetGroupVersionKind(gvk)
+	unstructured.RemoveNestedField(o.Object, "metadata", "managedFields")
+	return o, nil
+}
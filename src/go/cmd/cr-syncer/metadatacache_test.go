@@ -0,0 +1,86 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func newPartialObjectMetadata(gvk schema.GroupVersionKind, name string) *metav1.PartialObjectMetadata {
+	m := &metav1.PartialObjectMetadata{}
+	m.APIVersion, m.Kind = gvk.ToAPIVersionAndKind()
+	m.SetNamespace("default")
+	m.SetName(name)
+	return m
+}
+
+func TestSync_metadataOnlyCacheListsMetadata(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", "status1"))
+	gvr := f.newClients(crd)
+	gvk := gvr.GroupVersion().WithKind(crd.Spec.Names.Kind)
+
+	scheme := runtime.NewScheme()
+	if err := metav1.AddMetaToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	local := serverClient{Interface: f.local, metadata: metadatafake.NewSimpleMetadataClient(scheme)}
+	remote := serverClient{
+		Interface: f.remote,
+		metadata:  metadatafake.NewSimpleMetadataClient(scheme, newPartialObjectMetadata(gvk, "resource1")),
+	}
+	crs, err := newCRSyncer(crd, local, remote, "cluster1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer crs.stop()
+	crs.instance = ""
+	crs.metadataOnlyCache = true
+	crs.startInformers()
+
+	// The objects aren't listed or watched in full.
+	for _, a := range append(f.local.Actions(), f.remote.Actions()...) {
+		if a.GetResource() == gvr && (a.GetVerb() == "list" || a.GetVerb() == "watch") {
+			t.Errorf("unexpected %s of the full objects", a.GetVerb())
+		}
+	}
+	obj, exists, err := crs.upstreamInf.GetIndexer().GetByKey("default/resource1")
+	if err != nil || !exists {
+		t.Fatalf("resource1 isn't cached: %v", err)
+	}
+	o := obj.(*unstructured.Unstructured)
+	if o.GroupVersionKind() != gvk {
+		t.Errorf("cached object has kind %s, want %s", o.GroupVersionKind(), gvk)
+	}
+	if _, ok := o.Object["spec"]; ok {
+		t.Error("cached object has a spec")
+	}
+
+	// Syncs fetch the full object.
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", newTestCR("resource1", "spec1", "status1")))
+	f.verifyWriteActions()
+}
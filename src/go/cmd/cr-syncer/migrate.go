@@ -0,0 +1,83 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+// migrateSpecSource prepares the objects of a CRD for a change of its
+// spec-source annotation. It must run while no syncer is running for the CRD,
+// so that the two clusters don't fight over the objects during the
+// transition.
+//
+// The migration first writes a snapshot of the objects in both clusters to
+// snapshotDir, then sets the spec-source annotation on all objects to the
+// source given on the CRD. Once it returns, the syncer can be started with
+// the new source.
+func migrateSpecSource(
+	crd crdtypes.CustomResourceDefinition,
+	local, remote dynamic.Interface,
+	snapshotDir string,
+) error {
+	if _, _, err := effectiveSpecSource(crd); err != nil {
+		return err
+	}
+	source := crd.ObjectMeta.Annotations[annotationSpecSource]
+	gvr, ns := crdResource(crd)
+	clusters := []struct {
+		name   string
+		client dynamic.NamespaceableResourceInterface
+	}{
+		{"local", local.Resource(gvr)},
+		{"remote", remote.Resource(gvr)},
+	}
+	for _, c := range clusters {
+		list, err := c.client.Namespace(ns).List(metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list %s in %s cluster: %s", crd.GetName(), c.name, err)
+		}
+		b, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to serialize %s in %s cluster: %s", crd.GetName(), c.name, err)
+		}
+		file := filepath.Join(snapshotDir, fmt.Sprintf("%s-%s.json", crd.GetName(), c.name))
+		if err := ioutil.WriteFile(file, b, 0600); err != nil {
+			return fmt.Errorf("failed to write snapshot: %s", err)
+		}
+		log.Printf("Wrote snapshot of %d %s in %s cluster to %s", len(list.Items), crd.GetName(), c.name, file)
+
+		for i := range list.Items {
+			o := &list.Items[i]
+			if o.GetAnnotations()[annotationObjectSpecSource] == source {
+				continue
+			}
+			setAnnotation(o, annotationObjectSpecSource, source)
+			if _, err := c.client.Namespace(o.GetNamespace()).Update(o, metav1.UpdateOptions{}); err != nil {
+				return newAPIErrorf(o, "failed to set spec source: %s", err)
+			}
+		}
+	}
+	log.Printf("Migrated spec source of %s to %q", crd.GetName(), source)
+	return nil
+}
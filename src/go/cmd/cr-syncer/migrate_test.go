@@ -0,0 +1,79 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMigrateSpecSource(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationSpecSource] = "robot"
+	f := newFixture(t)
+
+	var (
+		tcrLocal  = newTestCR("resource1", "spec1", "status1")
+		tcrRemote = newTestCR("resource1", "spec1", "status1")
+		tcrStale  = newTestCR("resource2", "spec2", "status2")
+	)
+	tcrRemote.SetAnnotations(map[string]string{annotationObjectSpecSource: "cloud"})
+	tcrStale.SetAnnotations(map[string]string{annotationObjectSpecSource: "cloud"})
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote, tcrStale)
+	gvr := f.newClients(crd)
+
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := migrateSpecSource(crd, f.local, f.remote, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"goals.crds.example.com-local.json", "goals.crds.example.com-remote.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("snapshot %s missing: %s", name, err)
+		}
+	}
+	for _, c := range []struct {
+		name  string
+		count int
+	}{{"local", 1}, {"remote", 2}} {
+		client := f.local
+		if c.name == "remote" {
+			client = f.remote
+		}
+		list, err := client.Resource(gvr).Namespace("default").List(metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Items) != c.count {
+			t.Errorf("got %d objects in %s cluster; want %d", len(list.Items), c.name, c.count)
+		}
+		for _, o := range list.Items {
+			if got := o.GetAnnotations()[annotationObjectSpecSource]; got != "robot" {
+				t.Errorf("%s %s has spec source %q; want %q", c.name, o.GetName(), got, "robot")
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// CRD annotation that makes the syncer create missing downstream
+	// namespaces before creating objects in them. Objects outside of the
+	// default namespace are only synced with a namespace-map, so it
+	// requires one to create other namespaces.
+	annotationCreateNamespace = "cr-syncer.cloudrobotics.com/create-namespace"
+	// CRD annotation with a comma-separated list of label keys that are
+	// copied from the upstream namespace to created namespaces.
+	annotationCreateNamespaceLabels = "cr-syncer.cloudrobotics.com/create-namespace-labels"
+	// Label set on namespaces created by the syncer, so that they can be
+	// found and cleaned up.
+	labelCreatedNamespace = "cr-syncer.cloudrobotics.com/created-namespace"
+)
+
+var namespacesResource = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// namespaceCreator creates missing downstream namespaces and remembers the
+// ones known to exist, so that they aren't looked up for every object. A
+// namespace is forgotten when writing to it fails because it's gone.
+type namespaceCreator struct {
+	upstream   dynamic.ResourceInterface
+	downstream dynamic.ResourceInterface
+
+	mu       sync.Mutex
+	existing map[string]bool
+	// Namespaces created by this syncer.
+	created map[string]bool
+}
+
+func newNamespaceCreator(upstream, downstream dynamic.ResourceInterface) *namespaceCreator {
+	return &namespaceCreator{
+		upstream:   upstream,
+		downstream: downstream,
+		existing:   make(map[string]bool),
+		created:    make(map[string]bool),
+	}
+}
+
+// parseLabelKeys parses a comma-separated list of label keys.
+func parseLabelKeys(value string) []string {
+	var keys []string
+	for _, k := range strings.Split(value, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// createdNamespaces returns the namespaces created by this syncer.
+func (c *namespaceCreator) createdNamespaces() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for ns := range c.created {
+		names = append(names, ns)
+	}
+	return names
+}
+
+// ensure creates the downstream namespace ns if it doesn't exist. The labels
+// with the given keys are copied from the upstream namespace srcNs.
+func (c *namespaceCreator) ensure(srcNs, ns string, labelKeys []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.existing[ns] {
+		return nil
+	}
+	if _, err := c.downstream.Get(ns, metav1.GetOptions{}); err == nil {
+		c.existing[ns] = true
+		return nil
+	} else if !isNotFoundError(err) {
+		return fmt.Errorf("failed to get namespace %s: %s", ns, err)
+	}
+
+	labels := map[string]string{labelCreatedNamespace: "true"}
+	if len(labelKeys) > 0 {
+		src, err := c.upstream.Get(srcNs, metav1.GetOptions{})
+		if err != nil && !isNotFoundError(err) {
+			return fmt.Errorf("failed to get upstream namespace %s: %s", srcNs, err)
+		}
+		if err == nil {
+			for _, k := range labelKeys {
+				if v, ok := src.GetLabels()[k]; ok {
+					labels[k] = v
+				}
+			}
+		}
+	}
+	o := &unstructured.Unstructured{}
+	o.SetAPIVersion("v1")
+	o.SetKind("Namespace")
+	o.SetName(ns)
+	o.SetLabels(labels)
+	if _, err := c.downstream.Create(o, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create namespace %s: %s", ns, err)
+	}
+	c.existing[ns] = true
+	c.created[ns] = true
+	return nil
+}
+
+// forget drops the namespace ns from the known ones, eg after it was deleted,
+// so that the next ensure creates it again.
+func (c *namespaceCreator) forget(ns string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.existing, ns)
+}
+
+// ensureNamespace creates the namespace of the downstream object before it is
+// created, if the CRD asks for it.
+func (s *crSyncer) ensureNamespace(src *unstructured.Unstructured, downstreamNs string) error {
+	if !s.createNamespace || downstreamNs == "" {
+		return nil
+	}
+	return s.namespaces.ensure(src.GetNamespace(), downstreamNs, s.createNamespaceLabels)
+}
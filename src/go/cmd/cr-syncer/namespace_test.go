@@ -0,0 +1,145 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func newTestNamespace(name string, labels map[string]string) *unstructured.Unstructured {
+	o := &unstructured.Unstructured{}
+	o.SetAPIVersion("v1")
+	o.SetKind("Namespace")
+	o.SetName(name)
+	o.SetLabels(labels)
+	return o
+}
+
+func TestSyncUpstream_createsMissingNamespace(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationCreateNamespace] = "true"
+	crd.ObjectMeta.Annotations[annotationCreateNamespaceLabels] = "team"
+	// Without a namespace map, only the default namespace is synced.
+	crd.ObjectMeta.Annotations[annotationNamespaceMap] = "team-a=team-a"
+	f := newFixture(t)
+
+	tcrRemote := newTestCR("resource1", "spec1", nil)
+	tcrRemote.SetNamespace("team-a")
+	f.addRemoteObjects(
+		tcrRemote,
+		newTestNamespace("team-a", map[string]string{"team": "a", "billing": "x"}),
+	)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("team-a/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tcrLocal := newTestCR("resource1", "spec1", nil)
+	tcrLocal.SetNamespace("team-a")
+	f.expectLocalActions(
+		k8stest.NewRootCreateAction(namespacesResource, newTestNamespace("team-a", map[string]string{
+			labelCreatedNamespace: "true",
+			"team":                "a",
+		})),
+		k8stest.NewCreateAction(gvr, "team-a", tcrLocal),
+	)
+	f.verifyWriteActions()
+
+	if got, want := crs.namespaces.createdNamespaces(), []string{"team-a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("created namespaces = %v, want %v", got, want)
+	}
+}
+
+func TestSyncUpstream_keepsExistingNamespace(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationCreateNamespace] = "true"
+	f := newFixture(t)
+
+	f.addRemoteObjects(newTestCR("resource1", "spec1", nil))
+	f.addLocalObjects(newTestNamespace("default", nil))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", newTestCR("resource1", "spec1", nil)))
+	f.verifyWriteActions()
+
+	if got := crs.namespaces.createdNamespaces(); len(got) != 0 {
+		t.Errorf("created namespaces = %v, want none", got)
+	}
+}
+
+func TestSyncUpstream_recreatesDeletedNamespace(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationCreateNamespace] = "true"
+	crd.ObjectMeta.Annotations[annotationNamespaceMap] = "team-a=team-a"
+	f := newFixture(t)
+
+	for _, name := range []string{"resource1", "resource2"} {
+		tcrRemote := newTestCR(name, "spec1", nil)
+		tcrRemote.SetNamespace("team-a")
+		f.addRemoteObjects(tcrRemote)
+	}
+	f.addLocalObjects(newTestNamespace("team-a", nil))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("team-a/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The namespace is deleted after it was checked. The fake client
+	// doesn't reject objects in missing namespaces, so fail the create.
+	if err := f.local.Resource(namespacesResource).Delete("team-a", &metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	failed := false
+	f.local.PrependReactor("create", gvr.Resource, func(k8stest.Action) (bool, runtime.Object, error) {
+		if failed {
+			return false, nil, nil
+		}
+		failed = true
+		return true, nil, apierrors.NewNotFound(namespacesResource.GroupResource(), "team-a")
+	})
+	if err := crs.syncUpstream("team-a/resource2"); err == nil {
+		t.Fatal("syncUpstream() succeeded in a deleted namespace")
+	}
+	if err := crs.syncUpstream("team-a/resource2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.local.Resource(namespacesResource).Get("team-a", metav1.GetOptions{}); err != nil {
+		t.Errorf("namespace wasn't created again: %s", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Initial delay before retrying a sync that failed with a network error.
+const networkRetryBaseDelay = 50 * time.Millisecond
+
+var (
+	mNetworkErrors = stats.Int64(
+		"cr-syncer.cloudrobotics.com/network_errors",
+		"Synchronizations that failed with a network error",
+		stats.UnitDimensionless,
+	)
+	mAPIErrors = stats.Int64(
+		"cr-syncer.cloudrobotics.com/api_errors",
+		"Synchronizations that failed with an error other than a network error",
+		stats.UnitDimensionless,
+	)
+)
+
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "cr-syncer.cloudrobotics.com/network_errors_total",
+			Description: "Total number of synchronizations that failed with a network error",
+			Measure:     mNetworkErrors,
+			TagKeys:     []tag.Key{tagEventSource, tagResource},
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "cr-syncer.cloudrobotics.com/api_errors_total",
+			Description: "Total number of synchronizations that failed with an error other than a network error",
+			Measure:     mAPIErrors,
+			TagKeys:     []tag.Key{tagEventSource, tagResource},
+			Aggregation: view.Count(),
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// Messages of network errors. The sync functions wrap errors in their
+// messages, so they can only be recognized by their text.
+var networkErrorMessages = []string{
+	"connection reset by peer",
+	"connection refused",
+	"broken pipe",
+	"no such host",
+	"i/o timeout",
+	"network is unreachable",
+	"TLS handshake timeout",
+	"http2: client connection lost",
+	"unexpected EOF",
+}
+
+// isNetworkError returns true if the error was caused by the connection to
+// the API server, eg a connection reset on a flaky robot link, rather than
+// by the API server rejecting the request.
+func isNetworkError(err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	msg := err.Error()
+	for _, m := range networkErrorMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// newNetworkRetryLimiter returns the rate limiter for syncs that failed with
+// a network error. Network blips are usually short, so they are retried
+// sooner and more often than API errors, which back off to avoid hammering
+// a degraded API server.
+func newNetworkRetryLimiter(maxDelay time.Duration) workqueue.RateLimiter {
+	return workqueue.NewItemExponentialFailureRateLimiter(networkRetryBaseDelay, maxDelay)
+}
+
+// retryNetworkError requeues the key of a sync that failed with a network
+// error according to the network retry limiter.
+func (s *crSyncer) retryNetworkError(ctx context.Context, q workqueue.RateLimitingInterface, key interface{}, qName string) {
+	stats.Record(ctx, mNetworkErrors.M(1))
+	// The API backoff starts over once the network recovers.
+	q.Forget(key)
+	q.AddAfter(key, s.networkRetry.When(qName+"/"+key.(string)))
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stest "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// syncErrorCount returns the number of sync errors of the CRD counted by the
+// view.
+func syncErrorCount(t *testing.T, name string, crd crdtypes.CustomResourceDefinition) int64 {
+	rows, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	for _, r := range rows {
+		for _, tg := range r.Tags {
+			if tg.Key == tagResource && tg.Value == crd.GetName() {
+				n += r.Data.(*view.CountData).Value
+			}
+		}
+	}
+	return n
+}
+
+func TestIsNetworkError(t *testing.T) {
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{reset, true},
+		{fmt.Errorf("failed to create or update downstream: %s", reset), true},
+		{errors.New(`Get "https://example.com": dial tcp: lookup example.com: no such host`), true},
+		{errors.New("update status failed: the object has been modified"), false},
+		{errors.New("admission webhook denied the request"), false},
+	} {
+		if got := isNetworkError(tc.err); got != tc.want {
+			t.Errorf("isNetworkError(%q) = %t, want %t", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestProcessNextWorkItem_retriesNetworkErrorsSooner(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", "status1"))
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+
+	f.local.PrependReactor("create", "*", func(k8stest.Action) (bool, runtime.Object, error) {
+		return true, nil, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	})
+	networkBefore := syncErrorCount(t, "cr-syncer.cloudrobotics.com/network_errors_total", crd)
+	apiBefore := syncErrorCount(t, "cr-syncer.cloudrobotics.com/api_errors_total", crd)
+
+	// Use a separate queue, as the informers fill the syncer's queues.
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	q.Add("default/resource1")
+	// The error counts are tagged with the resource from the context, as in run().
+	ctx, err := tag.New(context.Background(), tag.Insert(tagResource, crd.GetName()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crs.processNextWorkItem(ctx, q, crs.reconcileUpstream, "upstream")
+
+	// The key is retried by the network retry limiter instead of the
+	// queue's rate limiter.
+	if n := q.NumRequeues("default/resource1"); n != 0 {
+		t.Errorf("got %d rate-limited requeues, want 0", n)
+	}
+	if n := crs.networkRetry.NumRequeues("upstream/default/resource1"); n != 1 {
+		t.Errorf("got %d network retries, want 1", n)
+	}
+	if got := syncErrorCount(t, "cr-syncer.cloudrobotics.com/network_errors_total", crd) - networkBefore; got != 1 {
+		t.Errorf("got %d network errors, want 1", got)
+	}
+	if got := syncErrorCount(t, "cr-syncer.cloudrobotics.com/api_errors_total", crd) - apiBefore; got != 0 {
+		t.Errorf("got %d API errors, want 0", got)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for q.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the retry")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "log"
+
+// Result describes what a reconcile did to the target object.
+type Result string
+
+const (
+	ResultUnchanged Result = "unchanged"
+	ResultCreated   Result = "created"
+	ResultUpdated   Result = "updated"
+	ResultDeleted   Result = "deleted"
+	ResultFailed    Result = "failed"
+)
+
+// ReconcileObserver is notified after each reconcile of an object from the
+// work queues. direction is "upstream" or "downstream" and tells which
+// cluster the change event came from.
+type ReconcileObserver interface {
+	OnReconcile(key, direction string, result Result, err error)
+}
+
+// Observer for the syncers created by newCRSyncer.
+var reconcileObserver ReconcileObserver = nopObserver{}
+
+type nopObserver struct{}
+
+func (nopObserver) OnReconcile(string, string, Result, error) {}
+
+// logObserver logs the results of all reconciles.
+type logObserver struct{}
+
+func (logObserver) OnReconcile(key, direction string, result Result, err error) {
+	if err != nil {
+		log.Printf("Reconciled %s from %s: %s (%v)", key, direction, result, err)
+		return
+	}
+	log.Printf("Reconciled %s from %s: %s", key, direction, result)
+}
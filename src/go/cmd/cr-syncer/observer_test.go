@@ -0,0 +1,181 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opencensus.io/trace"
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stest "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/workqueue"
+)
+
+type reconcileCall struct {
+	key, direction string
+	result         Result
+	err            error
+}
+
+type recordingObserver struct {
+	calls []reconcileCall
+}
+
+func (o *recordingObserver) OnReconcile(key, direction string, result Result, err error) {
+	o.calls = append(o.calls, reconcileCall{key, direction, result, err})
+}
+
+func TestReconcileObserver(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(
+		newTestCR("resource1", "spec1", "status1"),
+		newTestCR("resource2", "spec2", "status2"),
+	)
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	observer := &recordingObserver{}
+	crs.observer = observer
+	crs.startInformers()
+
+	// Use a separate queue, as the informers fill the syncer's queues.
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+
+	q.Add("default/resource1")
+	crs.processNextWorkItem(context.Background(), q, crs.reconcileUpstream, "upstream")
+
+	createErr := errors.New("create failed")
+	f.local.PrependReactor("create", "*", func(k8stest.Action) (bool, runtime.Object, error) {
+		return true, nil, createErr
+	})
+	q.Add("default/resource2")
+	crs.processNextWorkItem(context.Background(), q, crs.reconcileUpstream, "upstream")
+
+	if len(observer.calls) != 2 {
+		t.Fatalf("got %d calls, want 2: %v", len(observer.calls), observer.calls)
+	}
+	if got, want := observer.calls[0], (reconcileCall{"default/resource1", "upstream", ResultCreated, nil}); got != want {
+		t.Errorf("first call = %v, want %v", got, want)
+	}
+	if got := observer.calls[1]; got.key != "default/resource2" || got.direction != "upstream" || got.result != ResultFailed || got.err == nil {
+		t.Errorf("second call = %v, want failed upstream reconcile of default/resource2", got)
+	}
+}
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *trace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func TestProcessNextWorkItem_tracesSync(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", "status1"))
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+
+	recorder := &spanRecorder{}
+	trace.RegisterExporter(recorder)
+	defer trace.UnregisterExporter(recorder)
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	q.Add("default/resource1")
+	ctx, span := trace.StartSpan(context.Background(), "test", trace.WithSampler(trace.AlwaysSample()))
+	crs.processNextWorkItem(ctx, q, crs.reconcileUpstream, "upstream")
+	span.End()
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	var found bool
+	for _, s := range recorder.spans {
+		if s.Name != "cr-syncer/sync/upstream" {
+			continue
+		}
+		found = true
+		if s.ParentSpanID != span.SpanContext().SpanID {
+			t.Errorf("sync span has parent %v, want %v", s.ParentSpanID, span.SpanContext().SpanID)
+		}
+		if got := s.Attributes["key"]; got != "default/resource1" {
+			t.Errorf("key attribute = %v, want default/resource1", got)
+		}
+		if got := s.Attributes["result"]; got != string(ResultCreated) {
+			t.Errorf("result attribute = %v, want %s", got, ResultCreated)
+		}
+	}
+	if !found {
+		t.Errorf("no span for the sync, got %v", recorder.spans)
+	}
+}
+
+func TestProcessNextWorkItem_setsProfilerLabels(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	q.Add("default/resource1")
+
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		crs.processNextWorkItem(context.Background(), q, func(context.Context, string) (Result, error) {
+			close(started)
+			<-release
+			return ResultUnchanged, nil
+		}, "upstream")
+	}()
+	<-started
+
+	// The goroutine profile lists the labels of the reconciling goroutine.
+	var buf bytes.Buffer
+	err := pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	close(release)
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "# labels:") &&
+			strings.Contains(line, `"crd":"goals.crds.example.com"`) &&
+			strings.Contains(line, `"direction":"upstream"`) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no goroutine with crd and direction labels in profile:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+// CRD annotation that makes the syncer process the objects of the CRD one at
+// a time, in the order of their creation timestamps.
+const annotationOrdered = "cr-syncer.cloudrobotics.com/ordered"
+
+// creationOrder returns the priority of the object with the given key in
+// the informer cache, such that a priorityQueue hands out older objects
+// first. Objects created in the same second are handed out in the order they
+// were added. Keys of objects that are no longer in the cache come first, so
+// that deletions are not held back.
+func creationOrder(inf cache.SharedIndexInformer, key interface{}) int {
+	if inf == nil {
+		return 0
+	}
+	obj, exists, err := inf.GetIndexer().GetByKey(key.(string))
+	if err != nil || !exists {
+		return 0
+	}
+	created := obj.(*unstructured.Unstructured).GetCreationTimestamp()
+	return -int(created.Unix())
+}
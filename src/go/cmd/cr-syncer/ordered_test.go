@@ -0,0 +1,73 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestOrdered_processesObjectsByCreationTime(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationOrdered] = "true"
+	f := newFixture(t)
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	if crs.workers != 1 || crs.initialWorkers != 1 {
+		t.Errorf("got %d workers and %d initial workers, want 1 and 1", crs.workers, crs.initialWorkers)
+	}
+	now := time.Now()
+	created := map[string]time.Time{
+		"second": now.Add(-time.Minute),
+		"third":  now,
+		"first":  now.Add(-time.Hour),
+	}
+	for _, name := range []string{"third", "first", "second"} {
+		cr := newTestCR(name, "spec", "")
+		cr.SetCreationTimestamp(metav1.NewTime(created[name]))
+		if err := crs.upstreamInf.GetIndexer().Add(cr); err != nil {
+			t.Fatal(err)
+		}
+		crs.upstreamQueue.Add("default/" + name)
+	}
+
+	for _, want := range []string{"default/first", "default/second", "default/third"} {
+		item, quit := crs.upstreamQueue.Get()
+		if quit {
+			t.Fatal("unexpected quit")
+		}
+		if item != want {
+			t.Errorf("Get() = %v, want %s", item, want)
+		}
+		crs.upstreamQueue.Done(item)
+	}
+}
+
+func TestOrdered_rejectsPriorityQueue(t *testing.T) {
+	defer func(orig bool) { *enablePriorityQueue = orig }(*enablePriorityQueue)
+	*enablePriorityQueue = true
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationOrdered] = "true"
+	f := newFixture(t)
+	f.newClients(crd)
+
+	if _, err := newCRSyncer(crd, f.local, f.remote, "cluster1"); err == nil {
+		t.Error("newCRSyncer succeeded with ordered and -enable-priority-queue")
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+const (
+	// Maximum number of records sent in a single export request.
+	otelLogBatchSize = 512
+	// Records that can't be buffered are dropped, as exporting them must
+	// not slow down syncing.
+	otelLogBufferSize = 4096
+	otelLogInterval   = time.Second
+
+	severityInfo = "INFO"
+	severityWarn = "WARN"
+)
+
+// eventLog exports structured records of lifecycle events, nil if
+// -otlp-endpoint isn't set.
+var eventLog *otelLogExporter
+
+// logRecord is a structured log record of a lifecycle event.
+type logRecord struct {
+	Time       time.Time
+	Severity   string
+	Body       string
+	Attributes map[string]string
+	// Hex-encoded IDs of the span the event happened in, if any.
+	TraceID string
+	SpanID  string
+}
+
+// otelLogExporter sends log records to an OpenTelemetry collector using
+// OTLP/HTTP with JSON encoding.
+type otelLogExporter struct {
+	endpoint string
+	client   *http.Client
+	records  chan logRecord
+}
+
+func newOTelLogExporter(endpoint string) *otelLogExporter {
+	return &otelLogExporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		records:  make(chan logRecord, otelLogBufferSize),
+	}
+}
+
+// emit queues a record for export. The trace and span IDs are taken from
+// the span in ctx, so that the record can be correlated with the trace.
+func (e *otelLogExporter) emit(ctx context.Context, severity, body string, attrs map[string]string) {
+	if e == nil {
+		return
+	}
+	r := logRecord{
+		Time:       time.Now(),
+		Severity:   severity,
+		Body:       body,
+		Attributes: attrs,
+	}
+	if span := trace.FromContext(ctx); span != nil {
+		sc := span.SpanContext()
+		r.TraceID = sc.TraceID.String()
+		r.SpanID = sc.SpanID.String()
+	}
+	select {
+	case e.records <- r:
+	default:
+	}
+}
+
+// run exports the queued records in batches until done is closed.
+func (e *otelLogExporter) run(done <-chan struct{}) {
+	ticker := time.NewTicker(otelLogInterval)
+	defer ticker.Stop()
+	var batch []logRecord
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			log.Printf("Failed to export %d log records: %s", len(batch), err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case r := <-e.records:
+			batch = append(batch, r)
+			if len(batch) >= otelLogBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-done:
+			flush()
+			return
+		}
+	}
+}
+
+// export sends the records to the collector.
+func (e *otelLogExporter) export(records []logRecord) error {
+	body, err := json.Marshal(otlpLogsRequest(records))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// otlpLogsRequest returns the OTLP/JSON ExportLogsServiceRequest for the
+// records.
+func otlpLogsRequest(records []logRecord) map[string]interface{} {
+	logRecords := make([]interface{}, 0, len(records))
+	for _, r := range records {
+		keys := make([]string, 0, len(r.Attributes))
+		for k := range r.Attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		attrs := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			attrs = append(attrs, otlpAttribute(k, r.Attributes[k]))
+		}
+		lr := map[string]interface{}{
+			"timeUnixNano":   strconv.FormatInt(r.Time.UnixNano(), 10),
+			"severityNumber": otlpSeverityNumber(r.Severity),
+			"severityText":   r.Severity,
+			"body":           map[string]interface{}{"stringValue": r.Body},
+			"attributes":     attrs,
+		}
+		if r.TraceID != "" {
+			lr["traceId"] = r.TraceID
+			lr["spanId"] = r.SpanID
+		}
+		logRecords = append(logRecords, lr)
+	}
+	return map[string]interface{}{
+		"resourceLogs": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []interface{}{otlpAttribute("service.name", "cr-syncer")},
+				},
+				"scopeLogs": []interface{}{
+					map[string]interface{}{
+						"scope":      map[string]interface{}{"name": "cr-syncer"},
+						"logRecords": logRecords,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpAttribute(key, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"key":   key,
+		"value": map[string]interface{}{"stringValue": value},
+	}
+}
+
+// otlpSeverityNumber maps the severity text to the OTLP severity number.
+func otlpSeverityNumber(severity string) int {
+	switch severity {
+	case severityWarn:
+		return 13
+	default:
+		return 9
+	}
+}
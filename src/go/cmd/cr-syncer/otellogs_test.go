@@ -0,0 +1,137 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestProcessNextWorkItem_emitsLogRecord(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", nil))
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.eventLog = newOTelLogExporter("")
+	crs.startInformers()
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	q.Add("default/resource1")
+	crs.processNextWorkItem(context.Background(), q, crs.reconcileUpstream, "upstream")
+
+	var r logRecord
+	select {
+	case r = <-crs.eventLog.records:
+	default:
+		t.Fatal("no log record emitted")
+	}
+	if r.Body != "reconciled" || r.Severity != severityInfo {
+		t.Errorf("got %s record %q, want %s record %q", r.Severity, r.Body, severityInfo, "reconciled")
+	}
+	want := map[string]string{
+		"crd":       crd.GetName(),
+		"key":       "default/resource1",
+		"direction": "upstream",
+		"result":    string(ResultCreated),
+	}
+	if !reflect.DeepEqual(r.Attributes, want) {
+		t.Errorf("got attributes %v, want %v", r.Attributes, want)
+	}
+	if r.TraceID == "" || r.SpanID == "" {
+		t.Errorf("record isn't correlated with the trace: %+v", r)
+	}
+}
+
+func TestProcessNextWorkItem_noLogRecordForNoop(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.eventLog = newOTelLogExporter("")
+	crs.startInformers()
+
+	// The object exists in neither cluster, so there's nothing to sync.
+	if result, err := crs.reconcileUpstream(context.Background(), "default/resource1"); err != nil || result != ResultUnchanged {
+		t.Fatalf("reconcileUpstream() = %s, %v, want %s", result, err, ResultUnchanged)
+	}
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	q.Add("default/resource1")
+	crs.processNextWorkItem(context.Background(), q, crs.reconcileUpstream, "upstream")
+
+	select {
+	case r := <-crs.eventLog.records:
+		t.Errorf("got log record %q for a no-op sync", r.Body)
+	default:
+	}
+}
+
+func TestOTelLogExporterExport(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("invalid request body %q: %s", body, err)
+		}
+	}))
+	defer server.Close()
+
+	e := newOTelLogExporter(server.URL)
+	err := e.export([]logRecord{{
+		Time:       time.Unix(1, 0),
+		Severity:   severityWarn,
+		Body:       "reconcile failed",
+		Attributes: map[string]string{"crd": "goals.crds.example.com"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := got["resourceLogs"].([]interface{})[0].(map[string]interface{})["scopeLogs"].([]interface{})[0].(map[string]interface{})["logRecords"].([]interface{})
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	want := map[string]interface{}{
+		"timeUnixNano":   "1000000000",
+		"severityNumber": float64(13),
+		"severityText":   "WARN",
+		"body":           map[string]interface{}{"stringValue": "reconcile failed"},
+		"attributes": []interface{}{
+			map[string]interface{}{
+				"key":   "crd",
+				"value": map[string]interface{}{"stringValue": "goals.crds.example.com"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(records[0], want) {
+		t.Errorf("got record %v, want %v", records[0], want)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+const (
+	// Maximum number of spans sent in a single export request.
+	otelSpanBatchSize = 512
+	// Spans that can't be buffered are dropped, as exporting them must
+	// not slow down syncing.
+	otelSpanBufferSize = 4096
+	otelSpanInterval   = time.Second
+)
+
+// otelSpanExporter sends sampled spans to an OpenTelemetry collector using
+// OTLP/HTTP with JSON encoding.
+type otelSpanExporter struct {
+	endpoint string
+	client   *http.Client
+	spans    chan *trace.SpanData
+}
+
+func newOTelSpanExporter(endpoint string) *otelSpanExporter {
+	return &otelSpanExporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		spans:    make(chan *trace.SpanData, otelSpanBufferSize),
+	}
+}
+
+// ExportSpan implements trace.Exporter by queueing the span for export.
+func (e *otelSpanExporter) ExportSpan(s *trace.SpanData) {
+	select {
+	case e.spans <- s:
+	default:
+	}
+}
+
+// run exports the queued spans in batches until done is closed.
+func (e *otelSpanExporter) run(done <-chan struct{}) {
+	ticker := time.NewTicker(otelSpanInterval)
+	defer ticker.Stop()
+	var batch []*trace.SpanData
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			log.Printf("Failed to export %d spans: %s", len(batch), err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case s := <-e.spans:
+			batch = append(batch, s)
+			if len(batch) >= otelSpanBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-done:
+			flush()
+			return
+		}
+	}
+}
+
+// export sends the spans to the collector.
+func (e *otelSpanExporter) export(spans []*trace.SpanData) error {
+	body, err := json.Marshal(otlpTracesRequest(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// otlpTracesRequest returns the OTLP/JSON ExportTraceServiceRequest for the
+// spans.
+func otlpTracesRequest(spans []*trace.SpanData) map[string]interface{} {
+	otlpSpans := make([]interface{}, 0, len(spans))
+	for _, s := range spans {
+		keys := make([]string, 0, len(s.Attributes))
+		for k := range s.Attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		attrs := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			attrs = append(attrs, otlpAttribute(k, fmt.Sprint(s.Attributes[k])))
+		}
+		status := map[string]interface{}{}
+		if s.Status.Code != trace.StatusCodeOK {
+			// STATUS_CODE_ERROR
+			status["code"] = 2
+			status["message"] = s.Status.Message
+		}
+		span := map[string]interface{}{
+			"traceId":           s.TraceID.String(),
+			"spanId":            s.SpanID.String(),
+			"name":              s.Name,
+			"kind":              1, // SPAN_KIND_INTERNAL
+			"startTimeUnixNano": strconv.FormatInt(s.StartTime.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+			"attributes":        attrs,
+			"status":            status,
+		}
+		if s.ParentSpanID != (trace.SpanID{}) {
+			span["parentSpanId"] = s.ParentSpanID.String()
+		}
+		otlpSpans = append(otlpSpans, span)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []interface{}{otlpAttribute("service.name", "cr-syncer")},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "cr-syncer"},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+func TestOTelSpanExporterExport(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("invalid request body %q: %s", body, err)
+		}
+	}))
+	defer server.Close()
+
+	e := newOTelSpanExporter(server.URL)
+	err := e.export([]*trace.SpanData{{
+		SpanContext: trace.SpanContext{
+			TraceID: trace.TraceID{1},
+			SpanID:  trace.SpanID{2},
+		},
+		ParentSpanID: trace.SpanID{3},
+		Name:         "cr-syncer/sync/upstream",
+		StartTime:    time.Unix(1, 0),
+		EndTime:      time.Unix(2, 0),
+		Attributes:   map[string]interface{}{"key": "default/resource1"},
+		Status:       trace.Status{Code: trace.StatusCodeUnknown, Message: "update failed"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := got["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	want := map[string]interface{}{
+		"traceId":           "01000000000000000000000000000000",
+		"spanId":            "0200000000000000",
+		"parentSpanId":      "0300000000000000",
+		"name":              "cr-syncer/sync/upstream",
+		"kind":              float64(1),
+		"startTimeUnixNano": "1000000000",
+		"endTimeUnixNano":   "2000000000",
+		"attributes": []interface{}{
+			map[string]interface{}{
+				"key":   "key",
+				"value": map[string]interface{}{"stringValue": "default/resource1"},
+			},
+		},
+		"status": map[string]interface{}{"code": float64(2), "message": "update failed"},
+	}
+	if !reflect.DeepEqual(spans[0], want) {
+		t.Errorf("got span %v, want %v", spans[0], want)
+	}
+}
+
+func TestOTelSpanExporter_dropsWhenFull(t *testing.T) {
+	e := newOTelSpanExporter("")
+	for i := 0; i < otelSpanBufferSize+1; i++ {
+		e.ExportSpan(&trace.SpanData{})
+	}
+	if n := len(e.spans); n != otelSpanBufferSize {
+		t.Errorf("got %d buffered spans, want %d", n, otelSpanBufferSize)
+	}
+}
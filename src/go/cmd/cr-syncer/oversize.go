@@ -0,0 +1,118 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// Annotation on upstream objects whose sync was skipped because the
+	// written object would exceed -max-object-size.
+	annotationOversized = "cr-syncer.cloudrobotics.com/oversized"
+
+	// The default request size limit of etcd.
+	defaultMaxObjectSize = 1536 * 1024
+)
+
+var mOversizedObjects = stats.Int64(
+	"cr-syncer.cloudrobotics.com/oversized_objects",
+	"Writes skipped because the object exceeds the maximum size",
+	stats.UnitDimensionless,
+)
+
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "cr_syncer_oversized_objects_total",
+			Description: "Total number of writes skipped because the object exceeds the maximum size",
+			Measure:     mOversizedObjects,
+			TagKeys:     []tag.Key{tagResource},
+			Aggregation: view.Count(),
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// checkObjectSize returns an error if o serializes to more than
+// s.maxObjectSize bytes. etcd rejects such objects with an error that
+// doesn't name the object, and every retry would fail the same way.
+func (s *crSyncer) checkObjectSize(o *unstructured.Unstructured) error {
+	if s.maxObjectSize <= 0 {
+		return nil
+	}
+	data, err := json.Marshal(o.Object)
+	if err != nil {
+		return err
+	}
+	if size := int64(len(data)); size > s.maxObjectSize {
+		return fmt.Errorf("object size %d bytes exceeds the limit of %d bytes", size, s.maxObjectSize)
+	}
+	return nil
+}
+
+// skipOversized logs and counts a write of o that was skipped because of
+// sizeErr and records it on the upstream object upstream.
+func (s *crSyncer) skipOversized(key string, o, upstream *unstructured.Unstructured, sizeErr error) {
+	log.Printf("Skipping sync of %s %s/%s: %s", o.GetKind(), o.GetNamespace(), o.GetName(), sizeErr)
+	ctx, err := tag.New(context.Background(), tag.Insert(tagResource, s.crd.GetName()))
+	if err != nil {
+		panic(err)
+	}
+	stats.Record(ctx, mOversizedObjects.M(1))
+	s.setOversized(key, upstream, sizeErr.Error())
+}
+
+// setOversized records msg in the oversized annotation of the upstream
+// object o, or removes it if msg is empty. The object is only written if
+// the annotation changes.
+func (s *crSyncer) setOversized(key string, o *unstructured.Unstructured, msg string) {
+	if o.GetAnnotations()[annotationOversized] == msg {
+		return
+	}
+	var value interface{} // Removes the annotation.
+	if msg != "" {
+		value = msg
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				annotationOversized: value,
+			},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	updated, err := s.upstream.Namespace(o.GetNamespace()).Patch(o.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		if !isNotFoundError(err) {
+			log.Printf("Failed to record oversized object %s: %s", key, err)
+		}
+		return
+	}
+	s.recordSelfWrite(key, updated.GetResourceVersion())
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opencensus.io/stats/view"
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// oversizedObjects returns the number of writes of the CRD's objects that
+// were skipped because of their size.
+func oversizedObjects(t *testing.T, crd crdtypes.CustomResourceDefinition) int64 {
+	rows, err := view.RetrieveData("cr_syncer_oversized_objects_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rows {
+		for _, tg := range r.Tags {
+			if tg.Key == tagResource && tg.Value == crd.GetName() {
+				return r.Data.(*view.CountData).Value
+			}
+		}
+	}
+	return 0
+}
+
+func TestSyncUpstream_skipsOversizedObject(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(newTestCR("resource1", strings.Repeat("x", 1000), nil))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.maxObjectSize = 512
+	crs.startInformers()
+	before := oversizedObjects(t, crd)
+
+	result, err := crs.reconcileUpstream(context.Background(), "default/resource1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != ResultUnchanged {
+		t.Errorf("got result %s, want %s", result, ResultUnchanged)
+	}
+	if hasWrite(f.local.Actions()) {
+		t.Error("oversized object was written downstream")
+	}
+	if got := oversizedObjects(t, crd) - before; got != 1 {
+		t.Errorf("got %d oversized objects, want 1", got)
+	}
+	o, err := f.remote.Resource(gvr).Namespace("default").Get("resource1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := o.GetAnnotations()[annotationOversized]; !strings.Contains(got, "exceeds the limit of 512 bytes") {
+		t.Errorf("got %s annotation %q, want the size limit", annotationOversized, got)
+	}
+}
+
+func TestSyncDownstream_skipsOversizedStatus(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	tcrLocal := newTestCR("resource1", "spec1", strings.Repeat("x", 1000))
+	tcrLocal.SetResourceVersion("123")
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", "status1"))
+
+	crs, gvr := f.newCRSyncer(crd, "")
+	defer crs.stop()
+	crs.maxObjectSize = 512
+	crs.startInformers()
+
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	// Only the annotation is written, not the status.
+	for _, a := range filterReadActions(f.remote.Actions()) {
+		if a.GetVerb() != "patch" {
+			t.Errorf("got upstream write %v, want only the annotation patch", a)
+		}
+	}
+	o, err := f.remote.Resource(gvr).Namespace("default").Get("resource1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.GetAnnotations()[annotationOversized] == "" {
+		t.Errorf("resource1 has no %s annotation", annotationOversized)
+	}
+}
+
+func TestSyncUpstream_clearsOversized(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	tcrRemote := newTestCR("resource1", "spec1", nil)
+	tcrRemote.SetAnnotations(map[string]string{annotationOversized: "too large"})
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if !hasWrite(f.local.Actions()) {
+		t.Error("resource1 wasn't created downstream")
+	}
+	o, err := f.remote.Resource(gvr).Namespace("default").Get("resource1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := o.GetAnnotations()[annotationOversized]; ok {
+		t.Errorf("resource1 still has %s annotation %q", annotationOversized, got)
+	}
+}
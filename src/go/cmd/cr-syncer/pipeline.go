@@ -0,0 +1,113 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// transformer changes the downstream object dst before reconcileUpstream
+// writes it. src is the upstream object that dst was built from, and old is
+// dst before the change, or nil if dst is created. Neither src nor old must
+// be changed.
+type transformer interface {
+	transform(src, old, dst *unstructured.Unstructured) error
+}
+
+// transformerFunc adapts a function to a transformer.
+type transformerFunc func(src, old, dst *unstructured.Unstructured) error
+
+func (f transformerFunc) transform(src, old, dst *unstructured.Unstructured) error {
+	return f(src, old, dst)
+}
+
+// namedTransformer is a step of a pipeline. The name is used in errors.
+type namedTransformer struct {
+	name string
+	transformer
+}
+
+// pipeline applies transformers in order, each seeing the changes of the
+// previous ones.
+type pipeline []namedTransformer
+
+// then returns a pipeline with t appended as its last step.
+func (p pipeline) then(name string, t transformer) pipeline {
+	return append(p[:len(p):len(p)], namedTransformer{name: name, transformer: t})
+}
+
+func (p pipeline) transform(src, old, dst *unstructured.Unstructured) error {
+	for _, t := range p {
+		if err := t.transform(src, old, dst); err != nil {
+			return fmt.Errorf("%s: %s", t.name, err)
+		}
+	}
+	return nil
+}
+
+// specPipeline returns the transformers that build every object written
+// downstream from its upstream counterpart, in order. The configuration is
+// read when an object is transformed, so that CRD updates take effect.
+func (s *crSyncer) specPipeline() pipeline {
+	return pipeline{}.
+		then("labels", transformerFunc(func(src, _, dst *unstructured.Unstructured) error {
+			dst.SetLabels(src.GetLabels())
+			return nil
+		})).
+		then("annotations", transformerFunc(func(src, _, dst *unstructured.Unstructured) error {
+			copyAnnotations(src, dst)
+			// The remote-resource-version annotation is removed from
+			// dst to prevent an infinite loop, because changing the
+			// annotation would change the resource version.
+			deleteAnnotation(dst, annotationResourceVersion)
+			return nil
+		})).
+		then("spec", transformerFunc(func(src, _, dst *unstructured.Unstructured) error {
+			if s.specSubtree == "" {
+				copySpec(src, dst)
+			}
+			return nil
+		})).
+		then("spec-subtree", transformerFunc(func(src, _, dst *unstructured.Unstructured) error {
+			if s.specSubtree == "" {
+				return nil
+			}
+			return s.copySpecSubtree(src, dst)
+		})).
+		then("create-defaults", transformerFunc(s.applyCreateDefaults)).
+		then("namespace-map", transformerFunc(func(src, _, dst *unstructured.Unstructured) error {
+			if ns := src.GetNamespace(); ns != "" {
+				dst.SetNamespace(s.downstreamNamespace(ns))
+			}
+			return nil
+		})).
+		then("synced-by", transformerFunc(func(_, _, dst *unstructured.Unstructured) error {
+			s.markSyncedBy(dst)
+			return nil
+		})).
+		then("owned-by-upstream", transformerFunc(func(_, _, dst *unstructured.Unstructured) error {
+			s.markOwnedByUpstream(dst)
+			return nil
+		})).
+		then("managed-label", transformerFunc(func(_, _, dst *unstructured.Unstructured) error {
+			s.markManaged(dst)
+			return nil
+		})).
+		then("spec-checksum", transformerFunc(func(src, _, dst *unstructured.Unstructured) error {
+			return s.addSpecChecksum(src, dst)
+		}))
+}
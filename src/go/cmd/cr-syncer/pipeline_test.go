@@ -0,0 +1,129 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stest "k8s.io/client-go/testing"
+)
+
+// appendLabel returns a transformer that appends v to the "order" label.
+func appendLabel(v string) transformer {
+	return transformerFunc(func(_, _, dst *unstructured.Unstructured) error {
+		labels := dst.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels["order"] += v
+		dst.SetLabels(labels)
+		return nil
+	})
+}
+
+func TestPipelineAppliesInOrder(t *testing.T) {
+	p := pipeline{}.then("first", appendLabel("a")).then("second", appendLabel("b"))
+	dst := newTestCR("resource1", "spec1", nil)
+	if err := p.transform(newTestCR("resource1", "spec1", nil), nil, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := dst.GetLabels()["order"]; got != "ab" {
+		t.Errorf("got order %q, want %q", got, "ab")
+	}
+}
+
+func TestPipelineStopsAtError(t *testing.T) {
+	p := pipeline{}.
+		then("failing", transformerFunc(func(_, _, _ *unstructured.Unstructured) error {
+			return errors.New("boom")
+		})).
+		then("never", appendLabel("x"))
+	dst := newTestCR("resource1", "spec1", nil)
+	err := p.transform(newTestCR("resource1", "spec1", nil), nil, dst)
+	if err == nil || err.Error() != "failing: boom" {
+		t.Errorf("got error %v, want %q", err, "failing: boom")
+	}
+	if _, ok := dst.GetLabels()["order"]; ok {
+		t.Error("transformer after the failing one was applied")
+	}
+}
+
+func TestPipelineThenDoesNotShareSteps(t *testing.T) {
+	base := make(pipeline, 0, 4).then("a", appendLabel("a"))
+	p1 := base.then("b", appendLabel("b"))
+	p2 := base.then("c", appendLabel("c"))
+	if !reflect.DeepEqual([]string{p1[1].name, p2[1].name}, []string{"b", "c"}) {
+		t.Errorf("pipelines share steps: %v, %v", p1[1].name, p2[1].name)
+	}
+}
+
+func TestSyncUpstream_appliesPipeline(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", nil))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.pipeline = crs.pipeline.then("first", appendLabel("a")).then("second", appendLabel("b"))
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tcrLocal := newTestCR("resource1", "spec1", nil)
+	tcrLocal.SetLabels(map[string]string{"order": "ab"})
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", tcrLocal))
+	f.verifyWriteActions()
+}
+
+func TestSpecPipelineStages(t *testing.T) {
+	crs := &crSyncer{}
+	var got []string
+	for _, step := range crs.specPipeline() {
+		got = append(got, step.name)
+	}
+	want := []string{"labels", "annotations", "spec", "spec-subtree", "create-defaults", "namespace-map", "synced-by", "owned-by-upstream", "managed-label", "spec-checksum"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("specPipeline() stages = %v, want %v", got, want)
+	}
+}
+
+func TestApplyCreateDefaults(t *testing.T) {
+	crs := &crSyncer{createDefaults: map[string]interface{}{"replicas": int64(1)}}
+	src := newTestCR("resource1", map[string]interface{}{"image": "a"}, nil)
+
+	created := newTestCR("resource1", map[string]interface{}{"image": "a"}, nil)
+	if err := crs.applyCreateDefaults(src, nil, created); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"image": "a", "replicas": int64(1)}; !reflect.DeepEqual(created.Object["spec"], want) {
+		t.Errorf("created spec = %v, want %v", created.Object["spec"], want)
+	}
+
+	// Updates keep the value a downstream controller set.
+	old := newTestCR("resource1", map[string]interface{}{"image": "a", "replicas": int64(3)}, nil)
+	updated := newTestCR("resource1", map[string]interface{}{"image": "b"}, nil)
+	if err := crs.applyCreateDefaults(src, old, updated); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"image": "b", "replicas": int64(3)}; !reflect.DeepEqual(updated.Object["spec"], want) {
+		t.Errorf("updated spec = %v, want %v", updated.Object["spec"], want)
+	}
+}
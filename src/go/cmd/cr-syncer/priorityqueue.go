@@ -0,0 +1,217 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"container/heap"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Annotation on CRs that sets their priority in the work queues if
+// -enable-priority-queue is set. Higher values are synced first, the default
+// is 0.
+const annotationPriority = "cr-syncer.cloudrobotics.com/priority"
+
+// priorityQueue is a rate-limiting work queue that hands out items with
+// higher priority first, and items of the same priority in the order they
+// were added. Like the client-go work queues, it guarantees that an item is
+// only processed by one worker at a time.
+type priorityQueue struct {
+	priority    func(item interface{}) int
+	rateLimiter workqueue.RateLimiter
+
+	cond         *sync.Cond
+	queue        priorityHeap
+	dirty        map[interface{}]bool // Items that need processing.
+	processing   map[interface{}]bool // Items that are being processed.
+	seq          uint64
+	shuttingDown bool
+}
+
+var _ workqueue.RateLimitingInterface = &priorityQueue{}
+
+func newPriorityQueue(priority func(item interface{}) int, rateLimiter workqueue.RateLimiter) *priorityQueue {
+	return &priorityQueue{
+		priority:    priority,
+		rateLimiter: rateLimiter,
+		cond:        sync.NewCond(&sync.Mutex{}),
+		dirty:       make(map[interface{}]bool),
+		processing:  make(map[interface{}]bool),
+	}
+}
+
+// push must be called with the lock held.
+func (q *priorityQueue) push(item interface{}, priority int) {
+	q.seq++
+	heap.Push(&q.queue, priorityItem{item: item, priority: priority, seq: q.seq})
+	q.cond.Signal()
+}
+
+func (q *priorityQueue) Add(item interface{}) {
+	// Determine the priority outside of the lock, as it may look up the
+	// object in an informer cache.
+	priority := q.priority(item)
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.shuttingDown || q.dirty[item] {
+		return
+	}
+	q.dirty[item] = true
+	if q.processing[item] {
+		// Re-added by Done() once processing finished.
+		return
+	}
+	q.push(item, priority)
+}
+
+func (q *priorityQueue) Len() int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.queue.Len()
+}
+
+func (q *priorityQueue) Get() (interface{}, bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	for q.queue.Len() == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if q.queue.Len() == 0 {
+		return nil, true
+	}
+	item := heap.Pop(&q.queue).(priorityItem).item
+	q.processing[item] = true
+	delete(q.dirty, item)
+	return item, false
+}
+
+func (q *priorityQueue) Done(item interface{}) {
+	priority := q.priority(item)
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	delete(q.processing, item)
+	if q.dirty[item] {
+		q.push(item, priority)
+	}
+}
+
+func (q *priorityQueue) ShutDown() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.shuttingDown = true
+	q.cond.Broadcast()
+}
+
+func (q *priorityQueue) ShuttingDown() bool {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.shuttingDown
+}
+
+func (q *priorityQueue) AddAfter(item interface{}, duration time.Duration) {
+	if duration <= 0 {
+		q.Add(item)
+		return
+	}
+	time.AfterFunc(duration, func() { q.Add(item) })
+}
+
+func (q *priorityQueue) AddRateLimited(item interface{}) {
+	q.AddAfter(item, q.rateLimiter.When(item))
+}
+
+func (q *priorityQueue) Forget(item interface{}) {
+	q.rateLimiter.Forget(item)
+}
+
+func (q *priorityQueue) NumRequeues(item interface{}) int {
+	return q.rateLimiter.NumRequeues(item)
+}
+
+type priorityItem struct {
+	item     interface{}
+	priority int
+	seq      uint64
+}
+
+// priorityHeap implements heap.Interface.
+type priorityHeap []priorityItem
+
+func (h priorityHeap) Len() int { return len(h) }
+
+func (h priorityHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h priorityHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *priorityHeap) Push(x interface{}) { *h = append(*h, x.(priorityItem)) }
+
+func (h *priorityHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// objectPriority returns the priority of the object with the given key in
+// the informer cache.
+func objectPriority(inf cache.SharedIndexInformer, key interface{}) int {
+	if inf == nil {
+		return 0
+	}
+	obj, exists, err := inf.GetIndexer().GetByKey(key.(string))
+	if err != nil || !exists {
+		return 0
+	}
+	value := obj.(*unstructured.Unstructured).GetAnnotations()[annotationPriority]
+	if value == "" {
+		return 0
+	}
+	p, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Value for %s must be an integer on %s, got %q", annotationPriority, key, value)
+		return 0
+	}
+	return p
+}
+
+// newWorkqueue creates the work queue for the objects in the given
+// informer, which is evaluated lazily as it is created after the queue. If
+// ordered is set, the queue hands out objects in creation order.
+func newWorkqueue(name string, ordered bool, inf func() cache.SharedIndexInformer) workqueue.RateLimitingInterface {
+	switch {
+	case ordered:
+		return newPriorityQueue(func(item interface{}) int {
+			return creationOrder(inf(), item)
+		}, workqueue.DefaultControllerRateLimiter())
+	case *enablePriorityQueue:
+		return newPriorityQueue(func(item interface{}) int {
+			return objectPriority(inf(), item)
+		}, workqueue.DefaultControllerRateLimiter())
+	}
+	return workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), name)
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestPriorityQueue_dequeuesHighPriorityFirst(t *testing.T) {
+	priorities := map[string]int{"default/urgent": 10}
+	q := newPriorityQueue(func(item interface{}) int {
+		return priorities[item.(string)]
+	}, workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+
+	q.Add("default/normal1")
+	q.Add("default/normal2")
+	q.Add("default/urgent")
+	// Duplicates are ignored.
+	q.Add("default/normal1")
+
+	want := []string{"default/urgent", "default/normal1", "default/normal2"}
+	if n := q.Len(); n != len(want) {
+		t.Errorf("Len() = %d, want %d", n, len(want))
+	}
+	for _, w := range want {
+		item, quit := q.Get()
+		if quit {
+			t.Fatal("unexpected quit")
+		}
+		if item != w {
+			t.Errorf("Get() = %v, want %s", item, w)
+		}
+		q.Done(item)
+	}
+}
+
+func TestPriorityQueue_requeuesItemAddedWhileProcessing(t *testing.T) {
+	q := newPriorityQueue(func(interface{}) int { return 0 }, workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+
+	q.Add("default/cr1")
+	item, _ := q.Get()
+	q.Add("default/cr1")
+	if n := q.Len(); n != 0 {
+		t.Errorf("Len() = %d while processing, want 0", n)
+	}
+	q.Done(item)
+	if n := q.Len(); n != 1 {
+		t.Errorf("Len() = %d after Done(), want 1", n)
+	}
+}
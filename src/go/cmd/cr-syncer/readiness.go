@@ -0,0 +1,112 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// Interval at which the readiness of syncers is reported, so that it's
+// current even if no objects change.
+const readinessInterval = 15 * time.Second
+
+var (
+	mCRDReady = stats.Int64(
+		"cr-syncer.cloudrobotics.com/crd_ready",
+		"1 if the informers of the CRD's syncer are synced and healthy, 0 otherwise",
+		stats.UnitDimensionless,
+	)
+	mLastSuccess = stats.Float64(
+		"cr-syncer.cloudrobotics.com/last_success_timestamp",
+		"Unix time of the last successful reconcile of the CRD",
+		"s",
+	)
+	tagCRD = mustNewTagKey("crd")
+)
+
+func init() {
+	// The names follow the kube-state-metrics conventions, so that fleet
+	// dashboards can use them along with the Kubernetes object metrics.
+	if err := view.Register(
+		&view.View{
+			Name:        "cr_syncer_crd_ready",
+			Description: "1 if the informers of the CRD's syncer are synced and healthy, 0 otherwise",
+			Measure:     mCRDReady,
+			TagKeys:     []tag.Key{tagCRD},
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "cr_syncer_crd_last_success_timestamp_seconds",
+			Description: "Unix time of the last successful reconcile of the CRD",
+			Measure:     mLastSuccess,
+			TagKeys:     []tag.Key{tagCRD},
+			Aggregation: view.LastValue(),
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+func (s *crSyncer) crdContext() context.Context {
+	ctx, err := tag.New(context.Background(), tag.Insert(tagCRD, s.crd.GetName()))
+	if err != nil {
+		panic(err)
+	}
+	return ctx
+}
+
+// informersSynced returns true if both informers have completed their
+// initial list.
+func (s *crSyncer) informersSynced() bool {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.upstreamInf != nil && s.upstreamInf.HasSynced() &&
+		s.downstreamInf != nil && s.downstreamInf.HasSynced()
+}
+
+// recordReadiness records whether the syncer is ready.
+func (s *crSyncer) recordReadiness() {
+	var ready int64
+	if s.informersSynced() && s.healthy() {
+		ready = 1
+	}
+	stats.Record(s.crdContext(), mCRDReady.M(ready))
+}
+
+// reportReadiness records the readiness of the syncer periodically until
+// it's stopped, and then records it as not ready.
+func (s *crSyncer) reportReadiness() {
+	ticker := time.NewTicker(readinessInterval)
+	defer ticker.Stop()
+	for {
+		s.recordReadiness()
+		select {
+		case <-s.done:
+			stats.Record(s.crdContext(), mCRDReady.M(0))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordSuccess records the time of a successful reconcile.
+func (s *crSyncer) recordSuccess(t time.Time) {
+	stats.Record(s.crdContext(), mLastSuccess.M(float64(t.UnixNano())/float64(time.Second)))
+}
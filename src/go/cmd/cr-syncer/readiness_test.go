@@ -0,0 +1,82 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// crdGauge returns the last value of the view for the CRD, or -1 if it has
+// none.
+func crdGauge(t *testing.T, name string, crd crdtypes.CustomResourceDefinition) float64 {
+	rows, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rows {
+		for _, tg := range r.Tags {
+			if tg.Key == tagCRD && tg.Value == crd.GetName() {
+				return r.Data.(*view.LastValueData).Value
+			}
+		}
+	}
+	return -1
+}
+
+func TestProcessNextWorkItem_recordsLastSuccess(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", nil))
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+
+	// Start from a known timestamp in the past.
+	crs.recordSuccess(time.Unix(1, 0))
+	start := time.Now()
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	q.Add("default/resource1")
+	crs.processNextWorkItem(context.Background(), q, crs.reconcileUpstream, "upstream")
+
+	got := crdGauge(t, "cr_syncer_crd_last_success_timestamp_seconds", crd)
+	if want := float64(start.Unix()); got < want {
+		t.Errorf("last success timestamp = %v after reconcile, want >= %v", got, want)
+	}
+}
+
+func TestRecordReadiness(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.recordReadiness()
+	if got := crdGauge(t, "cr_syncer_crd_ready", crd); got != 0 {
+		t.Errorf("ready = %v before the informers synced, want 0", got)
+	}
+	crs.startInformers()
+	crs.recordReadiness()
+	if got := crdGauge(t, "cr_syncer_crd_ready", crd); got != 1 {
+		t.Errorf("ready = %v after the informers synced, want 1", got)
+	}
+}
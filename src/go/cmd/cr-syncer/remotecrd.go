@@ -0,0 +1,97 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// Interval between checks whether a missing remote CRD was created.
+	remoteCRDCheckInterval = 30 * time.Second
+	// Minimum interval between warnings about a missing remote CRD.
+	remoteCRDWarnInterval = 10 * time.Minute
+)
+
+var mRemoteCRDMissing = stats.Int64(
+	"cr-syncer.cloudrobotics.com/remote_crd_missing",
+	"Checks that found the CRD missing in the remote cluster",
+	stats.UnitDimensionless,
+)
+
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "cr-syncer.cloudrobotics.com/remote_crd_missing_total",
+			Description: "Total number of checks that found the CRD missing in the remote cluster",
+			Measure:     mRemoteCRDMissing,
+			TagKeys:     []tag.Key{tagResource},
+			Aggregation: view.Count(),
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// remoteCRDExists returns false if the CRD is known to be missing in the
+// remote cluster. The resource is looked up through discovery if the remote
+// client supports it, else the CRD is read. If neither works, eg for lack of
+// permissions, the CRD is assumed to exist.
+func (s *crSyncer) remoteCRDExists() bool {
+	gv := schema.GroupVersion{Group: s.remoteGroup, Version: s.crd.Spec.Version}
+	if plural, ok, err := remotePlural(s.remoteClient, gv, s.crd.Spec.Names.Kind); ok && err == nil {
+		return plural != ""
+	}
+	remoteCRD, err := getRemoteCRD(s.remoteClient, s.remoteCRDName)
+	if err != nil {
+		return true
+	}
+	return remoteCRD != nil
+}
+
+// waitForRemoteCRD blocks until the CRD exists in the remote cluster, so
+// that a syncer for a cluster that is provisioned out of order doesn't fail
+// every sync. It returns false if the syncer was stopped while waiting.
+func (s *crSyncer) waitForRemoteCRD() bool {
+	ctx, err := tag.New(context.Background(), tag.Insert(tagResource, s.crd.GetName()))
+	if err != nil {
+		panic(err)
+	}
+	var warned time.Time
+	for !s.remoteCRDExists() {
+		stats.Record(ctx, mRemoteCRDMissing.M(1))
+		if time.Since(warned) >= remoteCRDWarnInterval {
+			log.Printf("Warning: CRD for %s in group %s is missing in the remote cluster, deferring sync until it exists",
+				s.crd.Spec.Names.Kind, s.remoteGroup)
+			warned = time.Now()
+		}
+		select {
+		case <-s.done:
+			return false
+		case <-time.After(s.remoteCRDRecheck):
+		}
+	}
+	if !warned.IsZero() {
+		log.Printf("CRD for %s appeared in the remote cluster, starting sync", s.crd.Spec.Names.Kind)
+	}
+	return true
+}
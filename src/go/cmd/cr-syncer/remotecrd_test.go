@@ -0,0 +1,85 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stest "k8s.io/client-go/testing"
+)
+
+// listedResource returns true if the resource was listed in the cluster.
+func listedResource(actions []k8stest.Action, gvr schema.GroupVersionResource) bool {
+	for _, a := range actions {
+		if a.GetVerb() == "list" && a.GetResource() == gvr {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteCRDMissingChecks returns the number of checks that found a remote
+// CRD missing.
+func remoteCRDMissingChecks(t *testing.T) int64 {
+	rows, err := view.RetrieveData("cr-syncer.cloudrobotics.com/remote_crd_missing_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	for _, r := range rows {
+		n += r.Data.(*view.CountData).Value
+	}
+	return n
+}
+
+func TestCRSyncer_defersSyncUntilRemoteCRDExists(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", nil))
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.remoteCRDRecheck = 10 * time.Millisecond
+	before := remoteCRDMissingChecks(t)
+
+	go crs.run()
+
+	// The syncer keeps checking for the CRD without starting informers.
+	deadline := time.Now().Add(10 * time.Second)
+	for remoteCRDMissingChecks(t) < before+3 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for checks of the remote CRD")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if listedResource(f.remote.Actions(), gvr) || listedResource(f.local.Actions(), gvr) {
+		t.Fatal("informers started before the remote CRD exists")
+	}
+
+	// Once the CRD is created, the sync starts.
+	if _, err := f.remote.Resource(crdGVR).Create(crdObject(t, crd), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for !listedResource(f.remote.Actions(), gvr) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the sync to start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+// CRD annotation with the API group of the CRD in the remote cluster, if it
+// differs from the local one. The CRDs must be structurally identical.
+const annotationRemoteGroup = "cr-syncer.cloudrobotics.com/remote-group"
+
+// remotePlural returns the resource name of the kind in the given group
+// version of the remote cluster, or "" if it isn't served. The remote CRD may
+// have been defined independently with a different plural, so the resource
+// is resolved through discovery by group and kind. ok is false if the client
+// doesn't support discovery.
+func remotePlural(remote dynamic.Interface, gv schema.GroupVersion, kind string) (plural string, ok bool, err error) {
+	c, ok := remote.(interface {
+		Discovery() discovery.DiscoveryInterface
+	})
+	if !ok || c.Discovery() == nil {
+		return "", false, nil
+	}
+	list, err := c.Discovery().ServerResourcesForGroupVersion(gv.String())
+	if err != nil {
+		if isNotFoundError(err) {
+			return "", true, nil
+		}
+		return "", true, fmt.Errorf("failed to discover resources of %s: %s", gv, err)
+	}
+	for _, r := range list.APIResources {
+		// Subresources, eg goals/status, have the kind of their parent.
+		if r.Kind == kind && !strings.Contains(r.Name, "/") {
+			return r.Name, true, nil
+		}
+	}
+	return "", true, nil
+}
+
+// getRemoteCRD returns the CRD with the given name in the remote cluster, or
+// nil if it doesn't exist.
+func getRemoteCRD(remote dynamic.Interface, name string) (*crdtypes.CustomResourceDefinition, error) {
+	u, err := remote.Resource(crdGVR).Get(name, metav1.GetOptions{})
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get remote CRD %s: %s", name, err)
+	}
+	var crd crdtypes.CustomResourceDefinition
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &crd); err != nil {
+		return nil, fmt.Errorf("failed to parse remote CRD %s: %s", name, err)
+	}
+	return &crd, nil
+}
+
+// crdSchema returns the schema of the given version of the CRD, or nil if
+// it has none.
+func crdSchema(crd crdtypes.CustomResourceDefinition, version string) *crdtypes.CustomResourceValidation {
+	schema := crd.Spec.Validation
+	for _, v := range crd.Spec.Versions {
+		if v.Name == version && v.Schema != nil {
+			schema = v.Schema
+		}
+	}
+	return schema
+}
+
+// checkRemoteCRD checks that the CRD in the remote cluster is compatible
+// with the local CRD, so that objects can be synced between them.
+func checkRemoteCRD(crd, remoteCRD crdtypes.CustomResourceDefinition) error {
+	name := remoteCRD.GetName()
+	if remoteCRD.Spec.Names.Kind != crd.Spec.Names.Kind {
+		return fmt.Errorf("remote CRD %s has kind %s, want %s", name, remoteCRD.Spec.Names.Kind, crd.Spec.Names.Kind)
+	}
+	if remoteCRD.Spec.Scope != crd.Spec.Scope {
+		return fmt.Errorf("remote CRD %s has scope %s, want %s", name, remoteCRD.Spec.Scope, crd.Spec.Scope)
+	}
+	served := remoteCRD.Spec.Version == crd.Spec.Version
+	for _, v := range remoteCRD.Spec.Versions {
+		served = served || (v.Name == crd.Spec.Version && v.Served)
+	}
+	if !served {
+		return fmt.Errorf("remote CRD %s doesn't serve version %s", name, crd.Spec.Version)
+	}
+	if !reflect.DeepEqual(crdSchema(remoteCRD, crd.Spec.Version), crdSchema(crd, crd.Spec.Version)) {
+		return fmt.Errorf("remote CRD %s has a different schema", name)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
+	k8stest "k8s.io/client-go/testing"
+)
+
+const testRemoteGroup = "crds.example.org"
+
+// remoteGroupCRD returns the test CRD as it's named in the remote cluster.
+func remoteGroupCRD() crdtypes.CustomResourceDefinition {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Name = "goals." + testRemoteGroup
+	crd.Spec.Group = testRemoteGroup
+	return crd
+}
+
+func newRemoteGroupTestCR(name string, spec, status interface{}) *unstructured.Unstructured {
+	o := newTestCR(name, spec, status)
+	o.SetAPIVersion(testRemoteGroup + "/v1beta1")
+	return o
+}
+
+func TestSyncUpstream_remoteGroup(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationRemoteGroup] = testRemoteGroup
+	f := newFixture(t)
+
+	f.addRemoteObjects(crdObject(t, remoteGroupCRD()), newRemoteGroupTestCR("resource1", "spec1", "status1"))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The downstream copy is created in the local group.
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", newTestCR("resource1", "spec1", "status1")))
+	f.verifyWriteActions()
+}
+
+func TestSyncDownstream_remoteGroup(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationRemoteGroup] = testRemoteGroup
+	f := newFixture(t)
+
+	tcrLocal := newTestCR("resource1", "spec1", "status2")
+	tcrLocal.SetResourceVersion("123")
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(crdObject(t, remoteGroupCRD()), newRemoteGroupTestCR("resource1", "spec1", "status1"))
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tcrRemoteNew := newRemoteGroupTestCR("resource1", "spec1", "status2")
+	tcrRemoteNew.SetAnnotations(map[string]string{
+		annotationResourceVersion: "123",
+	})
+	remoteGVR := schema.GroupVersionResource{Group: testRemoteGroup, Version: "v1beta1", Resource: "goals"}
+	f.expectRemoteActions(k8stest.NewUpdateAction(remoteGVR, "default", tcrRemoteNew))
+	f.verifyWriteActions()
+}
+
+func TestNewCRSyncer_remoteGroupSchemaMismatch(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationRemoteGroup] = testRemoteGroup
+	remote := remoteGroupCRD()
+	remote.Spec.Validation = &crdtypes.CustomResourceValidation{
+		OpenAPIV3Schema: &crdtypes.JSONSchemaProps{Type: "object"},
+	}
+	f := newFixture(t)
+	f.addRemoteObjects(crdObject(t, remote))
+	f.newClients(crd)
+
+	if _, err := newCRSyncer(crd, f.local, f.remote, "cluster1"); err == nil {
+		t.Error("newCRSyncer succeeded with an incompatible remote CRD")
+	}
+}
+
+func TestNewCRSyncer_remoteGroupMissingCRD(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationRemoteGroup] = testRemoteGroup
+	f := newFixture(t)
+	f.newClients(crd)
+
+	if _, err := newCRSyncer(crd, f.local, f.remote, "cluster1"); err == nil {
+		t.Error("newCRSyncer succeeded without a remote CRD")
+	}
+}
+
+// withDiscovery adds a fake discovery client that serves the resources to
+// the dynamic client.
+func withDiscovery(client dynamic.Interface, resources ...*metav1.APIResourceList) dynamic.Interface {
+	return serverClient{
+		Interface: client,
+		discovery: &fakediscovery.FakeDiscovery{Fake: &k8stest.Fake{Resources: resources}},
+	}
+}
+
+func TestSyncUpstream_differentRemotePlural(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	gvr := f.newClients(crd)
+
+	// The fake client stores objects added up front under the guessed
+	// plural, so create the remote object under the remote plural.
+	remoteGVR := schema.GroupVersionResource{Group: "crds.example.com", Version: "v1beta1", Resource: "objectives"}
+	if _, err := f.remote.Resource(remoteGVR).Namespace("default").Create(newTestCR("resource1", "spec1", nil), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	f.remote.ClearActions()
+
+	remote := withDiscovery(f.remote, &metav1.APIResourceList{
+		GroupVersion: "crds.example.com/v1beta1",
+		APIResources: []metav1.APIResource{
+			{Name: "objectives", Kind: "Goal", Namespaced: true},
+			{Name: "objectives/status", Kind: "Goal", Namespaced: true},
+		},
+	})
+	crs, err := newCRSyncer(crd, f.local, remote, "cluster1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	crs.instance = ""
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", newTestCR("resource1", "spec1", nil)))
+	f.verifyWriteActions()
+}
+
+func TestNewCRSyncer_doesntListRemoteCRDs(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.newClients(crd)
+
+	crs, err := newCRSyncer(crd, f.local, f.remote, "cluster1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer crs.stop()
+	if crs.remoteCRDExists() {
+		t.Error("remoteCRDExists() = true without a remote CRD")
+	}
+	if listedResource(f.remote.Actions(), crdGVR) {
+		t.Error("remote CRDs were listed")
+	}
+}
+
+func TestRemoteCRDExists_discovery(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.newClients(crd)
+
+	crs, err := newCRSyncer(crd, f.local, withDiscovery(f.remote), "cluster1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer crs.stop()
+	if crs.remoteCRDExists() {
+		t.Error("remoteCRDExists() = true for an unserved resource")
+	}
+
+	crs.remoteClient = withDiscovery(f.remote, &metav1.APIResourceList{
+		GroupVersion: "crds.example.com/v1beta1",
+		APIResources: []metav1.APIResource{{Name: "goals", Kind: "Goal", Namespaced: true}},
+	})
+	if !crs.remoteCRDExists() {
+		t.Error("remoteCRDExists() = false for a served resource")
+	}
+}
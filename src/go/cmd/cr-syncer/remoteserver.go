@@ -0,0 +1,160 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/googlecloudrobotics/core/src/go/pkg/kubeutils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// Key of the remote server in the ConfigMap or Secret given by
+	// -remote-server-from, if none is given.
+	defaultRemoteServerKey = "remote-server"
+
+	// Delay before watching the ConfigMap or Secret again after the
+	// watch failed or ended.
+	remoteServerRewatchDelay = 10 * time.Second
+)
+
+// remoteServerSource is a ConfigMap or Secret key in the local cluster that
+// holds the address of the remote server.
+type remoteServerSource struct {
+	resource        schema.GroupVersionResource
+	namespace, name string
+	key             string
+}
+
+// parseRemoteServerSource parses a value of the form
+// <configmap|secret>:<namespace>/<name>[/<key>].
+func parseRemoteServerSource(value string) (remoteServerSource, error) {
+	var src remoteServerSource
+	kind, ref := "", value
+	if i := strings.Index(value, ":"); i >= 0 {
+		kind, ref = value[:i], value[i+1:]
+	}
+	switch kind {
+	case "configmap":
+		src.resource = configMapsResource
+	case "secret":
+		src.resource = kubeutils.SecretsResource
+	default:
+		return src, fmt.Errorf("%q doesn't start with configmap: or secret:", value)
+	}
+	parts := strings.Split(ref, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return src, fmt.Errorf("%q isn't of the form %s:<namespace>/<name>[/<key>]", value, kind)
+	}
+	src.namespace, src.name, src.key = parts[0], parts[1], defaultRemoteServerKey
+	if len(parts) == 3 && parts[2] != "" {
+		src.key = parts[2]
+	}
+	return src, nil
+}
+
+func (src remoteServerSource) String() string {
+	return fmt.Sprintf("%s %s/%s key %s", src.resource.Resource, src.namespace, src.name, src.key)
+}
+
+// value returns the remote server stored in the ConfigMap or Secret o.
+func (src remoteServerSource) value(o *unstructured.Unstructured) (string, error) {
+	v, found, err := unstructured.NestedString(o.Object, "data", src.key)
+	if err != nil || !found {
+		return "", fmt.Errorf("%s not found", src)
+	}
+	if src.resource == kubeutils.SecretsResource {
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return "", fmt.Errorf("%s: %s", src, err)
+		}
+		v = string(b)
+	}
+	server := strings.TrimSpace(v)
+	if err := validateServer(server); err != nil {
+		return "", fmt.Errorf("%s: %s", src, err)
+	}
+	return server, nil
+}
+
+// read returns the remote server from the local cluster.
+func (src remoteServerSource) read(client dynamic.Interface) (string, error) {
+	o, err := client.Resource(src.resource).Namespace(src.namespace).Get(src.name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %s", src, err)
+	}
+	return src.value(o)
+}
+
+// watch calls onChange with the new remote server whenever it changes from
+// server, until done is closed. Invalid values are logged and ignored.
+func (src remoteServerSource) watch(client dynamic.Interface, server string, done <-chan struct{}, onChange func(string)) {
+	options := metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", src.name).String(),
+	}
+	for {
+		w, err := client.Resource(src.resource).Namespace(src.namespace).Watch(options)
+		if err != nil {
+			log.Printf("Failed to watch %s: %s", src, err)
+		} else {
+			server = src.watchEvents(w, server, done, onChange)
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(remoteServerRewatchDelay):
+		}
+	}
+}
+
+// watchEvents handles the events of w until it ends or done is closed, and
+// returns the current remote server.
+func (src remoteServerSource) watchEvents(w watch.Interface, server string, done <-chan struct{}, onChange func(string)) string {
+	defer w.Stop()
+	for {
+		select {
+		case <-done:
+			return server
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				return server
+			}
+			o, isObject := e.Object.(*unstructured.Unstructured)
+			if !isObject || o.GetName() != src.name || (e.Type != watch.Added && e.Type != watch.Modified) {
+				continue
+			}
+			v, err := src.value(o)
+			if err != nil {
+				log.Printf("Ignoring change of the remote server: %s", err)
+				continue
+			}
+			if v != server {
+				log.Printf("Remote server changed from %s to %s", server, v)
+				server = v
+				onChange(v)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/googlecloudrobotics/core/src/go/pkg/kubeutils"
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newServerObject(kind, key, value string) *unstructured.Unstructured {
+	o := &unstructured.Unstructured{}
+	o.SetAPIVersion("v1")
+	o.SetKind(kind)
+	o.SetNamespace("default")
+	o.SetName("relay")
+	o.Object["data"] = map[string]interface{}{key: value}
+	return o
+}
+
+func newFakeServerClient(objs ...runtime.Object) *k8sfake.FakeDynamicClient {
+	s := runtime.NewScheme()
+	s.AddKnownTypeWithName(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, &unstructured.Unstructured{})
+	return k8sfake.NewSimpleDynamicClient(s, objs...)
+}
+
+func TestParseRemoteServerSource(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		want    remoteServerSource
+		wantErr bool
+	}{
+		{"configmap:default/relay", remoteServerSource{configMapsResource, "default", "relay", defaultRemoteServerKey}, false},
+		{"secret:default/relay/server", remoteServerSource{kubeutils.SecretsResource, "default", "relay", "server"}, false},
+		{"default/relay", remoteServerSource{}, true},
+		{"pod:default/relay", remoteServerSource{}, true},
+		{"configmap:relay", remoteServerSource{}, true},
+		{"configmap:default/relay/server/extra", remoteServerSource{}, true},
+	} {
+		got, err := parseRemoteServerSource(tc.value)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseRemoteServerSource(%q) = %v, want error", tc.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parseRemoteServerSource(%q) = %v, %v, want %v", tc.value, got, err, tc.want)
+		}
+	}
+}
+
+func TestRemoteServerSource_readsSecret(t *testing.T) {
+	src, err := parseRemoteServerSource("secret:default/relay/server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newFakeServerClient(newServerObject("Secret", "server",
+		base64.StdEncoding.EncodeToString([]byte("www.endpoints.example.com\n"))))
+	if got, err := src.read(client); err != nil || got != "www.endpoints.example.com" {
+		t.Errorf("read() = %q, %v, want www.endpoints.example.com", got, err)
+	}
+}
+
+func TestRemoteServerSource_watchesChanges(t *testing.T) {
+	src, err := parseRemoteServerSource("configmap:default/relay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newFakeServerClient(newServerObject("ConfigMap", defaultRemoteServerKey, "www.a.example.com"))
+	server, err := src.read(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server != "www.a.example.com" {
+		t.Errorf("read() = %q, want www.a.example.com", server)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	changes := make(chan string, 1)
+	go src.watch(client, server, done, func(s string) { changes <- s })
+	watching := func() bool {
+		for _, a := range client.Actions() {
+			if a.GetVerb() == "watch" {
+				return true
+			}
+		}
+		return false
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for !watching() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the watch")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	updated := newServerObject("ConfigMap", defaultRemoteServerKey, "www.b.example.com")
+	if _, err := client.Resource(configMapsResource).Namespace("default").Update(updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-changes:
+		if got != "www.b.example.com" {
+			t.Errorf("got remote server %q, want www.b.example.com", got)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the change")
+	}
+}
+
+func TestReconnectSyncers(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.newClients(crd)
+	s, err := newCRSyncer(crd, f.local, f.remote, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncers := map[string]*crSyncer{crd.GetName(): s}
+
+	remote := k8sfake.NewSimpleDynamicClient(runtime.NewScheme())
+	reconnectSyncers(syncers, f.local, remote)
+
+	got := syncers[crd.GetName()]
+	if got == nil || got == s {
+		t.Fatalf("syncer for %s wasn't recreated", crd.GetName())
+	}
+	defer got.stop()
+	if got.remoteClient != remote {
+		t.Error("recreated syncer doesn't use the new remote client")
+	}
+	select {
+	case <-s.done:
+	default:
+		t.Error("old syncer wasn't stopped")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// Backoff between checks whether the remote server is reachable, if
+// -wait-for-remote is set.
+const (
+	remoteWaitInitialDelay = time.Second
+	remoteWaitMaxDelay     = time.Minute
+)
+
+// discoveryCheck returns a function that checks whether the server of the
+// config answers a discovery request.
+func discoveryCheck(config *rest.Config) (func() error, error) {
+	client, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := client.ServerVersion()
+		return err
+	}, nil
+}
+
+// waitUntilReachable calls check until it succeeds, doubling the delay
+// between attempts from initial up to max. It returns false if done is
+// closed first.
+func waitUntilReachable(server string, check func() error, initial, max time.Duration, done <-chan struct{}) bool {
+	delay := initial
+	for attempt := 1; ; attempt++ {
+		err := check()
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("Remote server %s is reachable after %d attempts", server, attempt)
+			}
+			return true
+		}
+		log.Printf("Remote server %s is unreachable (attempt %d), retrying in %s: %v", server, attempt, delay, err)
+		select {
+		case <-done:
+			return false
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > max {
+			delay = max
+		}
+	}
+}
+
+// waitForRemoteServer blocks until the remote server answers a discovery
+// request, so that the syncers don't start with failing lists. It returns
+// ctx.Err() if ctx is cancelled first.
+func waitForRemoteServer(ctx context.Context) error {
+	config, err := restConfigForRemote(ctx)
+	if err != nil {
+		return err
+	}
+	check, err := discoveryCheck(config)
+	if err != nil {
+		return err
+	}
+	if !waitUntilReachable(*remoteServer, check, remoteWaitInitialDelay, remoteWaitMaxDelay, ctx.Done()) {
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestWaitUntilReachable_waitsForRemote(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The remote becomes reachable on the third request.
+		if atomic.AddInt32(&requests, 1) < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"major": "1", "minor": "16", "gitVersion": "v1.16.0"}`))
+	}))
+	defer srv.Close()
+
+	check, err := discoveryCheck(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !waitUntilReachable(srv.URL, check, time.Millisecond, 2*time.Millisecond, nil) {
+		t.Fatal("waitUntilReachable() = false, want true")
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("got %d requests, want 3", n)
+	}
+}
+
+func TestWaitUntilReachable_stopsWhenDone(t *testing.T) {
+	done := make(chan struct{})
+	close(done)
+	unreachable := func() error { return errors.New("connection refused") }
+	if waitUntilReachable("remote", unreachable, time.Hour, time.Hour, done) {
+		t.Error("waitUntilReachable() = true, want false")
+	}
+}
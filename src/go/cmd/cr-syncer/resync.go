@@ -0,0 +1,64 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// resyncBatcher spreads the keys of a periodic resync over time. The
+// informers deliver the resync of all cached objects at once, which would
+// otherwise cause a burst of requests to the remote cluster.
+type resyncBatcher struct {
+	mu    sync.Mutex
+	start time.Time // Start of the current resync.
+	last  time.Time // Time of the last resync event.
+	n     int       // Number of keys seen in the current resync.
+}
+
+// delay returns how long the next key of the resync should wait before it is
+// enqueued, so that at most size keys are enqueued per interval. Events that
+// are more than one interval apart belong to different resyncs.
+func (b *resyncBatcher) delay(now time.Time, size int, interval time.Duration) time.Duration {
+	if size <= 0 {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.n == 0 || now.Sub(b.last) > interval {
+		b.start = now
+		b.n = 0
+	}
+	wait := time.Duration(b.n/size)*interval - now.Sub(b.start)
+	b.n++
+	b.last = now
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// enqueueResync adds the key of a resynced object to the queue, in batches
+// of -resync-batch-size per -resync-batch-interval if configured.
+func (s *crSyncer) enqueueResync(queue workqueue.RateLimitingInterface, b *resyncBatcher, key string) {
+	if wait := b.delay(time.Now(), s.resyncBatchSize, s.resyncBatchInterval); wait > 0 {
+		queue.AddAfter(key, wait)
+		return
+	}
+	queue.AddRateLimited(key)
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestResyncBatcher(t *testing.T) {
+	var b resyncBatcher
+	start := time.Now()
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	// Five keys of a resync in batches of two per second.
+	var got []time.Duration
+	for i := 0; i < 5; i++ {
+		got = append(got, b.delay(at(time.Duration(i)*time.Millisecond), 2, time.Second))
+	}
+	want := []time.Duration{
+		0,
+		0,
+		time.Second - 2*time.Millisecond,
+		time.Second - 3*time.Millisecond,
+		2*time.Second - 4*time.Millisecond,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got delays %v, want %v", got, want)
+	}
+
+	// The next resync starts over.
+	if d := b.delay(at(5*time.Minute), 2, time.Second); d != 0 {
+		t.Errorf("got delay %s for the first key of the next resync, want 0", d)
+	}
+
+	// Without a batch size, keys are never delayed.
+	var unbatched resyncBatcher
+	for i := 0; i < 5; i++ {
+		if d := unbatched.delay(start, 0, time.Second); d != 0 {
+			t.Errorf("got delay %s without batching, want 0", d)
+		}
+	}
+}
+
+func TestEnqueueResync_batches(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.resyncBatchSize = 2
+	crs.resyncBatchInterval = 200 * time.Millisecond
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	var b resyncBatcher
+	for i := 0; i < 5; i++ {
+		crs.enqueueResync(q, &b, fmt.Sprintf("default/resource%d", i))
+	}
+
+	// The first batch is added right away (after the rate limiter's
+	// initial backoff), the others one interval apart.
+	time.Sleep(100 * time.Millisecond)
+	if n := q.Len(); n != 2 {
+		t.Errorf("got %d keys after the first batch, want 2", n)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n := q.Len(); n != 4 {
+		t.Errorf("got %d keys after the second batch, want 4", n)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n := q.Len(); n != 5 {
+		t.Errorf("got %d keys after the third batch, want 5", n)
+	}
+}
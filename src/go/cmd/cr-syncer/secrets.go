@@ -0,0 +1,82 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+
+	"github.com/googlecloudrobotics/core/src/go/pkg/kubeutils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// CRD annotation with the dotted path of a field in the spec that holds
+	// the name of a Secret in the namespace of the object. The Secret is
+	// mirrored downstream along with the object.
+	annotationSyncReferencedSecret = "cr-syncer.cloudrobotics.com/sync-referenced-secret"
+	// Set on mirrored Secrets to the name of the object they were mirrored
+	// for. The Secret is deleted along with that object.
+	annotationMirroredFor = "cr-syncer.cloudrobotics.com/mirrored-for"
+)
+
+// referencedSecret returns the name of the Secret referenced by the object,
+// or "" if there is none.
+func (s *crSyncer) referencedSecret(o *unstructured.Unstructured) string {
+	if s.secretPath == nil || o.GetNamespace() == "" {
+		return ""
+	}
+	name, _, _ := unstructured.NestedString(o.Object, s.secretPath...)
+	return name
+}
+
+// mirrorReferencedSecret copies the Secret referenced by the upstream object
+// to the namespace of the downstream object.
+func (s *crSyncer) mirrorReferencedSecret(src *unstructured.Unstructured, downstreamNs string) error {
+	name := s.referencedSecret(src)
+	if name == "" {
+		return nil
+	}
+	return kubeutils.MirrorSecret(
+		s.upstreamSecrets.Namespace(src.GetNamespace()),
+		s.downstreamSecrets.Namespace(downstreamNs),
+		name,
+		map[string]string{annotationMirroredFor: src.GetName()},
+	)
+}
+
+// deleteReferencedSecret deletes the downstream copy of the Secret
+// referenced by the deleted object, unless the Secret was last mirrored for
+// another object. Failures are logged.
+func (s *crSyncer) deleteReferencedSecret(o *unstructured.Unstructured, downstreamNs string) {
+	name := s.referencedSecret(o)
+	if name == "" {
+		return
+	}
+	secrets := s.downstreamSecrets.Namespace(downstreamNs)
+	secret, err := secrets.Get(name, metav1.GetOptions{})
+	if err != nil {
+		if !isNotFoundError(err) {
+			log.Printf("Failed to get secret %s/%s referenced by %s: %s", downstreamNs, name, o.GetName(), err)
+		}
+		return
+	}
+	if secret.GetAnnotations()[annotationMirroredFor] != o.GetName() {
+		return
+	}
+	if err := secrets.Delete(name, nil); err != nil && !isNotFoundError(err) {
+		log.Printf("Failed to delete secret %s/%s referenced by %s: %s", downstreamNs, name, o.GetName(), err)
+	}
+}
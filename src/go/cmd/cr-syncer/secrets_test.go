@@ -0,0 +1,100 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/googlecloudrobotics/core/src/go/pkg/kubeutils"
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestSecret(name string, data map[string]interface{}) *unstructured.Unstructured {
+	o := &unstructured.Unstructured{Object: map[string]interface{}{"data": data}}
+	o.SetAPIVersion("v1")
+	o.SetKind("Secret")
+	o.SetNamespace(metav1.NamespaceDefault)
+	o.SetName(name)
+	return o
+}
+
+func TestSyncUpstream_mirrorsReferencedSecret(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationSyncReferencedSecret] = "credentials.secretName"
+	f := newFixture(t)
+
+	data := map[string]interface{}{"token": "c2VjcmV0"}
+	f.addRemoteObjects(
+		newTestCR("resource1", map[string]interface{}{
+			"credentials": map[string]interface{}{"secretName": "creds"},
+		}, nil),
+		newTestSecret("creds", data),
+		newTestSecret("other", data),
+	)
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	secrets := f.local.Resource(kubeutils.SecretsResource).Namespace("default")
+	secret, err := secrets.Get("creds", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("referenced secret not created downstream: %s", err)
+	}
+	if got := secret.Object["data"]; !reflect.DeepEqual(got, data) {
+		t.Errorf("got secret data %v, want %v", got, data)
+	}
+	if got := secret.GetAnnotations()[annotationMirroredFor]; got != "resource1" {
+		t.Errorf("got %s annotation %q, want %q", annotationMirroredFor, got, "resource1")
+	}
+	if _, err := secrets.Get("other", metav1.GetOptions{}); !isNotFoundError(err) {
+		t.Errorf("unreferenced secret was mirrored, err: %v", err)
+	}
+}
+
+func TestSyncUpstream_deletesReferencedSecret(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationSyncReferencedSecret] = "credentials.secretName"
+	f := newFixture(t)
+
+	secret := newTestSecret("creds", nil)
+	secret.SetAnnotations(map[string]string{annotationMirroredFor: "resource1"})
+	f.addLocalObjects(
+		newTestCR("resource1", map[string]interface{}{
+			"credentials": map[string]interface{}{"secretName": "creds"},
+		}, nil),
+		secret,
+	)
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	secrets := f.local.Resource(kubeutils.SecretsResource).Namespace("default")
+	if _, err := secrets.Get("creds", metav1.GetOptions{}); !isNotFoundError(err) {
+		t.Errorf("referenced secret not deleted downstream, err: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+)
+
+// serverClient is a dynamic client together with the discovery and metadata
+// clients for the same server. The syncers use the discovery client to
+// resolve resources and the metadata client for -metadata-only-cache, if
+// they are set.
+type serverClient struct {
+	dynamic.Interface
+	discovery discovery.DiscoveryInterface
+	metadata  metadata.Interface
+}
+
+func newServerClient(config *rest.Config) (serverClient, error) {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return serverClient{}, err
+	}
+	disco, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return serverClient{}, err
+	}
+	meta, err := metadata.NewForConfig(config)
+	if err != nil {
+		return serverClient{}, err
+	}
+	return serverClient{Interface: client, discovery: disco, metadata: meta}, nil
+}
+
+func (c serverClient) Discovery() discovery.DiscoveryInterface {
+	return c.discovery
+}
+
+func (c serverClient) Metadata() metadata.Interface {
+	return c.metadata
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+// CRD annotation with the time to wait after the syncer started before the
+// first objects are reconciled, eg. "30s".
+const annotationStartupDelay = "cr-syncer.cloudrobotics.com/startup-delay"
+
+// parseStartupDelay returns the startup delay of the CRD, or 0 if the
+// annotation isn't set.
+func parseStartupDelay(crd crdtypes.CustomResourceDefinition) (time.Duration, error) {
+	value := crd.ObjectMeta.Annotations[annotationStartupDelay]
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("must be a non-negative duration, got %q", value)
+	}
+	return d, nil
+}
+
+// waitStartupDelay blocks until the startup delay has passed since start.
+// Meanwhile the informers keep filling the work queues, which collapse
+// repeated events for the same object. It returns false if the syncer was
+// stopped while waiting.
+func (s *crSyncer) waitStartupDelay(start time.Time) bool {
+	wait := s.startupDelay - time.Since(start)
+	if wait <= 0 {
+		return true
+	}
+	log.Printf("Deferring sync of %s for %s", s.crd.GetName(), wait.Round(time.Second))
+	select {
+	case <-s.done:
+		return false
+	case <-time.After(wait):
+		return true
+	}
+}
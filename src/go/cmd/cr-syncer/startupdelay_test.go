@@ -0,0 +1,90 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestParseStartupDelay(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"30s", 30 * time.Second, false},
+		{"-1s", 0, true},
+		{"soon", 0, true},
+	} {
+		crd := testCRD(crdtypes.NamespaceScoped)
+		if tc.value != "" {
+			crd.ObjectMeta.Annotations[annotationStartupDelay] = tc.value
+		}
+		got, err := parseStartupDelay(crd)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("startup delay %q: got %s, want error", tc.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("startup delay %q: got %s, %v, want %s", tc.value, got, err, tc.want)
+		}
+	}
+}
+
+// hasWrite returns true if the actions contain a write.
+func hasWrite(actions []k8stest.Action) bool {
+	for _, a := range actions {
+		switch a.GetVerb() {
+		case "create", "update", "patch", "delete":
+			return true
+		}
+	}
+	return false
+}
+
+func TestCRSyncer_defersSyncForStartupDelay(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", nil))
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	if _, err := f.remote.Resource(crdGVR).Create(crdObject(t, crd), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	const delay = 500 * time.Millisecond
+	crs.startupDelay = delay
+
+	start := time.Now()
+	go crs.run()
+
+	deadline := start.Add(10 * time.Second)
+	for !hasWrite(f.local.Actions()) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the sync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("object was synced after %s, want no sync before %s", elapsed, delay)
+	}
+}
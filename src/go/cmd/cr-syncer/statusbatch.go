@@ -0,0 +1,166 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	statusFieldImmediate = "immediate"
+	statusFieldBatched   = "batched"
+
+	// Default for the status-batch-seconds annotation.
+	defaultStatusBatchInterval = 30 * time.Second
+)
+
+// parseStatusFields parses the value of the status-fields annotation and
+// returns the set of batched fields.
+func parseStatusFields(value string) (map[string]bool, error) {
+	batched := map[string]bool{}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(pair), "=")
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("expected field=%s|%s, got %q", statusFieldImmediate, statusFieldBatched, pair)
+		}
+		switch parts[1] {
+		case statusFieldImmediate:
+		case statusFieldBatched:
+			batched[parts[0]] = true
+		default:
+			return nil, fmt.Errorf("unknown class %q for status field %s", parts[1], parts[0])
+		}
+	}
+	return batched, nil
+}
+
+// applyStatusBatching configures the batching of status updates from the
+// annotations of the CRD.
+func (s *crSyncer) applyStatusBatching(crd crdtypes.CustomResourceDefinition) {
+	s.batchedStatusFields = nil
+	s.statusBatchInterval = defaultStatusBatchInterval
+	if value := crd.ObjectMeta.Annotations[annotationStatusFields]; value != "" {
+		batched, err := parseStatusFields(value)
+		if err != nil {
+			log.Printf("Ignoring %s on %s: %s", annotationStatusFields, crd.ObjectMeta.Name, err)
+		} else {
+			s.batchedStatusFields = batched
+		}
+	}
+	if value := crd.ObjectMeta.Annotations[annotationStatusBatchSeconds]; value != "" {
+		v, err := strconv.Atoi(value)
+		if err != nil || v <= 0 {
+			log.Printf("Value for %s must be a positive integer on %s, got %q",
+				annotationStatusBatchSeconds, crd.ObjectMeta.Name, value)
+		} else {
+			s.statusBatchInterval = time.Duration(v) * time.Second
+		}
+	}
+}
+
+// syncedStatusValue returns the part of the object's status that is synced.
+func (s *crSyncer) syncedStatusValue(o *unstructured.Unstructured) interface{} {
+	if s.subtree == "" {
+		return o.Object["status"]
+	}
+	status, _ := o.Object["status"].(map[string]interface{})
+	subtree, _, _ := unstructured.NestedFieldNoCopy(status, strings.Split(s.subtree, ".")...)
+	if compressed, ok := subtree.(string); ok && s.compressSubtree {
+		// Upstream subtrees are compressed, compare them decoded.
+		if v, err := decompressSubtree(compressed); err == nil {
+			return v
+		}
+	}
+	return subtree
+}
+
+// syncedStatus is like syncedStatusValue, but returns nil if the value
+// isn't a dict.
+func (s *crSyncer) syncedStatus(o *unstructured.Unstructured) map[string]interface{} {
+	m, _ := s.syncedStatusValue(o).(map[string]interface{})
+	return m
+}
+
+// deferStatus returns the time after which the status of src should be
+// synced to dst, or zero if it should be synced right away. The sync is
+// deferred if only batched fields changed since the last sync of the
+// object less than the batch interval ago.
+func (s *crSyncer) deferStatus(key string, src, dst *unstructured.Unstructured) time.Duration {
+	if len(s.batchedStatusFields) == 0 {
+		return 0
+	}
+	srcStatus, dstStatus := s.syncedStatus(src), s.syncedStatus(dst)
+	changed := false
+	for _, m := range []map[string]interface{}{srcStatus, dstStatus} {
+		for field := range m {
+			if reflect.DeepEqual(srcStatus[field], dstStatus[field]) {
+				continue
+			}
+			if !s.batchedStatusFields[field] {
+				return 0
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		return 0
+	}
+	s.statusSyncMu.Lock()
+	last, ok := s.statusSyncTimes[key]
+	s.statusSyncMu.Unlock()
+	if !ok {
+		return 0
+	}
+	if wait := s.statusBatchInterval - time.Since(last); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// statusWriteDelay returns how long the status sync of the object with the
+// given key has to wait to keep statusMinInterval between upstream status
+// writes, or zero if it can be synced right away. Changes that happen while
+// waiting are coalesced into a single write, as the workqueue deduplicates
+// keys.
+func (s *crSyncer) statusWriteDelay(key string) time.Duration {
+	if s.statusMinInterval <= 0 {
+		return 0
+	}
+	s.statusSyncMu.Lock()
+	last, ok := s.statusSyncTimes[key]
+	s.statusSyncMu.Unlock()
+	if !ok {
+		return 0
+	}
+	if wait := s.statusMinInterval - time.Since(last); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// recordStatusSync remembers when the status of an object was last synced.
+func (s *crSyncer) recordStatusSync(key string) {
+	s.statusSyncMu.Lock()
+	defer s.statusSyncMu.Unlock()
+	s.statusSyncTimes[key] = time.Now()
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Interval in which the status state is written to disk.
+const statusStateSaveInterval = 10 * time.Second
+
+// syncedVersions are the resource versions of a downstream object and its
+// upstream counterpart after the status was last written upstream.
+type syncedVersions struct {
+	Downstream string `json:"downstream"`
+	Upstream   string `json:"upstream"`
+}
+
+// statusState persists the resource versions of the last status writes, so
+// that a restarted syncer doesn't rewrite the status of unchanged objects.
+type statusState struct {
+	path string
+
+	mu       sync.Mutex
+	versions map[string]syncedVersions // By downstream key.
+	dirty    bool
+}
+
+// statusStatePath returns the file holding the status state of the CRD in
+// the directory.
+func statusStatePath(dir, crd string) string {
+	return filepath.Join(dir, crd+".json")
+}
+
+// loadStatusState reads the status state from the file. If the file is
+// missing or can't be read, syncing starts from scratch, as stale state
+// only costs redundant writes.
+func loadStatusState(path string) *statusState {
+	st := &statusState{path: path, versions: make(map[string]syncedVersions)}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st
+	}
+	if err == nil {
+		err = json.Unmarshal(b, &st.versions)
+	}
+	if err != nil {
+		log.Printf("Ignoring status state in %s: %s", path, err)
+		st.versions = make(map[string]syncedVersions)
+	}
+	return st
+}
+
+// unchanged returns true if neither object changed since the status was
+// last written.
+func (st *statusState) unchanged(key, downstreamRV, upstreamRV string) bool {
+	if st == nil {
+		return false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	v, ok := st.versions[key]
+	return ok && v.Downstream == downstreamRV && v.Upstream == upstreamRV
+}
+
+// record remembers the resource versions after a status write.
+func (st *statusState) record(key, downstreamRV, upstreamRV string) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.versions[key] = syncedVersions{Downstream: downstreamRV, Upstream: upstreamRV}
+	st.dirty = true
+}
+
+// forget drops the state of a deleted object.
+func (st *statusState) forget(key string) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if _, ok := st.versions[key]; ok {
+		delete(st.versions, key)
+		st.dirty = true
+	}
+}
+
+// save writes the state to disk if it changed. The file is replaced
+// atomically, so that a crash doesn't leave a truncated file behind.
+func (st *statusState) save() error {
+	if st == nil {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !st.dirty {
+		return nil
+	}
+	b, err := json.Marshal(st.versions)
+	if err != nil {
+		return err
+	}
+	tmp := st.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("failed to write status state: %s", err)
+	}
+	if err := os.Rename(tmp, st.path); err != nil {
+		return fmt.Errorf("failed to write status state: %s", err)
+	}
+	st.dirty = false
+	return nil
+}
+
+// saveStatusState periodically writes the status state to disk until the
+// syncer is stopped.
+func (s *crSyncer) saveStatusState() {
+	ticker := time.NewTicker(statusStateSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+		if err := s.statusState.save(); err != nil {
+			log.Printf("Saving status state for %s failed: %s", s.crd.GetName(), err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func tempStatusStatePath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "status-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return statusStatePath(dir, "goals.crds.example.com"), func() { os.RemoveAll(dir) }
+}
+
+func TestStatusStateSaveAndLoad(t *testing.T) {
+	path, cleanup := tempStatusStatePath(t)
+	defer cleanup()
+
+	st := loadStatusState(path)
+	st.record("default/a", "1", "2")
+	st.record("default/b", "3", "4")
+	st.forget("default/b")
+	if err := st.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := loadStatusState(path)
+	if !loaded.unchanged("default/a", "1", "2") {
+		t.Error("recorded versions weren't loaded")
+	}
+	if loaded.unchanged("default/a", "1", "5") {
+		t.Error("changed upstream version reported as unchanged")
+	}
+	if loaded.unchanged("default/b", "3", "4") {
+		t.Error("forgotten versions were loaded")
+	}
+}
+
+func TestLoadStatusStateIgnoresCorruptFile(t *testing.T) {
+	path, cleanup := tempStatusStatePath(t)
+	defer cleanup()
+	if err := ioutil.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	st := loadStatusState(path)
+	if len(st.versions) != 0 {
+		t.Errorf("got versions %v from corrupt file, want none", st.versions)
+	}
+	// The state can still be saved over the corrupt file.
+	st.record("default/a", "1", "2")
+	if err := st.save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "goals.crds.example.com.json.tmp")); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestSyncDownstream_skipsWriteWithPersistedState(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	path, cleanup := tempStatusStatePath(t)
+	defer cleanup()
+	st := loadStatusState(path)
+	st.record("default/resource1", "123", "7")
+	if err := st.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFixture(t)
+	tcrLocal := newTestCR("resource1", "spec1", "status2")
+	tcrLocal.SetResourceVersion("123")
+	tcrRemote := newTestCR("resource1", "spec1", "status2")
+	tcrRemote.SetResourceVersion("7")
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.statusState = loadStatusState(path)
+
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	f.verifyWriteActions()
+}
+
+func TestSyncDownstream_writesWithStalePersistedState(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	path, cleanup := tempStatusStatePath(t)
+	defer cleanup()
+	st := loadStatusState(path)
+	// The downstream object changed after the state was saved.
+	st.record("default/resource1", "122", "7")
+	if err := st.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFixture(t)
+	tcrLocal := newTestCR("resource1", "spec1", "status2")
+	tcrLocal.SetResourceVersion("123")
+	tcrRemote := newTestCR("resource1", "spec1", "status1")
+	tcrRemote.SetResourceVersion("7")
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.statusState = loadStatusState(path)
+
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tcrRemoteNew := newTestCR("resource1", "spec1", "status2")
+	tcrRemoteNew.SetResourceVersion("7")
+	tcrRemoteNew.SetAnnotations(map[string]string{
+		annotationResourceVersion: "123",
+	})
+	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+	f.verifyWriteActions()
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Annotation on upstream objects with the finalizers that block the deletion
+// of their downstream counterpart, set if it was terminating for longer than
+// -stuck-deletion-threshold.
+const annotationBlockingFinalizers = "cr-syncer.cloudrobotics.com/blocking-finalizers"
+
+var mStuckDeletions = stats.Int64(
+	"cr-syncer.cloudrobotics.com/stuck_deletions",
+	"Downstream objects that were terminating for longer than the stuck deletion threshold",
+	stats.UnitDimensionless,
+)
+
+func init() {
+	if err := view.Register(
+		&view.View{
+			Name:        "cr-syncer.cloudrobotics.com/stuck_deletions_total",
+			Description: "Total number of downstream objects that were terminating for longer than the stuck deletion threshold",
+			Measure:     mStuckDeletions,
+			TagKeys:     []tag.Key{tagResource},
+			Aggregation: view.Count(),
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// checkStuckDeletion is called while the downstream object dst is
+// terminating. If it has been terminating for longer than
+// -stuck-deletion-threshold, eg because a controller doesn't remove its
+// finalizer, the deletion is counted as stuck and the blocking finalizers are
+// recorded on the upstream object src, if it still exists. Otherwise, the
+// key is checked again once the threshold has passed.
+func (s *crSyncer) checkStuckDeletion(key string, src, dst *unstructured.Unstructured) {
+	if s.stuckDeletionThreshold <= 0 {
+		return
+	}
+	wait := dst.GetDeletionTimestamp().Add(s.stuckDeletionThreshold).Sub(time.Now())
+	if wait > 0 {
+		s.upstreamQueue.AddAfter(key, wait)
+		return
+	}
+	finalizers := strings.Join(dst.GetFinalizers(), ",")
+
+	s.stuckDeletionsMu.Lock()
+	reported := s.stuckDeletions[key]
+	s.stuckDeletions[key] = true
+	recorded, ok := s.recordedFinalizers[key]
+	s.stuckDeletionsMu.Unlock()
+	if !reported {
+		log.Printf("Deletion of %s %s is stuck: terminating since %s, blocked by finalizers [%s]",
+			dst.GetKind(), key, dst.GetDeletionTimestamp().Time.Format(time.RFC3339), finalizers)
+		ctx, err := tag.New(context.Background(), tag.Insert(tagResource, s.crd.GetName()))
+		if err != nil {
+			panic(err)
+		}
+		stats.Record(ctx, mStuckDeletions.M(1))
+	}
+	if src == nil || src.GetAnnotations()[annotationBlockingFinalizers] == finalizers || (ok && recorded == finalizers) {
+		return
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				annotationBlockingFinalizers: finalizers,
+			},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	if _, err := s.upstream.Namespace(src.GetNamespace()).Patch(src.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		if !isNotFoundError(err) {
+			log.Printf("Failed to record blocking finalizers of %s %s: %s", src.GetKind(), key, err)
+		}
+		return
+	}
+	s.stuckDeletionsMu.Lock()
+	s.recordedFinalizers[key] = finalizers
+	s.stuckDeletionsMu.Unlock()
+}
+
+// forgetStuckDeletion is called once the downstream object is gone.
+func (s *crSyncer) forgetStuckDeletion(key string) {
+	s.stuckDeletionsMu.Lock()
+	defer s.stuckDeletionsMu.Unlock()
+	delete(s.stuckDeletions, key)
+	delete(s.recordedFinalizers, key)
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8stest "k8s.io/client-go/testing"
+)
+
+// stuckDeletions returns the number of stuck deletions recorded for the CRD.
+func stuckDeletions(t *testing.T, crd crdtypes.CustomResourceDefinition) int64 {
+	rows, err := view.RetrieveData("cr-syncer.cloudrobotics.com/stuck_deletions_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rows {
+		for _, tg := range r.Tags {
+			if tg.Key == tagResource && tg.Value == crd.GetName() {
+				return r.Data.(*view.CountData).Value
+			}
+		}
+	}
+	return 0
+}
+
+func TestSyncUpstream_reportsStuckDeletion(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	var (
+		now       = metav1.Now()
+		longAgo   = metav1.NewTime(now.Add(-time.Hour))
+		tcrLocal  = newTestCR("resource1", "spec1", "status1")
+		tcrRemote = newTestCR("resource1", "spec1", "status1")
+	)
+	tcrRemote.SetDeletionTimestamp(&now)
+	tcrLocal.SetDeletionTimestamp(&longAgo)
+	tcrLocal.SetFinalizers([]string{"example.com/cleanup", "example.com/backup"})
+
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.stuckDeletionThreshold = 10 * time.Minute
+
+	before := stuckDeletions(t, crd)
+	crs.startInformers()
+	for i := 0; i < 2; i++ {
+		if err := crs.syncUpstream("default/resource1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The stuck deletion is counted once.
+	if got := stuckDeletions(t, crd) - before; got != 1 {
+		t.Errorf("got %d stuck deletions, want 1", got)
+	}
+	patch := []byte(`{"metadata":{"annotations":{"cr-syncer.cloudrobotics.com/blocking-finalizers":"example.com/cleanup,example.com/backup"}}}`)
+	f.expectRemoteActions(k8stest.NewPatchAction(gvr, "default", "resource1", types.MergePatchType, patch))
+	f.verifyWriteActions()
+}
+
+func TestSyncUpstream_recentDeletionIsNotStuck(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	var (
+		now       = metav1.Now()
+		tcrLocal  = newTestCR("resource1", "spec1", "status1")
+		tcrRemote = newTestCR("resource1", "spec1", "status1")
+	)
+	tcrRemote.SetDeletionTimestamp(&now)
+	tcrLocal.SetDeletionTimestamp(&now)
+	tcrLocal.SetFinalizers([]string{"example.com/cleanup"})
+
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.stuckDeletionThreshold = 10 * time.Minute
+
+	before := stuckDeletions(t, crd)
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := stuckDeletions(t, crd) - before; got != 0 {
+		t.Errorf("got %d stuck deletions, want 0", got)
+	}
+	f.verifyWriteActions()
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// Annotation identifying the syncer instance that last wrote an
+	// object. Like the remote-resource-version annotation, it isn't
+	// written along with the status if the status is a subresource.
+	annotationSyncedBy = "cr-syncer.cloudrobotics.com/synced-by"
+
+	// Environment variable with the name of the syncer's pod, set through
+	// the downward API.
+	podNameEnv = "POD_NAME"
+)
+
+// syncerInstance returns the identity of this syncer instance, made up of the
+// robot name and the pod name, or "" if neither is known.
+func syncerInstance() string {
+	var parts []string
+	for _, p := range []string{*robotName, os.Getenv(podNameEnv)} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// markSyncedBy sets the synced-by annotation on an object that is about to
+// be written.
+func (s *crSyncer) markSyncedBy(o *unstructured.Unstructured) {
+	if s.instance != "" {
+		setAnnotation(o, annotationSyncedBy, s.instance)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSyncerInstance(t *testing.T) {
+	defer func(orig string) { *robotName = orig }(*robotName)
+	defer func(orig string, set bool) {
+		if set {
+			os.Setenv(podNameEnv, orig)
+		} else {
+			os.Unsetenv(podNameEnv)
+		}
+	}(os.LookupEnv(podNameEnv))
+
+	*robotName = "robot1"
+	os.Setenv(podNameEnv, "cr-syncer-abc")
+	if got, want := syncerInstance(), "robot1/cr-syncer-abc"; got != want {
+		t.Errorf("syncerInstance() = %q, want %q", got, want)
+	}
+	os.Unsetenv(podNameEnv)
+	if got, want := syncerInstance(), "robot1"; got != want {
+		t.Errorf("syncerInstance() without pod name = %q, want %q", got, want)
+	}
+}
+
+func TestSync_marksWritesWithInstance(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(
+		newTestCR("resource1", "spec1", nil),
+		newTestCR("resource2", "spec2", nil),
+	)
+	f.addLocalObjects(newTestCR("resource2", "spec2", "status2"))
+
+	crs, gvr := f.newCRSyncer(crd, "robot1")
+	defer crs.stop()
+	crs.instance = "robot1/cr-syncer-abc"
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := crs.syncDownstream("default/resource2"); err != nil {
+		t.Fatal(err)
+	}
+
+	local, err := f.local.Resource(gvr).Namespace("default").Get("resource1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := local.GetAnnotations()[annotationSyncedBy]; got != crs.instance {
+		t.Errorf("got %s %q on downstream write, want %q", annotationSyncedBy, got, crs.instance)
+	}
+	remote, err := f.remote.Resource(gvr).Namespace("default").Get("resource2", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := remote.GetAnnotations()[annotationSyncedBy]; got != crs.instance {
+		t.Errorf("got %s %q on upstream status write, want %q", annotationSyncedBy, got, crs.instance)
+	}
+}
@@ -16,20 +16,34 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"reflect"
+	"runtime/pprof"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/go-openapi/validate"
+	"github.com/googlecloudrobotics/core/src/go/pkg/kubeutils"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
 	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/tools/cache"
@@ -38,12 +52,34 @@ import (
 
 const (
 	// Annotations attached to CRDs.
-	annotationStatusSubtree     = "cr-syncer.cloudrobotics.com/status-subtree"
-	annotationFilterByRobotName = "cr-syncer.cloudrobotics.com/filter-by-robot-name"
-	annotationSpecSource        = "cr-syncer.cloudrobotics.com/spec-source"
+	annotationStatusSubtree             = "cr-syncer.cloudrobotics.com/status-subtree"
+	annotationSpecSubtree               = "cr-syncer.cloudrobotics.com/spec-subtree"
+	annotationFilterByRobotName         = "cr-syncer.cloudrobotics.com/filter-by-robot-name"
+	annotationSpecSource                = "cr-syncer.cloudrobotics.com/spec-source"
+	annotationValidateSchema            = "cr-syncer.cloudrobotics.com/validate-schema"
+	annotationRequireObservedGeneration = "cr-syncer.cloudrobotics.com/require-observed-generation"
+	annotationNamespaceMap              = "cr-syncer.cloudrobotics.com/namespace-map"
+	annotationDeletionGraceSeconds      = "cr-syncer.cloudrobotics.com/deletion-grace-seconds"
+	annotationDeletePropagation         = "cr-syncer.cloudrobotics.com/delete-propagation"
+	annotationStatusFields              = "cr-syncer.cloudrobotics.com/status-fields"
+	annotationStatusBatchSeconds        = "cr-syncer.cloudrobotics.com/status-batch-seconds"
+	annotationRequireSyncGate           = "cr-syncer.cloudrobotics.com/require-sync-gate"
+	annotationClearStatusWhenEmpty      = "cr-syncer.cloudrobotics.com/clear-status-when-empty"
+
+	// Placeholder in the status-subtree and spec-subtree annotations that
+	// is replaced by the robot name.
+	robotNamePlaceholder = "{robotName}"
 
 	// Annotations and labels attached to CRs.
 	labelRobotName = "cloudrobotics.com/robot-name"
+	// Label that opts an object into syncing if the CRD has the
+	// require-sync-gate annotation.
+	labelSyncGate        = "cloudrobotics.com/sync"
+	labelSyncGateEnabled = "enabled"
+	// Annotation that records which cluster ("cloud" or "robot") is the
+	// source of the spec. It uses the same key as the CRD annotation and is
+	// set on all objects when migrating the spec source of a CRD.
+	annotationObjectSpecSource = annotationSpecSource
 	// Annotation for remote resource version. Note that for resources in
 	// the cloud cluster, this is a resource version on the robot's cluster
 	// (and vice versa). This will only be set when the status subresource
@@ -52,6 +88,26 @@ const (
 	annotationResourceVersion = "cr-syncer.cloudrobotics.com/remote-resource-version"
 )
 
+// CRD annotations that affect what the informers watch. Changing them
+// requires recreating the syncer.
+var informerAnnotations = []string{
+	annotationFilterByRobotName,
+	annotationSpecSource,
+	annotationNamespaceMap,
+	annotationKeyField,
+	annotationRemoteGroup,
+	// Not used by the informers, but the workers are only started once.
+	annotationConcurrency,
+	annotationStartupDelay,
+	annotationOrdered,
+}
+
+var crdGVR = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1beta1",
+	Resource: "customresourcedefinitions",
+}
+
 var (
 	mSyncs = stats.Int64(
 		"cr-syncer.cloudrobotics.com/syncs",
@@ -63,6 +119,16 @@ var (
 		"Synchronization errors on resource events",
 		stats.UnitDimensionless,
 	)
+	mSyncDuration = stats.Float64(
+		"cr-syncer.cloudrobotics.com/sync_duration",
+		"Duration of synchronizations triggered by resource events",
+		"s",
+	)
+	mStatusMismatches = stats.Int64(
+		"cr-syncer.cloudrobotics.com/status_write_mismatches",
+		"Status writes that weren't reflected when reading the object back",
+		stats.UnitDimensionless,
+	)
 	tagEventSource = mustNewTagKey("event_source")
 	tagResource    = mustNewTagKey("resource")
 )
@@ -83,20 +149,47 @@ func init() {
 			TagKeys:     []tag.Key{tagEventSource, tagResource},
 			Aggregation: view.Count(),
 		},
+		&view.View{
+			Name:        "cr-syncer.cloudrobotics.com/status_write_mismatches_total",
+			Description: "Total number of status writes that weren't reflected when reading the object back",
+			Measure:     mStatusMismatches,
+			TagKeys:     []tag.Key{tagResource},
+			Aggregation: view.Count(),
+		},
+		// Recorded in the context of the sync's span, so that the
+		// buckets carry exemplars with trace IDs.
+		&view.View{
+			Name:        "cr_syncer_sync_duration_seconds",
+			Description: "Distribution of synchronization durations",
+			Measure:     mSyncDuration,
+			TagKeys:     []tag.Key{tagEventSource, tagResource},
+			Aggregation: view.Distribution(0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30),
+		},
 	); err != nil {
 		panic(err)
 	}
 }
 
-// removeFinalizer removes the cr-syncer finalizer for this robot. Finalizers
-// for offline robots have to be removed manually (eg with `kubectl edit`).
-// TODO(rodrigoq): remove after migration
-func removeFinalizer(client dynamic.ResourceInterface, obj *unstructured.Unstructured, clusterName string) {
+// Prefix of finalizers that were added by cr-syncer under earlier settings.
+const finalizerPrefix = "cr-syncer.cloudrobotics.com/"
+
+// isStaleFinalizer returns true if the finalizer was added by a cr-syncer for
+// the given cluster. The syncer no longer manages finalizers, so these would
+// block deletion of the object forever. Finalizers of other controllers, and
+// the legacy finalizers of other robots' syncers, are not stale.
+func isStaleFinalizer(finalizer, clusterName string) bool {
+	return finalizer == fmt.Sprintf("%s.synced.cr-syncer.cloudrobotics.com", clusterName) ||
+		strings.HasPrefix(finalizer, finalizerPrefix)
+}
+
+// removeStaleFinalizers removes the cr-syncer finalizers for this robot.
+// Finalizers for offline robots have to be removed manually (eg with
+// `kubectl edit`).
+func removeStaleFinalizers(client dynamic.ResourceInterface, obj *unstructured.Unstructured, clusterName string) {
 	update := false
-	thisFinalizer := fmt.Sprintf("%s.synced.cr-syncer.cloudrobotics.com", clusterName)
 	finalizers := []string{}
 	for _, x := range obj.GetFinalizers() {
-		if x == thisFinalizer {
+		if isStaleFinalizer(x, clusterName) {
 			update = true
 		} else {
 			finalizers = append(finalizers, x)
@@ -119,12 +212,161 @@ func removeFinalizer(client dynamic.ResourceInterface, obj *unstructured.Unstruc
 // Updates to the status subresource in the downstream are propagated back to
 // the upstream cluster.
 type crSyncer struct {
-	clusterName   string // Name of downstream cluster.
-	crd           crdtypes.CustomResourceDefinition
-	upstream      dynamic.ResourceInterface // Source of the spec.
-	downstream    dynamic.ResourceInterface // Source of the status.
-	labelSelector string
-	subtree       string
+	clusterName string // Name of downstream cluster.
+	specSource  string // Cluster that owns the spec, "cloud" or "robot".
+	crd         crdtypes.CustomResourceDefinition
+	upstream    dynamic.NamespaceableResourceInterface // Source of the spec.
+	downstream  dynamic.NamespaceableResourceInterface // Source of the status.
+	// API groups of the resource in the downstream and remote clusters,
+	// which differ if the remote-group annotation is set.
+	downstreamGroup string
+	remoteGroup     string
+	// Client for the remote cluster, used to check that the CRD exists
+	// there, and the interval between checks while it's missing.
+	remoteClient     dynamic.Interface
+	remoteCRDName    string
+	remoteCRDRecheck time.Duration
+	// Client for other resources in the downstream cluster.
+	downstreamClient dynamic.Interface
+	namespace        string // Synced namespace, or "" for all.
+	labelSelector    string
+	robotName        string
+	subtree          string // Dotted path with the robot name expanded.
+	specSubtree      string // Like subtree, but for the spec.
+	// If set, the upstream status is cleared if the downstream object has
+	// no status. Otherwise, it's kept until there is a downstream status.
+	clearStatusWhenEmpty bool
+	// If set, the subtree value is compressed before it's written upstream.
+	compressSubtree bool
+	// Applied to the subtree value before it's written upstream, nil for
+	// none.
+	subtreeTransform subtreeTransform
+
+	// Maps namespaces of upstream objects to the namespaces of their
+	// downstream counterparts. Namespaces that aren't mapped are kept. If
+	// set, only the default namespace and the mapped ones are synced.
+	namespaceMap map[string]string
+	// The inverse of namespaceMap.
+	reverseNamespaceMap map[string]string
+	// Namespaces whose objects are ignored if all namespaces are synced.
+	excludedNamespaces map[string]bool
+
+	// If set, status is only propagated upstream once the downstream
+	// controller has observed the current generation of the object.
+	requireObservedGeneration bool
+	// If true, the first status sync of each object waits until the
+	// downstream cluster observed the current generation.
+	deferInitialStatusSync bool
+	initialStatusMu        sync.Mutex
+	initialStatusSynced    map[string]bool
+	// If set, only objects with the sync gate label are synced.
+	requireSyncGate bool
+	// If set, upstream objects carry the guard finalizer until they were
+	// written downstream.
+	guardUntilSynced bool
+	// If set, existing downstream objects are only managed if they were
+	// created or explicitly adopted by the syncer.
+	strictAdoption bool
+	// If set, only objects that match the predicate are synced. If
+	// deleteUnmatched is set, the downstream copies of objects that don't
+	// match are deleted.
+	syncPredicate   *syncPredicate
+	deleteUnmatched bool
+	// Grace period for deleting downstream objects, nil for the server
+	// default.
+	deletionGracePeriod *int64
+	// Propagation policy for deleting downstream objects, nil for the
+	// server default.
+	deletePropagation *metav1.DeletionPropagation
+	// Status fields whose updates are batched, and the minimum interval
+	// between status updates that only change batched fields.
+	batchedStatusFields map[string]bool
+	statusBatchInterval time.Duration
+	// Minimum interval between upstream status writes of an object.
+	statusMinInterval time.Duration
+	// Time to hold back status writes after another writer changed the
+	// upstream status, 0 to overwrite immediately.
+	conflictBackoff time.Duration
+
+	// Paths of fields that are removed from objects before they are stored
+	// in the informer caches. If set, the sync functions fetch full objects
+	// from the API server instead of using the cached ones.
+	cacheStripPaths [][]string
+	// If set, only the metadata of objects is kept in the informer
+	// caches, which then only serve to trigger syncs.
+	metadataOnlyCache bool
+	// Maximum number of objects per page when the informers list
+	// objects, 0 to list all objects at once.
+	listPageSize int64
+	// Number of workers that process each of the work queues, and the
+	// number until the initial backlog is drained if that's higher.
+	workers        int
+	initialWorkers int
+	// If set, objects are synced one at a time in creation order.
+	ordered bool
+	// Time to wait after starting before the queues are processed.
+	startupDelay time.Duration
+
+	// If set, objects are validated against the schema of the CRD in the
+	// downstream cluster before they are written.
+	validateSchema    bool
+	downstreamCRDs    dynamic.ResourceInterface
+	downstreamCRDName string
+	validatorMu       sync.Mutex
+	validator         *validate.SchemaValidator // nil if the CRD has no schema.
+	validatorTime     time.Time                 // Time the validator was loaded.
+
+	// If positive, downstream objects that are terminating for longer
+	// are reported as stuck. Keys of the reported objects, and the
+	// blocking finalizers recorded upstream for them, since the upstream
+	// informer cache may not have seen the patch yet.
+	stuckDeletionThreshold time.Duration
+	stuckDeletionsMu       sync.Mutex
+	stuckDeletions         map[string]bool
+	recordedFinalizers     map[string]string
+
+	// If positive, objects that would exceed this size in bytes when
+	// written aren't synced.
+	maxObjectSize int64
+
+	// Rate limits the retries of syncs that failed with a network error,
+	// by queue name and key.
+	networkRetry workqueue.RateLimiter
+
+	// Keys of objects whose ownership is being handed off to the
+	// downstream cluster.
+	handoffMu sync.Mutex
+	handoffs  map[string]bool
+
+	// Resource versions of the status updates written upstream, by key.
+	// Update events for them are not synced again.
+	selfWritesMu sync.Mutex
+	selfWrites   map[string]string
+
+	// Detects other writers of the upstream status.
+	conflicts *conflictTracker
+
+	// Receives the changes of all writes, nil if disabled.
+	audit *auditWriter
+	// Receives records of lifecycle events, nil if disabled.
+	eventLog *otelLogExporter
+	// Streams reconcile events to local tools, nil if disabled.
+	eventStream *eventSocket
+
+	// Applied to objects before they are written downstream.
+	pipeline pipeline
+
+	// Resource versions of the last status writes, persisted across
+	// restarts. nil if disabled.
+	statusState *statusState
+
+	// Times of the last status updates, by downstream key.
+	statusSyncMu    sync.Mutex
+	statusSyncTimes map[string]time.Time
+
+	// Held for reading while an object is synced and for writing while the
+	// settings are updated in place.
+	configMu sync.RWMutex
 
 	// Informers and the queues they feed. Upstream/downstream describes
 	// the source of the change events, _not_ the direction they are heading.
@@ -134,6 +376,83 @@ type crSyncer struct {
 	downstreamInf   cache.SharedIndexInformer
 	upstreamQueue   workqueue.RateLimitingInterface
 	downstreamQueue workqueue.RateLimitingInterface
+	// The current informerPair, for readers that can't take configMu.
+	liveInformers atomic.Value
+
+	// Creates the informers. Used to restart them after repeated list or
+	// watch failures, see informerhealth.go.
+	newInformers  func() error
+	informersDone chan struct{} // Stops the current informers.
+	health        *informerHealth
+
+	observer ReconcileObserver
+
+	// If set, upstream objects are read back after their status was
+	// written, to check that the write took effect.
+	verifyStatus bool
+
+	// If set, the outcome of each sync is written to the annotations of the
+	// synced object.
+	recordSyncResults bool
+	// If set, updated objects get an Event that lists the changed fields.
+	recordChangeEvents bool
+	changeEvents       *changeEventLimiter
+
+	// If set, downstream objects are annotated with a checksum of the
+	// upstream spec.
+	writeSpecChecksum bool
+	// If set, downstream objects carry the managed label.
+	labelManaged bool
+	// Identity of this syncer instance, written to the synced-by
+	// annotation. Empty if unknown.
+	instance string
+
+	// Clusters to which upstream specs are mirrored.
+	backups []backupResource
+
+	// Path of the spec field holding the identity of objects, nil if
+	// objects are identified by their name.
+	keyField []string
+
+	// Path of the spec field holding the name of a Secret that is mirrored
+	// downstream along with the object, nil if none.
+	secretPath        []string
+	upstreamSecrets   dynamic.NamespaceableResourceInterface
+	downstreamSecrets dynamic.NamespaceableResourceInterface
+
+	// Name of the ConfigMap that the spec is projected to, "" if none.
+	configMapTemplate    string
+	downstreamConfigMaps dynamic.NamespaceableResourceInterface
+
+	// Merged into the spec of objects when they are created downstream.
+	createDefaults map[string]interface{}
+
+	// Whether missing downstream namespaces are created, and which labels
+	// are copied from the upstream namespace.
+	createNamespace       bool
+	createNamespaceLabels []string
+	namespaces            *namespaceCreator
+
+	// If set, Events of downstream objects are mirrored upstream.
+	mirrorEvents     bool
+	events           *eventMirror
+	upstreamEvents   dynamic.NamespaceableResourceInterface
+	downstreamEvents dynamic.NamespaceableResourceInterface
+
+	// Sources of the informers if -metadata-only-cache is set.
+	upstreamMetadata   metadataSource
+	downstreamMetadata metadataSource
+
+	// If non-zero, upstream objects that were last modified longer ago
+	// aren't created downstream. The last-modified time is read from
+	// objectAgeAnnotation, or the creationTimestamp if it's empty.
+	maxObjectAge        time.Duration
+	objectAgeAnnotation string
+
+	// If resyncBatchSize is positive, the keys of a periodic resync are
+	// enqueued in batches of that size per resyncBatchInterval.
+	resyncBatchSize     int
+	resyncBatchInterval time.Duration
 
 	done chan struct{} // Terminates all background processes.
 }
@@ -143,92 +462,693 @@ func newCRSyncer(
 	local, remote dynamic.Interface,
 	robotName string,
 ) (*crSyncer, error) {
-	var (
-		annotations        = crd.ObjectMeta.Annotations
-		filterByRobotValue = annotations[annotationFilterByRobotName]
-		filterByRobot      = false
-	)
-	if filterByRobotValue != "" {
-		if v, err := strconv.ParseBool(filterByRobotValue); err != nil {
-			log.Printf("Value for %s  must be boolean on %s, got %q",
-				annotationFilterByRobotName, crd.ObjectMeta.Name, filterByRobotValue)
-		} else {
-			filterByRobot = v
-		}
+	annotations := crd.ObjectMeta.Annotations
+	filterByRobot := parseBoolAnnotation(crd, annotationFilterByRobotName)
+	gvr, ns := crdResource(crd)
+	remoteGVR := gvr
+	if group := annotations[annotationRemoteGroup]; group != "" {
+		remoteGVR.Group = group
 	}
-	gvr := schema.GroupVersionResource{
-		Group:    crd.Spec.Group,
-		Version:  crd.Spec.Version,
-		Resource: crd.Spec.Names.Plural,
+	if plural, _, err := remotePlural(remote, remoteGVR.GroupVersion(), crd.Spec.Names.Kind); err != nil {
+		log.Printf("Assuming that the remote resource for %s is %s: %s", crd.GetName(), remoteGVR.Resource, err)
+	} else if plural != "" {
+		remoteGVR.Resource = plural
 	}
-	ns := ""
-	if crd.Spec.Scope == crdtypes.NamespaceScoped {
-		// TODO(https://github.com/googlecloudrobotics/core/issues/19): allow syncing CRs in other namespaces
-		ns = "default"
+	remoteCRDName := remoteGVR.Resource + "." + remoteGVR.Group
+	if remoteGVR.Group != gvr.Group {
+		remoteCRD, err := getRemoteCRD(remote, remoteCRDName)
+		if err != nil {
+			return nil, fmt.Errorf("incompatible %s: %s", annotationRemoteGroup, err)
+		}
+		if remoteCRD == nil {
+			return nil, fmt.Errorf("incompatible %s: no remote CRD for %s in group %s", annotationRemoteGroup, crd.Spec.Names.Kind, remoteGVR.Group)
+		}
+		if err := checkRemoteCRD(crd, *remoteCRD); err != nil {
+			return nil, fmt.Errorf("incompatible %s: %s", annotationRemoteGroup, err)
+		}
 	}
 	s := &crSyncer{
-		crd:             crd,
-		subtree:         annotations[annotationStatusSubtree],
-		upstream:        remote.Resource(gvr).Namespace(ns),
-		downstream:      local.Resource(gvr).Namespace(ns),
-		upstreamQueue:   workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "upstream"),
-		downstreamQueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "downstream"),
-		done:            make(chan struct{}),
-	}
-	switch src := annotations[annotationSpecSource]; src {
-	case "robot":
+		downstreamCRDs:       local.Resource(crdGVR),
+		downstreamCRDName:    crd.GetName(),
+		downstreamGroup:      gvr.Group,
+		remoteGroup:          remoteGVR.Group,
+		remoteClient:         remote,
+		remoteCRDName:        remoteCRDName,
+		remoteCRDRecheck:     remoteCRDCheckInterval,
+		upstream:             remote.Resource(remoteGVR),
+		downstream:           local.Resource(gvr),
+		downstreamClient:     local,
+		upstreamSecrets:      remote.Resource(kubeutils.SecretsResource),
+		downstreamSecrets:    local.Resource(kubeutils.SecretsResource),
+		downstreamConfigMaps: local.Resource(configMapsResource),
+		upstreamEvents:       remote.Resource(eventsResource),
+		downstreamEvents:     local.Resource(eventsResource),
+		upstreamMetadata:     newMetadataSource(remote, remoteGVR, crd.Spec.Names.Kind),
+		downstreamMetadata:   newMetadataSource(local, gvr, crd.Spec.Names.Kind),
+		events:               newEventMirror(),
+		namespace:            ns,
+		robotName:            robotName,
+		cacheStripPaths:      cacheStripPaths(),
+		metadataOnlyCache:    *metadataOnlyCache,
+		listPageSize:         *listPageSize,
+		excludedNamespaces:   excludedNamespaces(),
+		verifyStatus:         *verifyStatusWrites,
+		recordSyncResults:    *recordSyncResults,
+		recordChangeEvents:   *recordChangeEvents,
+		changeEvents:         newChangeEventLimiter(),
+		writeSpecChecksum:    *writeSpecChecksums,
+		labelManaged:         *labelManagedObjects,
+		instance:             syncerInstance(),
+		statusMinInterval:    *statusMinInterval,
+		conflictBackoff:      *conflictBackoff,
+		maxObjectAge:         *maxObjectAge,
+		objectAgeAnnotation:  *objectAgeAnnotation,
+		resyncBatchSize:      *resyncBatchSize,
+		resyncBatchInterval:  *resyncBatchInterval,
+		handoffs:             make(map[string]bool),
+		stuckDeletions:       make(map[string]bool),
+		recordedFinalizers:   make(map[string]string),
+		selfWrites:           make(map[string]string),
+		conflicts:            newConflictTracker(),
+		audit:                auditLog,
+		eventLog:             eventLog,
+		eventStream:          eventStream,
+		statusSyncTimes:      make(map[string]time.Time),
+		observer:             reconcileObserver,
+		informersDone:        make(chan struct{}),
+		health:               newInformerHealth(),
+		networkRetry:         newNetworkRetryLimiter(*networkRetryMaxDelay),
+		done:                 make(chan struct{}),
+	}
+	if s.ordered = parseBoolAnnotation(crd, annotationOrdered); s.ordered && *enablePriorityQueue {
+		return nil, fmt.Errorf("%s can't be used with -enable-priority-queue", annotationOrdered)
+	}
+	s.upstreamQueue = newWorkqueue("upstream", s.ordered, func() cache.SharedIndexInformer { return s.informers().upstream })
+	s.downstreamQueue = newWorkqueue("downstream", s.ordered, func() cache.SharedIndexInformer { return s.informers().downstream })
+	s.applyAnnotations(crd)
+	s.pipeline = s.specPipeline()
+	s.stuckDeletionThreshold = *stuckDeletionThreshold
+	s.maxObjectSize = *maxObjectSize
+	s.initialWorkers = *initialConcurrency
+	if *statusStateDir != "" {
+		s.statusState = loadStatusState(statusStatePath(*statusStateDir, crd.GetName()))
+	}
+	for _, b := range backupClients {
+		s.backups = append(s.backups, newBackupResource(b.server, b.client.Resource(remoteGVR)))
+	}
+	upstream, _, err := effectiveSpecSource(crd)
+	if err != nil {
+		return nil, err
+	}
+	s.specSource = annotations[annotationSpecSource]
+	if upstream == DirectionLocal {
 		s.clusterName = "cloud"
 		// Swap upstream and downstream if the robot is the spec source.
 		s.upstream, s.downstream = s.downstream, s.upstream
-	case "cloud":
+		s.upstreamSecrets, s.downstreamSecrets = s.downstreamSecrets, s.upstreamSecrets
+		s.upstreamEvents, s.downstreamEvents = s.downstreamEvents, s.upstreamEvents
+		s.upstreamMetadata, s.downstreamMetadata = s.downstreamMetadata, s.upstreamMetadata
+		s.downstreamCRDs = remote.Resource(crdGVR)
+		s.downstreamCRDName = remoteCRDName
+		s.downstreamGroup = remoteGVR.Group
+		s.downstreamConfigMaps = remote.Resource(configMapsResource)
+		s.downstreamClient = remote
+		s.namespaces = newNamespaceCreator(local.Resource(namespacesResource), remote.Resource(namespacesResource))
+	} else {
+		s.namespaces = newNamespaceCreator(remote.Resource(namespacesResource), local.Resource(namespacesResource))
 		s.clusterName = fmt.Sprintf("robot-%s", robotName)
-	default:
-		return nil, fmt.Errorf("unknown spec source %q", src)
+	}
+	if s.workers, err = parseConcurrency(crd, *maxSyncConcurrency); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", annotationConcurrency, err)
+	}
+	if s.ordered {
+		// Objects are only processed in creation order if there's a
+		// single worker per direction.
+		s.workers = 1
+		s.initialWorkers = 1
+	}
+	if s.startupDelay, err = parseStartupDelay(crd); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", annotationStartupDelay, err)
+	}
+	if m := annotations[annotationNamespaceMap]; m != "" {
+		namespaceMap, reverse, err := parseNamespaceMap(m)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", annotationNamespaceMap, err)
+		}
+		s.namespaceMap, s.reverseNamespaceMap = namespaceMap, reverse
 	}
 	if filterByRobot {
-		if robotName != "" {
-			s.labelSelector = labelRobotName + "=" + robotName
-		} else {
-			// TODO(fabxc): should this return an error instead?
-			log.Printf("%s requested to filter by robot-name, but no robot-name was given to cr-syncer", crd.ObjectMeta.Name)
+		if robotName == "" {
+			// Without a robot name, the objects of all robots would be
+			// synced to this one.
+			return nil, fmt.Errorf("%s requested to filter by robot-name, but no -robot-name was given to cr-syncer", crd.ObjectMeta.Name)
 		}
+		s.labelSelector = labelRobotName + "=" + robotName
 	}
 
-	newInformer := func(client dynamic.ResourceInterface) cache.SharedIndexInformer {
+	newInformer := func(client dynamic.ResourceInterface, meta metadataSource, direction string) cache.SharedIndexInformer {
 		return cache.NewSharedIndexInformer(
 			&cache.ListWatch{
 				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-					options.LabelSelector = s.labelSelector
-					return client.List(options)
+					if s.usesMetadataSource(meta) {
+						list, err := s.listMetadata(meta, options)
+						s.recordListWatch(direction, err)
+						if err != nil {
+							return nil, err
+						}
+						return list, nil
+					}
+					list, err := client.List(s.listOptions(options))
+					s.recordListWatch(direction, err)
+					if err != nil {
+						return nil, err
+					}
+					for i := range list.Items {
+						s.stripCachedFields(&list.Items[i])
+					}
+					return list, nil
 				},
 				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
 					options.LabelSelector = s.labelSelector
-					return client.Watch(options)
+					if s.usesMetadataSource(meta) {
+						w, err := s.watchMetadata(meta, options)
+						s.recordListWatch(direction, err)
+						return w, err
+					}
+					w, err := client.Watch(options)
+					s.recordListWatch(direction, err)
+					if err != nil || !s.stripsCache() {
+						return w, err
+					}
+					return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+						if u, ok := e.Object.(*unstructured.Unstructured); ok {
+							s.stripCachedFields(u)
+						}
+						return e, true
+					}), nil
 				},
 			},
 			&unstructured.Unstructured{},
 			resyncPeriod,
-			nil,
+			// AddIndexers panics on informers created with nil
+			// indexers.
+			cache.Indexers{},
 		)
 	}
-	s.upstreamInf = newInformer(s.upstream)
-	s.downstreamInf = newInformer(s.downstream)
+	s.keyField = parseSpecPath(annotations[annotationKeyField])
+	s.newInformers = func() error {
+		s.upstreamInf = newInformer(s.upstream.Namespace(s.namespace), s.upstreamMetadata, "upstream")
+		s.downstreamInf = newInformer(s.downstream.Namespace(s.namespace), s.downstreamMetadata, "downstream")
+		if s.keyField != nil {
+			indexers := cache.Indexers{identityIndex: s.identityIndexFunc}
+			if err := s.upstreamInf.AddIndexers(indexers); err != nil {
+				return err
+			}
+			if err := s.downstreamInf.AddIndexers(indexers); err != nil {
+				return err
+			}
+		}
+		s.liveInformers.Store(informerPair{upstream: s.upstreamInf, downstream: s.downstreamInf})
+		return nil
+	}
+	if err := s.newInformers(); err != nil {
+		return nil, err
+	}
 
+	log.Printf("Syncer config: %s", s.configSummary())
 	return s, nil
 }
 
+// configSummary returns the resolved configuration of the syncer as
+// key="value" pairs.
+func (s *crSyncer) configSummary() string {
+	gvr, _ := crdResource(s.crd)
+	namespace := s.namespace
+	if s.namespaceMap != nil {
+		namespaces := []string{metav1.NamespaceDefault}
+		for src := range s.namespaceMap {
+			if src != metav1.NamespaceDefault {
+				namespaces = append(namespaces, src)
+			}
+		}
+		sort.Strings(namespaces)
+		namespace = strings.Join(namespaces, ",")
+	} else if namespace == "" && s.crd.Spec.Scope == crdtypes.NamespaceScoped {
+		namespace = "*"
+	}
+	var namespaceMap []string
+	for src, dst := range s.namespaceMap {
+		namespaceMap = append(namespaceMap, src+"="+dst)
+	}
+	sort.Strings(namespaceMap)
+	fields := []struct{ key, value string }{
+		{"crd", s.crd.GetName()},
+		{"gvr", gvr.Group + "/" + gvr.Version + "/" + gvr.Resource},
+		{"scope", string(s.crd.Spec.Scope)},
+		{"namespace", namespace},
+		{"spec-source", s.specSource},
+		{"cluster", s.clusterName},
+		{"status-subtree", s.subtree},
+		{"spec-subtree", s.specSubtree},
+		{"label-selector", s.labelSelector},
+		{"namespace-map", strings.Join(namespaceMap, ",")},
+		{"key-field", strings.Join(s.keyField, ".")},
+		{"require-sync-gate", strconv.FormatBool(s.requireSyncGate)},
+		{"sync-predicate", s.syncPredicate.String()},
+		{"require-observed-generation", strconv.FormatBool(s.requireObservedGeneration)},
+		{"validate-schema", strconv.FormatBool(s.validateSchema)},
+		{"ordered", strconv.FormatBool(s.ordered)},
+	}
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = fmt.Sprintf("%s=%q", f.key, f.value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// applyAnnotations sets the settings that are given by CRD annotations and
+// can be changed without recreating the informers.
+func (s *crSyncer) applyAnnotations(crd crdtypes.CustomResourceDefinition) {
+	s.crd = crd
+	s.subtree = strings.Replace(crd.ObjectMeta.Annotations[annotationStatusSubtree], robotNamePlaceholder, s.robotName, -1)
+	s.specSubtree = strings.Replace(crd.ObjectMeta.Annotations[annotationSpecSubtree], robotNamePlaceholder, s.robotName, -1)
+	s.clearStatusWhenEmpty = parseBoolAnnotation(crd, annotationClearStatusWhenEmpty)
+	s.compressSubtree = parseBoolAnnotation(crd, annotationCompressSubtree)
+	s.subtreeTransform = parseSubtreeTransform(crd)
+	s.validateSchema = parseBoolAnnotation(crd, annotationValidateSchema)
+	s.requireObservedGeneration = parseBoolAnnotation(crd, annotationRequireObservedGeneration)
+	s.deferInitialStatusSync = parseBoolAnnotation(crd, annotationDeferInitialStatus)
+	s.requireSyncGate = parseBoolAnnotation(crd, annotationRequireSyncGate)
+	s.guardUntilSynced = parseBoolAnnotation(crd, annotationGuardUntilSynced)
+	s.strictAdoption = parseStrictAdoption(crd)
+	s.syncPredicate = parseSyncPredicate(crd)
+	s.deleteUnmatched = parseBoolAnnotation(crd, annotationSyncPredicateDelete)
+	s.deletionGracePeriod = parseDeletionGracePeriod(crd)
+	s.deletePropagation = parseDeletePropagation(crd)
+	s.applyStatusBatching(crd)
+	s.secretPath = parseSpecPath(crd.ObjectMeta.Annotations[annotationSyncReferencedSecret])
+	s.configMapTemplate = crd.ObjectMeta.Annotations[annotationProjectToConfigMap]
+	s.mirrorEvents = parseBoolAnnotation(crd, annotationMirrorEvents)
+	s.createDefaults = parseCreateDefaults(crd)
+	s.createNamespace = parseBoolAnnotation(crd, annotationCreateNamespace)
+	s.createNamespaceLabels = parseLabelKeys(crd.ObjectMeta.Annotations[annotationCreateNamespaceLabels])
+	s.disableGenerationFeatures()
+	// Reload the schema in case it changed along with the annotations.
+	s.validatorTime = time.Time{}
+}
+
+// canUpdateInPlace returns true if the only differences between the old and
+// new CRD are cr-syncer annotations that don't affect the informers.
+func canUpdateInPlace(old, new crdtypes.CustomResourceDefinition) bool {
+	if !reflect.DeepEqual(old.Spec, new.Spec) {
+		return false
+	}
+	for _, k := range informerAnnotations {
+		if old.ObjectMeta.Annotations[k] != new.ObjectMeta.Annotations[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// update changes the settings of a running syncer to those of the given CRD.
+// The caller must check canUpdateInPlace first.
+func (s *crSyncer) update(crd crdtypes.CustomResourceDefinition) {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	s.validatorMu.Lock()
+	defer s.validatorMu.Unlock()
+	s.applyAnnotations(crd)
+	log.Printf("Updated syncer for %s in place", crd.GetName())
+}
+
+// Direction identifies one of the clusters the syncer talks to.
+type Direction string
+
+const (
+	// The cluster the syncer runs in.
+	DirectionLocal Direction = "local"
+	// The cluster behind -remote-server.
+	DirectionRemote Direction = "remote"
+)
+
+// effectiveSpecSource returns which cluster is upstream, ie the source of
+// object existence and specs, and which is downstream, ie the source of the
+// status, according to the spec-source annotation of the CRD. The syncer
+// always runs on the robot, so the cloud is the remote cluster.
+func effectiveSpecSource(crd crdtypes.CustomResourceDefinition) (upstream, downstream Direction, err error) {
+	switch src := crd.ObjectMeta.Annotations[annotationSpecSource]; src {
+	case "cloud":
+		return DirectionRemote, DirectionLocal, nil
+	case "robot":
+		return DirectionLocal, DirectionRemote, nil
+	default:
+		return "", "", fmt.Errorf("unknown spec source %q", src)
+	}
+}
+
+// crdResource returns the resource and the namespace that are synced for the
+// given CRD.
+func crdResource(crd crdtypes.CustomResourceDefinition) (schema.GroupVersionResource, string) {
+	gvr := schema.GroupVersionResource{
+		Group:    crd.Spec.Group,
+		Version:  crd.Spec.Version,
+		Resource: crd.Spec.Names.Plural,
+	}
+	ns := ""
+	if crd.Spec.Scope == crdtypes.NamespaceScoped && crd.ObjectMeta.Annotations[annotationNamespaceMap] == "" {
+		// TODO(https://github.com/googlecloudrobotics/core/issues/19): allow syncing CRs in other namespaces
+		ns = "default"
+	}
+	// With a namespace map, all namespaces are watched, but only the
+	// default and the mapped ones are synced, see isExcluded.
+	return gvr, ns
+}
+
+// parseNamespaceMap parses a comma-separated list of src=dst namespace pairs
+// and returns the map and its inverse. The map must be one-to-one, including
+// the default namespace, which is kept unless it's mapped.
+func parseNamespaceMap(value string) (map[string]string, map[string]string, error) {
+	m := map[string]string{}
+	reverse := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(pair), "=")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, nil, fmt.Errorf("expected src=dst, got %q", pair)
+		}
+		src, dst := parts[0], parts[1]
+		if _, ok := m[src]; ok {
+			return nil, nil, fmt.Errorf("namespace %q is mapped twice", src)
+		}
+		if other, ok := reverse[dst]; ok {
+			return nil, nil, fmt.Errorf("namespaces %q and %q are both mapped to %q", other, src, dst)
+		}
+		m[src] = dst
+		reverse[dst] = src
+	}
+	if src, ok := reverse[metav1.NamespaceDefault]; ok {
+		if _, mapped := m[metav1.NamespaceDefault]; !mapped {
+			return nil, nil, fmt.Errorf("namespaces %q and %q are both mapped to %q", src, metav1.NamespaceDefault, metav1.NamespaceDefault)
+		}
+	}
+	return m, reverse, nil
+}
+
+// downstreamKey returns the key of the downstream counterpart of the
+// upstream object with the given key.
+func (s *crSyncer) downstreamKey(key string) string {
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil || ns == "" {
+		return key
+	}
+	return s.downstreamNamespace(ns) + "/" + name
+}
+
+// downstreamNamespace returns the namespace of the downstream counterparts
+// of upstream objects in namespace ns.
+func (s *crSyncer) downstreamNamespace(ns string) string {
+	if mapped, ok := s.namespaceMap[ns]; ok {
+		return mapped
+	}
+	return ns
+}
+
+// isExcluded returns true if the object with the given upstream key, or its
+// downstream counterpart, is in an excluded namespace, or if the upstream
+// namespace isn't synced with a namespace map.
+func (s *crSyncer) isExcluded(upstreamKey string) bool {
+	if s.namespace != "" {
+		return false
+	}
+	if ns, _, err := cache.SplitMetaNamespaceKey(upstreamKey); err == nil && ns != "" && s.namespaceMap != nil {
+		if _, mapped := s.namespaceMap[ns]; !mapped && ns != metav1.NamespaceDefault {
+			return true
+		}
+	}
+	for _, key := range []string{upstreamKey, s.downstreamKey(upstreamKey)} {
+		if ns, _, err := cache.SplitMetaNamespaceKey(key); err == nil && s.excludedNamespaces[ns] {
+			return true
+		}
+	}
+	return false
+}
+
+// lastSpecChange returns the newest time in the managedFields of o of a
+// write that touched the spec, or its creationTimestamp if there is none.
+// Other writes, such as the status written by the syncer, are ignored.
+func lastSpecChange(o *unstructured.Unstructured) time.Time {
+	modified := o.GetCreationTimestamp().Time
+	entries, _, _ := unstructured.NestedSlice(o.Object, "metadata", "managedFields")
+	for _, e := range entries {
+		entry, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fields, ok := entry["fieldsV1"].(map[string]interface{})
+		if !ok {
+			// Before Kubernetes 1.17, the field was named "fields".
+			fields, _ = entry["fields"].(map[string]interface{})
+		}
+		if _, ok := fields["f:spec"]; !ok {
+			continue
+		}
+		value, _ := entry["time"].(string)
+		t, err := time.Parse(time.RFC3339, value)
+		if err == nil && t.After(modified) {
+			modified = t
+		}
+	}
+	return modified
+}
+
+// isTooOld returns true if the object was last modified longer than
+// maxObjectAge ago. Objects are never too old while the clocks of the
+// clusters are too skewed to compare their timestamps.
+func (s *crSyncer) isTooOld(o *unstructured.Unstructured) bool {
+	if s.maxObjectAge == 0 || !clockSkew.timestampsTrusted() {
+		return false
+	}
+	modified := lastSpecChange(o)
+	if v, ok := o.GetAnnotations()[s.objectAgeAnnotation]; s.objectAgeAnnotation != "" && ok {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			log.Printf("Ignoring invalid %s annotation on %s/%s: %s", s.objectAgeAnnotation, o.GetNamespace(), o.GetName(), err)
+		} else {
+			modified = t
+		}
+	}
+	return time.Since(modified) > s.maxObjectAge
+}
+
+// isGated returns true if the CRD requires the sync gate label and the
+// upstream object doesn't carry it, or if the upstream object doesn't match
+// the sync predicate.
+func (s *crSyncer) isGated(o *unstructured.Unstructured) bool {
+	return (s.requireSyncGate && o.GetLabels()[labelSyncGate] != labelSyncGateEnabled) ||
+		!s.syncPredicate.matches(o)
+}
+
+// upstreamKey returns the key of the upstream counterpart of the downstream
+// object with the given key.
+func (s *crSyncer) upstreamKey(key string) string {
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil || ns == "" {
+		return key
+	}
+	if src, ok := s.reverseNamespaceMap[ns]; ok {
+		return src + "/" + name
+	}
+	return key
+}
+
+// isExcludedDownstream returns true if the downstream object with the given
+// key is excluded, or if it isn't the counterpart of an upstream object, as
+// its namespace is mapped to another one.
+func (s *crSyncer) isExcludedDownstream(key string) bool {
+	upstreamKey := s.upstreamKey(key)
+	return s.isExcluded(upstreamKey) || s.downstreamKey(upstreamKey) != key
+}
+
+// parseSpecPath parses the dotted path of a spec field given by a CRD
+// annotation, or returns nil if it isn't set. The leading "spec." is
+// optional.
+func parseSpecPath(value string) []string {
+	value = strings.TrimPrefix(value, "spec.")
+	if value == "" {
+		return nil
+	}
+	return append([]string{"spec"}, strings.Split(value, ".")...)
+}
+
+// parseBoolAnnotation returns the value of a boolean annotation on the CRD.
+// Missing or malformed values are treated as false.
+func parseBoolAnnotation(crd crdtypes.CustomResourceDefinition, key string) bool {
+	value := crd.ObjectMeta.Annotations[key]
+	if value == "" {
+		return false
+	}
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Value for %s  must be boolean on %s, got %q",
+			key, crd.ObjectMeta.Name, value)
+		return false
+	}
+	return v
+}
+
+// parseDeletionGracePeriod returns the grace period from the
+// deletion-grace-seconds annotation, or nil if it is unset or invalid.
+func parseDeletionGracePeriod(crd crdtypes.CustomResourceDefinition) *int64 {
+	value := crd.ObjectMeta.Annotations[annotationDeletionGraceSeconds]
+	if value == "" {
+		return nil
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || v < 0 {
+		log.Printf("Value for %s must be a non-negative integer on %s, got %q",
+			annotationDeletionGraceSeconds, crd.ObjectMeta.Name, value)
+		return nil
+	}
+	return &v
+}
+
+// parseDeletePropagation returns the propagation policy given by the
+// delete-propagation annotation, or nil if it is unset or invalid.
+func parseDeletePropagation(crd crdtypes.CustomResourceDefinition) *metav1.DeletionPropagation {
+	value := crd.ObjectMeta.Annotations[annotationDeletePropagation]
+	if value == "" {
+		return nil
+	}
+	p := metav1.DeletionPropagation(value)
+	switch p {
+	case metav1.DeletePropagationForeground, metav1.DeletePropagationBackground, metav1.DeletePropagationOrphan:
+		return &p
+	}
+	log.Printf("Value for %s must be one of Foreground, Background or Orphan on %s, got %q",
+		annotationDeletePropagation, crd.ObjectMeta.Name, value)
+	return nil
+}
+
+// downstreamDeleteOptions returns the options for deleting downstream
+// objects whose upstream counterpart was deleted.
+func (s *crSyncer) downstreamDeleteOptions() *metav1.DeleteOptions {
+	if s.deletionGracePeriod == nil && s.deletePropagation == nil {
+		return nil
+	}
+	return &metav1.DeleteOptions{
+		GracePeriodSeconds: s.deletionGracePeriod,
+		PropagationPolicy:  s.deletePropagation,
+	}
+}
+
+// listOptions returns the options for a list call of the informers.
+func (s *crSyncer) listOptions(options metav1.ListOptions) metav1.ListOptions {
+	options.LabelSelector = s.labelSelector
+	if s.listPageSize > 0 {
+		options.Limit = s.listPageSize
+		if options.ResourceVersion == "0" {
+			// Lists from the watch cache aren't paginated, so read
+			// from etcd instead. The reflector fetches the following
+			// pages using the continue token.
+			options.ResourceVersion = ""
+		}
+	}
+	return options
+}
+
+// stripsCache returns true if fields are removed from the objects in the
+// informer caches.
+func (s *crSyncer) stripsCache() bool {
+	return len(s.cacheStripPaths) > 0 || s.metadataOnlyCache
+}
+
+// stripCachedFields removes the fields that should not be kept in the
+// informer caches from the object.
+func (s *crSyncer) stripCachedFields(o *unstructured.Unstructured) {
+	for _, p := range s.cacheStripPaths {
+		unstructured.RemoveNestedField(o.Object, p...)
+	}
+	if !s.metadataOnlyCache {
+		return
+	}
+	var key interface{}
+	if s.keyField != nil {
+		// The identity index needs the key field.
+		key, _, _ = unstructured.NestedFieldNoCopy(o.Object, s.keyField...)
+	}
+	for k := range o.Object {
+		if k != "apiVersion" && k != "kind" && k != "metadata" {
+			delete(o.Object, k)
+		}
+	}
+	unstructured.RemoveNestedField(o.Object, "metadata", "managedFields")
+	if key != nil {
+		unstructured.SetNestedField(o.Object, key, s.keyField...)
+	}
+}
+
+// getObject returns a copy of the object for the given key, or false if it
+// doesn't exist. If fields are stripped from the cache, the full object is
+// fetched from the API server.
+func (s *crSyncer) getObject(
+	inf cache.SharedIndexInformer,
+	client dynamic.NamespaceableResourceInterface,
+	key string,
+) (*unstructured.Unstructured, bool, error) {
+	obj, exists, err := inf.GetIndexer().GetByKey(key)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	cached := obj.(*unstructured.Unstructured)
+	if !s.stripsCache() {
+		return cached.DeepCopy(), true, nil
+	}
+	full, err := client.Namespace(cached.GetNamespace()).Get(cached.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return full, true, nil
+}
+
+// getLiveObject fetches the object for the given key from the API server,
+// bypassing the cache. It returns false if the object doesn't exist.
+func (s *crSyncer) getLiveObject(client dynamic.NamespaceableResourceInterface, key string) (*unstructured.Unstructured, bool, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	o, err := client.Namespace(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return o, true, nil
+}
+
 func (s *crSyncer) startInformers() error {
-	go s.upstreamInf.Run(s.done)
-	go s.downstreamInf.Run(s.done)
+	s.configMu.RLock()
+	upstreamInf, downstreamInf, stop := s.upstreamInf, s.downstreamInf, s.informersDone
+	s.configMu.RUnlock()
+
+	go upstreamInf.Run(stop)
+	go downstreamInf.Run(stop)
 
-	if ok := cache.WaitForCacheSync(s.done, s.upstreamInf.HasSynced); !ok {
+	if ok := cache.WaitForCacheSync(stop, upstreamInf.HasSynced); !ok {
 		return fmt.Errorf("stopped while syncing upstream informer for %s", s.crd.GetName())
 	}
-	if ok := cache.WaitForCacheSync(s.done, s.downstreamInf.HasSynced); !ok {
+	if ok := cache.WaitForCacheSync(stop, downstreamInf.HasSynced); !ok {
 		return fmt.Errorf("stopped while syncing downstream informer for %s", s.crd.GetName())
 	}
-	s.setupInformerHandlers(s.upstreamInf, s.upstreamQueue, "upstream")
-	s.setupInformerHandlers(s.downstreamInf, s.downstreamQueue, "downstream")
+	s.setupInformerHandlers(upstreamInf, s.upstreamQueue, "upstream")
+	s.setupInformerHandlers(downstreamInf, s.downstreamQueue, "downstream")
+	if s.mirrorEvents {
+		s.watchEvents(stop)
+	}
 
 	return nil
 }
@@ -238,31 +1158,82 @@ func (s *crSyncer) setupInformerHandlers(
 	queue workqueue.RateLimitingInterface,
 	direction string,
 ) {
-	receive := func(obj interface{}, action string) {
+	var resyncs resyncBatcher
+	receive := func(obj interface{}, action string, resync bool) {
 		u := obj.(*unstructured.Unstructured)
 		log.Printf("Got %s event from %s for %s %s@v%s",
 			action, direction, u.GetKind(), u.GetName(), u.GetResourceVersion())
-		if key, ok := keyFunc(obj); ok {
-			queue.AddRateLimited(key)
+		key, ok := keyFunc(obj)
+		if !ok {
+			return
+		}
+		excluded := s.isExcluded(key)
+		if direction == "downstream" {
+			excluded = s.isExcludedDownstream(key)
+		}
+		if excluded {
+			return
 		}
+		if direction == "upstream" && s.isSelfWrite(key, u.GetResourceVersion(), action) {
+			log.Printf("Ignoring own write of %s %s@v%s", u.GetKind(), u.GetName(), u.GetResourceVersion())
+			return
+		}
+		key = s.queueKey(u, key)
+		if resync {
+			s.enqueueResync(queue, &resyncs, key)
+			return
+		}
+		queue.AddRateLimited(key)
 	}
 	inf.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			receive(obj, "add")
+			receive(obj, "add", false)
 		},
-		UpdateFunc: func(_, obj interface{}) {
-			receive(obj, "update")
+		UpdateFunc: func(old, obj interface{}) {
+			// Periodic resyncs deliver unchanged objects.
+			resync := old.(*unstructured.Unstructured).GetResourceVersion() == obj.(*unstructured.Unstructured).GetResourceVersion()
+			if !resync && s.recordSyncResults && onlySyncResultChanged(old.(*unstructured.Unstructured), obj.(*unstructured.Unstructured)) {
+				// Syncing the annotation of the outcome of the last
+				// sync would overwrite it.
+				return
+			}
+			receive(obj, "update", resync)
 		},
 		DeleteFunc: func(obj interface{}) {
-			receive(obj, "delete")
+			receive(obj, "delete", false)
 		},
 	})
 }
 
+// recordSelfWrite remembers the resource version of an upstream object that
+// was just written by the syncer.
+func (s *crSyncer) recordSelfWrite(key, resourceVersion string) {
+	if resourceVersion == "" {
+		return
+	}
+	s.selfWritesMu.Lock()
+	defer s.selfWritesMu.Unlock()
+	s.selfWrites[key] = resourceVersion
+}
+
+// isSelfWrite returns true if the event for the upstream object was caused
+// by the syncer's own write. Only the first event after a write is checked,
+// so that later changes are never missed.
+func (s *crSyncer) isSelfWrite(key, resourceVersion, action string) bool {
+	s.selfWritesMu.Lock()
+	defer s.selfWritesMu.Unlock()
+	written, ok := s.selfWrites[key]
+	if !ok {
+		return false
+	}
+	delete(s.selfWrites, key)
+	return action == "update" && written == resourceVersion
+}
+
 func (s *crSyncer) processNextWorkItem(
 	ctx context.Context,
 	q workqueue.RateLimitingInterface,
-	syncf func(string) error,
+	syncf func(context.Context, string) (Result, error),
 	qName string,
 ) bool {
 	key, quit := q.Get()
@@ -275,15 +1246,77 @@ func (s *crSyncer) processNextWorkItem(
 	if err != nil {
 		panic(err)
 	}
-	err = syncf(key.(string))
-	stats.Record(ctx, mSyncs.M(1))
+	ctx, span := trace.StartSpan(ctx, "cr-syncer/sync/"+qName)
+	span.AddAttributes(
+		trace.StringAttribute("crd", s.crd.GetName()),
+		trace.StringAttribute("key", key.(string)),
+	)
+	ctx, calls := withAPICalls(ctx)
+	start := time.Now()
+	var result Result
+	// Label the goroutine, so that CPU and heap profiles can be
+	// attributed to the CRD.
+	pprof.Do(ctx, pprof.Labels("crd", s.crd.GetName(), "direction", qName), func(ctx context.Context) {
+		s.configMu.RLock()
+		defer s.configMu.RUnlock()
+		result, err = syncf(ctx, key.(string))
+		if s.recordSyncResults {
+			s.annotateSyncResult(qName, key.(string), result, err)
+		}
+	})
+	span.AddAttributes(
+		trace.StringAttribute("result", string(result)),
+		trace.StringAttribute("operations", calls.String()),
+	)
+	attrs := map[string]string{
+		"crd":       s.crd.GetName(),
+		"key":       key.(string),
+		"direction": qName,
+		"result":    string(result),
+	}
+	event := reconcileEvent{
+		Time:      time.Now(),
+		CRD:       s.crd.GetName(),
+		Key:       key.(string),
+		Direction: qName,
+		Result:    result,
+	}
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+		attrs["error"] = err.Error()
+		event.Error = err.Error()
+		s.eventLog.emit(ctx, severityWarn, "reconcile failed", attrs)
+	} else if result != ResultUnchanged {
+		// No-op syncs, eg on resyncs, aren't logged, as they would
+		// drown the writes.
+		s.eventLog.emit(ctx, severityInfo, "reconciled", attrs)
+	}
+	s.eventStream.publish(event)
+	span.End()
+	s.observer.OnReconcile(key.(string), qName, result, err)
+	stats.Record(ctx, mSyncs.M(1), mSyncDuration.M(time.Since(start).Seconds()))
 	if err == nil {
+		s.recordSuccess(time.Now())
 		q.Forget(key)
+		s.networkRetry.Forget(qName + "/" + key.(string))
 		return true
 	}
 	// Synchronization failed, retry later.
 	stats.Record(ctx, mSyncErrors.M(1))
 	log.Printf("Syncing key %q from queue %q failed: %v", key, qName, err)
+	if _, ok := err.(admissionRejectedError); ok {
+		// Retrying quickly won't help, the webhook will likely reject
+		// the object again.
+		stats.Record(ctx, mAdmissionRejections.M(1))
+		q.Forget(key)
+		q.AddAfter(key, admissionRejectedBackoff)
+		return true
+	}
+	if isNetworkError(err) {
+		s.retryNetworkError(ctx, q, key, qName)
+		return true
+	}
+	stats.Record(ctx, mAPIErrors.M(1))
 	q.AddRateLimited(key)
 
 	return true
@@ -292,12 +1325,33 @@ func (s *crSyncer) processNextWorkItem(
 func (s *crSyncer) run() {
 	defer s.upstreamQueue.ShutDown()
 	defer s.downstreamQueue.ShutDown()
+	defer s.shutDownBackups()
 
+	start := time.Now()
 	log.Printf("Starting syncer for %s", s.crd.GetName())
+	s.eventLog.emit(context.Background(), severityInfo, "syncer started", map[string]string{"crd": s.crd.GetName()})
 
+	if !s.waitForRemoteCRD() {
+		return
+	}
+	if s.statusState != nil {
+		go s.saveStatusState()
+	}
 	// Start informers that will populate their associated workqueue.
+	go s.superviseInformers()
+	go s.reportReadiness()
 	if err := s.startInformers(); err != nil {
-		log.Printf("Starting informers for %s failed: %s", s.crd.GetName(), err)
+		select {
+		case <-s.done:
+			log.Printf("Starting informers for %s failed: %s", s.crd.GetName(), err)
+			return
+		default:
+			// The informers were restarted and the new ones are
+			// started by superviseInformers.
+		}
+	}
+	s.recordReadiness()
+	if !s.waitStartupDelay(start) {
 		return
 	}
 
@@ -306,48 +1360,123 @@ func (s *crSyncer) run() {
 		panic(err)
 	}
 	// Process the upstream and downstream work queues.
-	go func() {
-		for s.processNextWorkItem(ctx, s.upstreamQueue, s.syncUpstream, "upstream") {
-		}
-	}()
-	go func() {
-		for s.processNextWorkItem(ctx, s.downstreamQueue, s.syncDownstream, "downstream") {
-		}
-	}()
+	s.runWorkers(ctx, s.initialWorkers, s.workers, s.upstreamQueue, s.reconcileUpstream, "upstream")
+	s.runWorkers(ctx, s.initialWorkers, s.workers, s.downstreamQueue, s.reconcileDownstream, "downstream")
+	s.runBackupWorkers()
 	<-s.done
 }
 
 func (s *crSyncer) stop() {
 	log.Printf("Stopping syncer for %s", s.crd.GetName())
+	s.eventLog.emit(context.Background(), severityInfo, "syncer stopped", map[string]string{"crd": s.crd.GetName()})
+	s.configMu.Lock()
 	close(s.done)
+	close(s.informersDone)
+	s.configMu.Unlock()
+	if err := s.statusState.save(); err != nil {
+		log.Printf("Saving status state for %s failed: %s", s.crd.GetName(), err)
+	}
 }
 
-// syncDownstream reconciles state after receiving change events from the
+// statusIsSubresource returns true if the CRD defines status as a subresource.
+func (s *crSyncer) statusIsSubresource() bool {
+	return s.crd.Spec.Subresources != nil && s.crd.Spec.Subresources.Status != nil
+}
+
+// disableGenerationFeatures turns off the features that wait for
+// status.observedGeneration if the CRD doesn't declare status as a
+// subresource. Generation tracking is disabled then, so the observed
+// generation can't be relied on and the status might never be synced.
+func (s *crSyncer) disableGenerationFeatures() {
+	if s.statusIsSubresource() {
+		return
+	}
+	for _, f := range []struct {
+		annotation string
+		enabled    *bool
+	}{
+		{annotationRequireObservedGeneration, &s.requireObservedGeneration},
+		{annotationDeferInitialStatus, &s.deferInitialStatusSync},
+	} {
+		if *f.enabled {
+			log.Printf("Warning: Ignoring %s on %s: it requires status to be declared as a subresource",
+				f.annotation, s.crd.GetName())
+			*f.enabled = false
+		}
+	}
+}
+
+// resync synchronizes a single object in both directions, given the key of
+// the upstream object.
+func (s *crSyncer) resync(key string) (upstreamErr, downstreamErr error) {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.syncUpstream(key), s.syncDownstream(s.downstreamKey(key))
+}
+
+// syncDownstream is like reconcileDownstream, but only returns the error.
+func (s *crSyncer) syncDownstream(key string) error {
+	_, err := s.reconcileDownstream(context.Background(), key)
+	return err
+}
+
+// reconcileDownstream reconciles state after receiving change events from the
 // downstream cluster. It synchronizes the status from the downstream to the
 // upstream cluster, and deletes orphaned downstream resources.
-func (s *crSyncer) syncDownstream(key string) error {
-	var (
-		statusIsSubresource = s.crd.Spec.Subresources != nil && s.crd.Spec.Subresources.Status != nil
-	)
+func (s *crSyncer) reconcileDownstream(ctx context.Context, key string) (Result, error) {
+	key = s.resolveKey(key, s.downstreamInf, s.upstreamInf, s.upstreamKey, s.downstreamKey)
+	if s.isExcludedDownstream(key) {
+		return ResultUnchanged, nil
+	}
 	// Get the downstream status (src) and upstream spec (dst).
-	srcObj, srcExists, err := s.downstreamInf.GetIndexer().GetByKey(key)
+	src, srcExists, err := s.getObject(s.downstreamInf, s.downstream, key)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve resource for key %s: %s", key, err)
+		return ResultFailed, fmt.Errorf("failed to retrieve resource for key %s: %s", key, err)
 	}
 	if !srcExists {
 		// The downstream resource has been deleted: possibly because
 		// the upstream resource was deleted and recreated. Add this to
 		// the upstream queue so that syncUpstream() can check if it needs
 		// to recreate the downstream resource.
-		s.upstreamQueue.Add(key)
-		return nil
+		s.events.forget(key)
+		s.conflicts.forget(key)
+		s.changeEvents.forget("downstream/" + key)
+		s.changeEvents.forget("upstream/" + s.upstreamKey(key))
+		s.statusState.forget(key)
+		s.upstreamQueue.Add(s.upstreamKey(key))
+		return ResultUnchanged, nil
+	}
+	if s.isForeign(src) {
+		// Neither sync the status of foreign objects, nor delete them.
+		return ResultUnchanged, nil
+	}
+	if s.skipPaused("downstream", key, src) {
+		return ResultUnchanged, nil
 	}
-	src := srcObj.(*unstructured.Unstructured).DeepCopy()
-	removeFinalizer(s.downstream, src, s.clusterName)
+	downstream := s.downstream.Namespace(src.GetNamespace())
+	removeStaleFinalizers(downstream, src, s.clusterName)
 
-	dstObj, dstExists, err := s.upstreamInf.GetIndexer().GetByKey(key)
+	upstreamKey := s.upstreamKey(key)
+	upstreamNs, _, _ := cache.SplitMetaNamespaceKey(upstreamKey)
+	if k := s.counterpartKey(s.upstreamInf, upstreamNs, src); k != "" {
+		upstreamKey = k
+	}
+	dst, dstExists, err := s.getObject(s.upstreamInf, s.upstream, upstreamKey)
+	if err == nil && !dstExists {
+		// The cache may lag behind the API server, so make sure that the
+		// object is really gone before deleting its downstream copy.
+		end := s.traceCall(ctx, "get")
+		dst, dstExists, err = s.getLiveObject(s.upstream, upstreamKey)
+		end(err)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to retrieve resource for key %s: %s", key, err)
+		return ResultFailed, fmt.Errorf("failed to retrieve resource for key %s: %s", key, err)
+	}
+	if dstExists && s.isGated(dst) {
+		return ResultUnchanged, nil
+	}
+	if dstExists && s.skipPaused("downstream", key, dst) {
+		return ResultUnchanged, nil
 	}
 	// If the upstream resource no longer exists, delete the downstream
 	// resource. Normally, this occurs when syncUpstream() handles the
@@ -356,21 +1485,139 @@ func (s *crSyncer) syncDownstream(key string) error {
 	// hit this condition.
 	if !dstExists {
 		if src.GetDeletionTimestamp() != nil {
-			return nil // Already being deleted.
+			return ResultUnchanged, nil // Already being deleted.
 		}
-		if err := s.downstream.Delete(src.GetName(), nil); err != nil {
+		end := s.traceCall(ctx, "delete")
+		err := downstream.Delete(src.GetName(), s.downstreamDeleteOptions())
+		end(err)
+		if err != nil {
 			if isNotFoundError(err) {
-				return nil
+				return ResultUnchanged, nil
 			}
-			return fmt.Errorf("delete resource: %s", err)
+			return ResultFailed, fmt.Errorf("delete resource: %s", err)
 		}
-		return nil
+		return ResultDeleted, nil
+	}
+
+	if owner := ownerOf(src); owner != "" && owner != s.specSource {
+		if ownerOf(dst) == owner {
+			// The object has been handed off and the downstream
+			// cluster is the source of its spec.
+			if err := s.copySpecReversed(src, dst); err != nil {
+				return ResultFailed, err
+			}
+			return ResultUpdated, nil
+		}
+		// The hand-off is driven by syncUpstream().
+		s.upstreamQueue.Add(upstreamKey)
+		return ResultUnchanged, nil
+	}
+
+	s.copyEvents(key, src, dst)
+
+	if s.requireObservedGeneration && !observedCurrentGeneration(src) {
+		log.Printf("Not copying %s %s status: generation %d not observed yet",
+			src.GetKind(), src.GetName(), src.GetGeneration())
+		return ResultUnchanged, nil
+	}
+	if s.deferInitialStatus(key, src) {
+		return ResultUnchanged, nil
+	}
+
+	if wait := s.deferStatus(key, src, dst); wait > 0 {
+		// Only batched fields changed, sync them later together with
+		// any other changes.
+		s.downstreamQueue.AddAfter(key, wait)
+		return ResultUnchanged, nil
+	}
+	if wait := s.statusWriteDelay(key); wait > 0 {
+		// The status was written recently, write the latest status
+		// once the minimum interval has passed.
+		s.downstreamQueue.AddAfter(key, wait)
+		return ResultUnchanged, nil
+	}
+
+	if s.statusState.unchanged(key, src.GetResourceVersion(), dst.GetResourceVersion()) {
+		// Neither object changed since the status was last written,
+		// eg before a restart.
+		return ResultUnchanged, nil
+	}
+	s.checkResourceVersionAnnotation(key, dst)
+	if wait := s.conflictWait(key, src, dst); wait > 0 {
+		// Give the other writer a chance to settle instead of
+		// fighting over the status.
+		s.downstreamQueue.AddAfter(key, wait)
+		return ResultUnchanged, nil
+	}
+	var before *unstructured.Unstructured
+	if s.audit != nil || s.recordChangeEvents {
+		before = dst.DeepCopy()
 	}
-	dst := dstObj.(*unstructured.Unstructured).DeepCopy()
 
 	// Copy full status or subtree from src to dst.
-	if s.subtree == "" {
-		dst.Object["status"] = src.Object["status"]
+	if err := s.copyStatus(src, dst); err != nil {
+		return ResultFailed, err
+	}
+	if err := s.checkObjectSize(dst); err != nil {
+		s.skipOversized(upstreamKey, dst, dst, err)
+		return ResultUnchanged, nil
+	}
+	end := s.traceCall(ctx, "updatestatus")
+	updated, err := s.updateUpstreamStatus(dst)
+	end(err)
+	if isConflictError(err) {
+		// The cached upstream object is outdated. Retry once with the
+		// latest version from the API server.
+		end := s.traceCall(ctx, "get")
+		live, exists, getErr := s.getLiveObject(s.upstream, upstreamKey)
+		end(getErr)
+		if getErr != nil {
+			return ResultFailed, fmt.Errorf("failed to retrieve resource for key %s: %s", key, getErr)
+		}
+		if !exists {
+			return ResultUnchanged, nil
+		}
+		if err := s.copyStatus(src, live); err != nil {
+			return ResultFailed, err
+		}
+		dst = live
+		end = s.traceCall(ctx, "updatestatus")
+		updated, err = s.updateUpstreamStatus(dst)
+		end(err)
+	}
+	if err != nil {
+		return ResultFailed, newAPIErrorf(dst, "update status failed: %s", err)
+	}
+	if s.verifyStatus {
+		s.verifyStatusWrite(upstreamKey, dst)
+	}
+	dst = s.clearForceFullStatus(updated)
+	s.recordSelfWrite(s.upstreamKey(key), dst.GetResourceVersion())
+	s.conflicts.recordWrite(key, dst.GetAnnotations()[annotationResourceVersion])
+	s.statusState.record(key, src.GetResourceVersion(), dst.GetResourceVersion())
+	s.audit.record(s.crd.GetName(), key, "downstream", ResultUpdated, before, dst)
+	s.recordChangeEvent(s.upstreamEvents, key, "downstream", before, dst)
+	s.recordStatusSync(key)
+	s.setOversized(upstreamKey, dst, "")
+	log.Printf("Copied %s %s status@v%s to upstream@v%s",
+		src.GetKind(), src.GetName(), src.GetResourceVersion(), dst.GetResourceVersion())
+	return ResultUpdated, nil
+}
+
+// copyStatus copies the full status or the configured subtree from the
+// downstream object src to the upstream object dst.
+func (s *crSyncer) copyStatus(src, dst *unstructured.Unstructured) error {
+	if s.subtree == "" || forceFullStatus(dst) {
+		// A downstream object without status, eg one whose controller
+		// hasn't run yet, doesn't clobber the upstream status.
+		if src.Object["status"] != nil || s.clearStatusWhenEmpty {
+			dst.Object["status"] = src.Object["status"]
+		}
+		// Without a status subresource, the annotation is removed
+		// with the status update.
+		if !s.statusIsSubresource() {
+			deleteAnnotation(dst, annotationForceFullStatus)
+		}
 	} else if src.Object["status"] != nil {
 		srcStatus, ok := src.Object["status"].(map[string]interface{})
 		if !ok {
@@ -383,124 +1630,417 @@ func (s *crSyncer) syncDownstream(key string) error {
 		if !ok {
 			return fmt.Errorf("Expected status of %s in upstream cluster to be a dict", src.GetName())
 		}
-		if srcStatus[s.subtree] != nil {
-			dstStatus[s.subtree] = srcStatus[s.subtree]
+		path := strings.Split(s.subtree, ".")
+		v, found, err := unstructured.NestedFieldNoCopy(srcStatus, path...)
+		if err != nil {
+			return fmt.Errorf("Expected status subtree %s of %s in downstream cluster to be a dict: %s", s.subtree, src.GetName(), err)
+		}
+		if found && v != nil {
+			if s.subtreeTransform != nil {
+				if v, err = s.subtreeTransform(v); err != nil {
+					return fmt.Errorf("failed to transform status subtree %s of %s: %s", s.subtree, src.GetName(), err)
+				}
+			}
+			if s.compressSubtree {
+				if v, err = compressSubtree(v); err != nil {
+					return fmt.Errorf("failed to compress status subtree %s of %s: %s", s.subtree, src.GetName(), err)
+				}
+			}
+			if err := unstructured.SetNestedField(dstStatus, v, path...); err != nil {
+				return fmt.Errorf("Expected status subtree %s of %s in upstream cluster to be a dict: %s", s.subtree, src.GetName(), err)
+			}
 		} else {
-			delete(dstStatus, s.subtree)
+			unstructured.RemoveNestedField(dstStatus, path...)
 		}
 	}
 	setAnnotation(dst, annotationResourceVersion, src.GetResourceVersion())
+	s.markSyncedBy(dst)
+	return nil
+}
+
+// verifyStatusWrite reads back the upstream object after its status was
+// written and checks that the status matches what was written. As status
+// and annotations are written in separate requests if status is a
+// subresource, the write isn't atomic. Mismatches are logged and counted.
+func (s *crSyncer) verifyStatusWrite(upstreamKey string, written *unstructured.Unstructured) {
+	live, exists, err := s.getLiveObject(s.upstream, upstreamKey)
+	if err != nil {
+		log.Printf("Failed to read back %s %s: %s", written.GetKind(), written.GetName(), err)
+		return
+	}
+	if exists && reflect.DeepEqual(s.syncedStatusValue(live), s.syncedStatusValue(written)) {
+		return
+	}
+	log.Printf("Status of %s %s doesn't match the written status after update",
+		written.GetKind(), written.GetName())
+	ctx, err := tag.New(context.Background(), tag.Insert(tagResource, s.crd.GetName()))
+	if err != nil {
+		panic(err)
+	}
+	stats.Record(ctx, mStatusMismatches.M(1))
+}
 
+// updateUpstreamStatus writes the status of the upstream object dst.
+func (s *crSyncer) updateUpstreamStatus(dst *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	upstream := s.upstream.Namespace(dst.GetNamespace())
 	// We need to make a dedicated UpdateStatus call if the status is defined
 	// as an explicit subresource of the CRD.
-	if statusIsSubresource {
+	if s.statusIsSubresource() {
 		// Status must not be null/nil.
 		if dst.Object["status"] == nil {
 			dst.Object["status"] = struct{}{}
 		}
-		updated, err := s.upstream.UpdateStatus(dst, metav1.UpdateOptions{})
-		if err != nil {
-			return newAPIErrorf(dst, "update status failed: %s", err)
-		}
-		dst = updated
-	} else {
-		updated, err := s.upstream.Update(dst, metav1.UpdateOptions{})
-		if err != nil {
-			return newAPIErrorf(dst, "update failed: %s", err)
-		}
-		dst = updated
+		return upstream.UpdateStatus(dst, metav1.UpdateOptions{})
 	}
-	log.Printf("Copied %s %s status@v%s to upstream@v%s",
-		src.GetKind(), src.GetName(), src.GetResourceVersion(), dst.GetResourceVersion())
-	return nil
+	return upstream.Update(dst, metav1.UpdateOptions{})
 }
 
-// syncUpstream reconciles the state after receiving a change event from upstream.
+// syncUpstream is like reconcileUpstream, but only returns the error.
+func (s *crSyncer) syncUpstream(key string) error {
+	_, err := s.reconcileUpstream(context.Background(), key)
+	return err
+}
+
+// reconcileUpstream reconciles the state after receiving a change event from upstream.
 // It synchronizes the spec changes from upstream to the downstream cluster and propagates
 // deletions.
-func (s *crSyncer) syncUpstream(key string) error {
+func (s *crSyncer) reconcileUpstream(ctx context.Context, key string) (Result, error) {
+	key = s.resolveKey(key, s.upstreamInf, s.downstreamInf, s.downstreamKey, s.upstreamKey)
+	if s.isExcluded(key) {
+		return ResultUnchanged, nil
+	}
 	// Get the upstream spec (src) and downstream status (dst).
 	src := &unstructured.Unstructured{make(map[string]interface{})}
 	dst := &unstructured.Unstructured{make(map[string]interface{})}
-	srcObj, srcExists, err := s.upstreamInf.GetIndexer().GetByKey(key)
+	srcObj, srcExists, err := s.getObject(s.upstreamInf, s.upstream, key)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve resource for key %s: %s", key, err)
+		return ResultFailed, fmt.Errorf("failed to retrieve resource for key %s: %s", key, err)
+	}
+	if srcExists && s.skipPaused("upstream", key, srcObj) {
+		return ResultUnchanged, nil
+	}
+	if srcExists && srcObj.GetDeletionTimestamp() == nil && s.isGated(srcObj) {
+		if s.syncPredicate.matches(srcObj) {
+			// Deletions are still propagated, as the downstream copy
+			// only exists if the object was synced before.
+			log.Printf("Skipping %s %s: missing %s=%s label", s.crd.GetName(), key, labelSyncGate, labelSyncGateEnabled)
+			return ResultUnchanged, nil
+		}
+		if !s.deleteUnmatched {
+			log.Printf("Skipping %s %s: doesn't match sync predicate %s", s.crd.GetName(), key, s.syncPredicate)
+			return ResultUnchanged, nil
+		}
+		// The object doesn't match the sync predicate (anymore), so its
+		// downstream copy is deleted as if it had been deleted upstream.
+		srcExists = false
 	}
 	if srcExists {
-		src = srcObj.(*unstructured.Unstructured).DeepCopy()
-		removeFinalizer(s.upstream, src, s.clusterName)
+		src = srcObj
+		removeStaleFinalizers(s.upstream.Namespace(src.GetNamespace()), src, s.clusterName)
 	}
-	dstObj, dstExists, err := s.downstreamInf.GetIndexer().GetByKey(key)
+	downstreamKey := s.downstreamKey(key)
+	downstreamNs, _, _ := cache.SplitMetaNamespaceKey(downstreamKey)
+	if k := s.counterpartKey(s.downstreamInf, downstreamNs, src); k != "" {
+		downstreamKey = k
+	}
+	dstObj, dstExists, err := s.getObject(s.downstreamInf, s.downstream, downstreamKey)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve resource for key %s: %s", key, err)
+		return ResultFailed, fmt.Errorf("failed to retrieve resource for key %s: %s", key, err)
 	}
 	if dstExists {
-		dst = dstObj.(*unstructured.Unstructured).DeepCopy()
+		dst = dstObj
+	}
+	if dstExists && s.isForeign(dst) {
+		log.Printf("Skipping %s %s: downstream object wasn't created by cr-syncer and lacks %s", s.crd.GetName(), key, annotationOwnedByUpstream)
+		return ResultUnchanged, nil
+	}
+	if dstExists && s.skipPaused("upstream", key, dst) {
+		return ResultUnchanged, nil
+	}
+	downstream := s.downstream.Namespace(downstreamNs)
+	if srcExists && dstExists {
+		// The object was written downstream before.
+		if err := s.releaseGuard(key, src); err != nil {
+			return ResultFailed, err
+		}
+	}
+
+	if srcExists && dstExists && src.GetDeletionTimestamp() == nil {
+		if handedOff, result, err := s.handOff(key, src, dst); handedOff {
+			return result, err
+		}
 	}
 
 	// Check if the downstream resource (dst) should be created, updated,
 	// or deleted. If we don't need to create/update dst, return early.
 	var createOrUpdate func(*unstructured.Unstructured) (*unstructured.Unstructured, error)
+	var result Result
 	switch {
 	case !srcExists && !dstExists:
 		// Both deleted, nothing to do.
-		return nil
+		s.forgetStuckDeletion(key)
+		return ResultUnchanged, nil
 	case srcExists && !dstExists:
+		s.forgetStuckDeletion(key)
+		if s.isTooOld(src) {
+			log.Printf("Skipping %s %s: last modified more than %s ago", s.crd.GetName(), key, s.maxObjectAge)
+			return ResultUnchanged, nil
+		}
+		if err := s.addGuard(key, src); err != nil {
+			return ResultFailed, err
+		}
 		// Create object and set base fields.
+		result = ResultCreated
 		createOrUpdate = func(o *unstructured.Unstructured) (*unstructured.Unstructured, error) {
-			o.SetGroupVersionKind(src.GroupVersionKind())
-			o.SetNamespace(src.GetNamespace())
+			gvk := src.GroupVersionKind()
+			gvk.Group = s.downstreamGroup
+			o.SetGroupVersionKind(gvk)
 			o.SetName(src.GetName())
 			// Copy upstream status on initial creation.
 			o.Object["status"] = src.Object["status"]
+			if err := s.ensureNamespace(src, downstreamNs); err != nil {
+				return nil, err
+			}
 
-			return s.downstream.Create(o, metav1.CreateOptions{})
+			end := s.traceCall(ctx, "create")
+			created, err := downstream.Create(o, metav1.CreateOptions{})
+			end(err)
+			if isNotFoundError(err) && s.createNamespace {
+				// The namespace was deleted since it was last
+				// checked, create it again on the retry.
+				s.namespaces.forget(downstreamNs)
+			}
+			return created, err
 		}
 	case srcExists && dstExists:
 		// Update dst.
+		result = ResultUpdated
 		createOrUpdate = func(o *unstructured.Unstructured) (*unstructured.Unstructured, error) {
-			return s.downstream.Update(o, metav1.UpdateOptions{})
+			end := s.traceCall(ctx, "update")
+			updated, err := downstream.Update(o, metav1.UpdateOptions{})
+			end(err)
+			return updated, err
 		}
 	case !srcExists && dstExists:
-		// Delete dst.
-		if err := s.downstream.Delete(dst.GetName(), nil); err != nil {
+		// Delete dst, unless the upstream object was renamed and dst is
+		// the copy of the object with the new name.
+		upstreamNs, _, _ := cache.SplitMetaNamespaceKey(key)
+		if k := s.counterpartKey(s.upstreamInf, upstreamNs, dst); k != "" && k != key {
+			log.Printf("Not deleting %s %s: it's the copy of %s", s.crd.GetName(), downstreamKey, k)
+			s.upstreamQueue.Add(k)
+			return ResultUnchanged, nil
+		}
+		if dst.GetDeletionTimestamp() != nil {
+			s.checkStuckDeletion(key, nil, dst)
+			return ResultUnchanged, nil // Already being deleted.
+		}
+		if deferred, err := s.deferDeletion(key, dst, downstreamNs); err != nil {
+			return ResultFailed, err
+		} else if deferred {
+			return ResultUnchanged, nil
+		}
+		end := s.traceCall(ctx, "delete")
+		err := downstream.Delete(dst.GetName(), s.downstreamDeleteOptions())
+		end(err)
+		if err != nil {
 			if isNotFoundError(err) {
-				return nil
+				return ResultUnchanged, nil
 			}
-			return newAPIErrorf(dst, "downstream delete failed: %s", err)
+			return ResultFailed, newAPIErrorf(dst, "downstream delete failed: %s", err)
 		}
-		return nil
+		s.deleteReferencedSecret(dst, downstreamNs)
+		s.deleteConfigMapProjection(dst, downstreamNs)
+		return ResultDeleted, nil
 	default:
 		log.Fatalf("unhandled condition: srcExists=%t, dstExists=%t", srcExists, dstExists)
-		return nil
+		return ResultUnchanged, nil
 	}
 
 	// Before creating/updating, check if deletion is in progress. This
 	// is checked separately to src/dstExists for readability (hopefully).
-	if src.GetDeletionTimestamp() != nil {
-		if err := s.downstream.Delete(src.GetName(), nil); err != nil {
+	// Guarded objects are created before their deletion is propagated.
+	if src.GetDeletionTimestamp() != nil && !s.awaitsFirstSync(src, dstExists) {
+		if dstExists && dst.GetDeletionTimestamp() != nil {
+			// Don't send another Delete while the finalizers of dst
+			// are running.
+			s.checkStuckDeletion(key, src, dst)
+			return ResultUnchanged, nil
+		}
+		if dstExists {
+			if deferred, err := s.deferDeletion(key, src, downstreamNs); err != nil {
+				return ResultFailed, err
+			} else if deferred {
+				return ResultUnchanged, nil
+			}
+		}
+		end := s.traceCall(ctx, "delete")
+		err := downstream.Delete(src.GetName(), s.downstreamDeleteOptions())
+		end(err)
+		if err != nil {
 			if isNotFoundError(err) {
-				return nil
+				return ResultUnchanged, nil
 			}
-			return newAPIErrorf(dst, "downstream delete failed: %s", err)
+			return ResultFailed, newAPIErrorf(dst, "downstream delete failed: %s", err)
 		}
-		return nil
+		s.deleteReferencedSecret(src, downstreamNs)
+		s.deleteConfigMapProjection(src, downstreamNs)
+		return ResultDeleted, nil
 	}
 
 	// Create/update dst with the labels+annotations+spec of src.
-	dst.SetLabels(src.GetLabels())
-	dst.SetAnnotations(src.GetAnnotations())
-	dst.Object["spec"] = src.Object["spec"]
+	old := dst.DeepCopy()
+	if err := s.applySpec(src, old, dst, dstExists); err != nil {
+		return ResultFailed, newAPIErrorf(src, "failed to transform object: %s", err)
+	}
 
-	// The remote-resource-version annotation is removed from dst to
-	// prevent an infinite loop, because changing the annotation would
-	// change the resource version.
-	deleteAnnotation(dst, annotationResourceVersion)
+	if dstExists && onlyLabelsChanged(old, dst) {
+		// Patch the labels instead of sending the full object, which is
+		// smaller and can't conflict with changes to other fields.
+		createOrUpdate = func(o *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+			patch, err := labelsPatch(old, o)
+			if err != nil {
+				return nil, err
+			}
+			end := s.traceCall(ctx, "patch")
+			patched, err := downstream.Patch(o.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+			end(err)
+			return patched, err
+		}
+	}
+
+	if s.validateSchema {
+		if err := s.validateDownstream(dst); err != nil {
+			if _, ok := err.(schemaViolationError); !ok {
+				// The schema couldn't be loaded, retry.
+				return ResultFailed, newAPIErrorf(src, "failed to validate object: %s", err)
+			}
+			// Writing the object would fail on every attempt, so we
+			// skip it until the next change instead of retrying.
+			log.Printf("Skipping sync of %s: %s", key, err)
+			return ResultUnchanged, nil
+		}
+	}
+	if err := s.checkObjectSize(dst); err != nil {
+		// Like for invalid objects, retrying won't help until the
+		// object changes.
+		s.skipOversized(key, dst, src, err)
+		return ResultUnchanged, nil
+	}
 
+	// Mirror the referenced Secret first, so that it exists once the
+	// downstream controller sees the object.
+	if err := s.mirrorReferencedSecret(src, downstreamNs); err != nil {
+		return ResultFailed, newAPIErrorf(src, "failed to mirror referenced secret: %s", err)
+	}
 	if _, err = createOrUpdate(dst); err != nil {
-		return newAPIErrorf(dst, "failed to create or update downstream: %s", err)
+		if isAdmissionRejection(err) {
+			s.setAdmissionRejected(key, src, err.Error())
+			return ResultFailed, admissionRejectedError{newAPIErrorf(dst, "rejected by admission webhook: %s", err)}
+		}
+		return ResultFailed, newAPIErrorf(dst, "failed to create or update downstream: %s", err)
 	}
-	return nil
+	s.setAdmissionRejected(key, src, "")
+	s.setOversized(key, src, "")
+	if err := s.releaseGuard(key, src); err != nil {
+		return ResultFailed, err
+	}
+	s.audit.record(s.crd.GetName(), key, "upstream", result, old, dst)
+	if result == ResultUpdated {
+		s.recordChangeEvent(s.downstreamEvents, key, "upstream", old, dst)
+	}
+	if err := s.projectToConfigMap(src, downstreamNs); err != nil {
+		return ResultFailed, newAPIErrorf(src, "failed to project spec to ConfigMap: %s", err)
+	}
+	s.mirrorToBackups(src)
+	return result, nil
+}
+
+// applySpec sets the labels, annotations and spec of the downstream object
+// dst to those of the upstream object src by applying the spec pipeline. old
+// is dst before the change.
+func (s *crSyncer) applySpec(src, old, dst *unstructured.Unstructured, dstExists bool) error {
+	if !dstExists {
+		old = nil
+	}
+	return s.pipeline.transform(src, old, dst)
+}
+
+// downstreamValidator returns the schema validator for the CRD in the
+// downstream cluster. The validator is cached and reloaded once per resync
+// period, so that schema changes in the remote cluster are picked up.
+func (s *crSyncer) downstreamValidator() (*validate.SchemaValidator, error) {
+	s.validatorMu.Lock()
+	defer s.validatorMu.Unlock()
+	if !s.validatorTime.IsZero() && time.Since(s.validatorTime) < resyncPeriod {
+		return s.validator, nil
+	}
+	u, err := s.downstreamCRDs.Get(s.downstreamCRDName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get downstream CRD %s: %s", s.downstreamCRDName, err)
+	}
+	var crd crdtypes.CustomResourceDefinition
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &crd); err != nil {
+		return nil, fmt.Errorf("failed to parse downstream CRD %s: %s", s.downstreamCRDName, err)
+	}
+	schema := crdSchema(crd, s.crd.Spec.Version)
+	var validator *validate.SchemaValidator
+	if schema != nil {
+		var internal apiextensions.CustomResourceValidation
+		if err := crdtypes.Convert_v1beta1_CustomResourceValidation_To_apiextensions_CustomResourceValidation(schema, &internal, nil); err != nil {
+			return nil, fmt.Errorf("failed to convert schema of downstream CRD %s: %s", s.crd.GetName(), err)
+		}
+		validator, _, err = validation.NewSchemaValidator(&internal)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema in downstream CRD %s: %s", s.crd.GetName(), err)
+		}
+	}
+	s.validator = validator
+	s.validatorTime = time.Now()
+	return validator, nil
+}
+
+// schemaViolationError is returned by validateDownstream if the object
+// violates the downstream schema, as opposed to the schema failing to load.
+type schemaViolationError struct {
+	msg string
+}
+
+func (e schemaViolationError) Error() string {
+	return e.msg
+}
+
+// validateDownstream checks the object against the schema of the CRD in the
+// downstream cluster and returns a schemaViolationError describing all
+// violations.
+func (s *crSyncer) validateDownstream(o *unstructured.Unstructured) error {
+	validator, err := s.downstreamValidator()
+	if err != nil {
+		return err
+	}
+	if validator == nil {
+		return nil
+	}
+	result := validator.Validate(o.UnstructuredContent())
+	if result.IsValid() {
+		return nil
+	}
+	msgs := []string{}
+	for _, e := range result.Errors {
+		msgs = append(msgs, e.Error())
+	}
+	return schemaViolationError{fmt.Sprintf("%s %s violates downstream schema: %s",
+		o.GetKind(), o.GetName(), strings.Join(msgs, "; "))}
+}
+
+// observedCurrentGeneration returns true if status.observedGeneration of the
+// object matches its metadata.generation, ie if its controller has processed
+// the latest spec.
+func observedCurrentGeneration(o *unstructured.Unstructured) bool {
+	observed, found, err := unstructured.NestedInt64(o.Object, "status", "observedGeneration")
+	if err != nil || !found {
+		return false
+	}
+	return observed == o.GetGeneration()
 }
 
 func isNotFoundError(err error) bool {
@@ -508,6 +2048,11 @@ func isNotFoundError(err error) bool {
 	return ok && status.ErrStatus.Code == http.StatusNotFound
 }
 
+func isConflictError(err error) bool {
+	status, ok := err.(*errors.StatusError)
+	return ok && status.ErrStatus.Code == http.StatusConflict
+}
+
 type apiError struct {
 	o   *unstructured.Unstructured
 	msg string
@@ -532,6 +2077,68 @@ func keyFunc(obj interface{}) (string, bool) {
 	return k, true
 }
 
+// onlyLabelsChanged returns true if the labels of the objects differ, but
+// everything else is equal.
+func onlyLabelsChanged(old, new *unstructured.Unstructured) bool {
+	if reflect.DeepEqual(old.GetLabels(), new.GetLabels()) {
+		return false
+	}
+	old, new = old.DeepCopy(), new.DeepCopy()
+	old.SetLabels(nil)
+	new.SetLabels(nil)
+	return reflect.DeepEqual(old.Object, new.Object)
+}
+
+// labelsPatch returns a JSON merge patch that changes the labels of old to
+// those of new.
+func labelsPatch(old, new *unstructured.Unstructured) ([]byte, error) {
+	labels := map[string]interface{}{}
+	for k := range old.GetLabels() {
+		labels[k] = nil // Removes the label.
+	}
+	for k, v := range new.GetLabels() {
+		labels[k] = v
+	}
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": labels,
+		},
+	})
+}
+
+// copySpec copies the spec from src to dst. Objects of status-only CRDs
+// have no spec, so it is left unset instead of being set to null, which
+// might violate the schema.
+func copySpec(src, dst *unstructured.Unstructured) {
+	spec, ok := src.Object["spec"]
+	if !ok {
+		if *verbose {
+			log.Printf("%s %s has no spec, not copying it", src.GetKind(), src.GetName())
+		}
+		return
+	}
+	dst.Object["spec"] = spec
+}
+
+// copySpecSubtree copies the spec subtree from src to dst and keeps the
+// other fields of the dst spec, eg a per-cluster section that is only set
+// downstream.
+func (s *crSyncer) copySpecSubtree(src, dst *unstructured.Unstructured) error {
+	path := strings.Split(s.specSubtree, ".")
+	v, found, err := unstructured.NestedFieldCopy(src.Object, append([]string{"spec"}, path...)...)
+	if err != nil {
+		return fmt.Errorf("expected spec subtree %s of %s in upstream cluster to be a dict: %s", s.specSubtree, src.GetName(), err)
+	}
+	if !found {
+		unstructured.RemoveNestedField(dst.Object, append([]string{"spec"}, path...)...)
+		return nil
+	}
+	if err := unstructured.SetNestedField(dst.Object, v, append([]string{"spec"}, path...)...); err != nil {
+		return fmt.Errorf("expected spec subtree %s of %s in downstream cluster to be a dict: %s", s.specSubtree, src.GetName(), err)
+	}
+	return nil
+}
+
 func setAnnotation(o *unstructured.Unstructured, key, value string) {
 	annotations := o.GetAnnotations()
 	if annotations == nil {
@@ -0,0 +1,179 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// Benchmarks for the sync hot path. Run them with
+//
+//   bazel run //src/go/cmd/cr-syncer:go_default_test -- \
+//       -test.run=NONE -test.bench=. -test.benchmem
+//
+// Each benchmark reports the time and allocations per reconcile of a single
+// object for a given spec or status size. The objects are put into the
+// informer caches directly and written to fake clients, so the numbers cover
+// the syncer's own work (copying, conversion, bookkeeping) and the fake
+// client's deep copies, but no network or API server latency. Compare results
+// of the same machine only, eg with benchstat, and look at allocs/op first:
+// it's the most stable metric and the one that grows with object size.
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sfake "k8s.io/client-go/dynamic/fake"
+)
+
+// Sizes of the spec or status payload in bytes.
+var benchmarkSizes = []int{1 << 10, 16 << 10, 256 << 10}
+
+// benchmarkPayload returns a payload of roughly the given size, split into
+// fields of 1KiB as typical objects have many small fields.
+func benchmarkPayload(size int, value string) map[string]interface{} {
+	p := map[string]interface{}{}
+	for i := 0; i*1024 < size; i++ {
+		field := make([]byte, 1024)
+		for j := range field {
+			field[j] = value[j%len(value)]
+		}
+		p[fmt.Sprintf("field%d", i)] = string(field)
+	}
+	return p
+}
+
+// newBenchmarkSyncer returns a syncer with fake clients holding the given
+// objects. The objects are added to the informer caches without starting
+// the informers.
+func newBenchmarkSyncer(b *testing.B, local, remote []*unstructured.Unstructured) *crSyncer {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	s := runtime.NewScheme()
+	s.AddKnownTypeWithName(schema.GroupVersionKind{
+		Group:   crd.Spec.Group,
+		Version: crd.Spec.Version,
+		Kind:    crd.Spec.Names.Kind,
+	}, &unstructured.Unstructured{})
+	toObjects := func(objs []*unstructured.Unstructured) (ret []runtime.Object) {
+		for _, o := range objs {
+			ret = append(ret, o.DeepCopy())
+		}
+		return ret
+	}
+	crs, err := newCRSyncer(crd,
+		k8sfake.NewSimpleDynamicClient(s, toObjects(local)...),
+		k8sfake.NewSimpleDynamicClient(s, toObjects(remote)...),
+		"cluster1")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, o := range local {
+		crs.downstreamInf.GetIndexer().Add(o)
+	}
+	for _, o := range remote {
+		crs.upstreamInf.GetIndexer().Add(o)
+	}
+	return crs
+}
+
+// runBenchmarks runs f for each payload size with logging disabled, as the
+// syncer logs every status update.
+func runBenchmarks(b *testing.B, f func(b *testing.B, size int)) {
+	out := log.Writer()
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(out)
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			b.ReportAllocs()
+			f(b, size)
+		})
+	}
+}
+
+func BenchmarkReconcileUpstream_create(b *testing.B) {
+	runBenchmarks(b, func(b *testing.B, size int) {
+		crs := newBenchmarkSyncer(b, nil, nil)
+		defer crs.stop()
+		spec := benchmarkPayload(size, "spec")
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// Use a new object each time, so that it doesn't exist
+			// downstream yet.
+			b.StopTimer()
+			src := newTestCR(fmt.Sprintf("resource%d", i), spec, nil)
+			crs.upstreamInf.GetIndexer().Add(src)
+			b.StartTimer()
+			if _, err := crs.reconcileUpstream(context.Background(), "default/"+src.GetName()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkReconcileUpstream_update(b *testing.B) {
+	runBenchmarks(b, func(b *testing.B, size int) {
+		crs := newBenchmarkSyncer(b,
+			[]*unstructured.Unstructured{newTestCR("resource1", benchmarkPayload(size, "old"), nil)},
+			[]*unstructured.Unstructured{newTestCR("resource1", benchmarkPayload(size, "new"), nil)},
+		)
+		defer crs.stop()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := crs.reconcileUpstream(context.Background(), "default/resource1"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkReconcileUpstream_noop(b *testing.B) {
+	runBenchmarks(b, func(b *testing.B, size int) {
+		spec := benchmarkPayload(size, "spec")
+		crs := newBenchmarkSyncer(b,
+			[]*unstructured.Unstructured{newTestCR("resource1", spec, nil)},
+			[]*unstructured.Unstructured{newTestCR("resource1", spec, nil)},
+		)
+		defer crs.stop()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := crs.reconcileUpstream(context.Background(), "default/resource1"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkReconcileDownstream_status(b *testing.B) {
+	runBenchmarks(b, func(b *testing.B, size int) {
+		crs := newBenchmarkSyncer(b,
+			[]*unstructured.Unstructured{newTestCR("resource1", "spec1", benchmarkPayload(size, "new"))},
+			[]*unstructured.Unstructured{newTestCR("resource1", "spec1", benchmarkPayload(size, "old"))},
+		)
+		defer crs.stop()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := crs.reconcileDownstream(context.Background(), "default/resource1"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
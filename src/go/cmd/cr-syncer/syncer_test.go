@@ -15,16 +15,23 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"log"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"go.opencensus.io/stats/view"
 	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	k8sfake "k8s.io/client-go/dynamic/fake"
 	k8stest "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
@@ -62,6 +69,19 @@ func newFixture(t *testing.T) *fixture {
 }
 
 func (f *fixture) newCRSyncer(crd crdtypes.CustomResourceDefinition, robotName string) (*crSyncer, schema.GroupVersionResource) {
+	gvr := f.newClients(crd)
+	crs, err := newCRSyncer(crd, f.local, f.remote, robotName)
+	if err != nil {
+		f.Fatal(err)
+	}
+	// Tests expect exact objects, independent of the environment.
+	crs.instance = ""
+	return crs, gvr
+}
+
+// newClients creates the fake clients for the local and remote cluster,
+// populated with the objects added to the fixture.
+func (f *fixture) newClients(crd crdtypes.CustomResourceDefinition) schema.GroupVersionResource {
 	gvk := schema.GroupVersionKind{
 		Group:   crd.Spec.Group,
 		Version: crd.Spec.Version,
@@ -69,15 +89,21 @@ func (f *fixture) newCRSyncer(crd crdtypes.CustomResourceDefinition, robotName s
 	}
 	s := runtime.NewScheme()
 	s.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+	if group := crd.ObjectMeta.Annotations[annotationRemoteGroup]; group != "" {
+		remoteGVK := gvk
+		remoteGVK.Group = group
+		s.AddKnownTypeWithName(remoteGVK, &unstructured.Unstructured{})
+	}
+	s.AddKnownTypeWithName(crdtypes.SchemeGroupVersion.WithKind("CustomResourceDefinition"), &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(schema.GroupVersionKind{Version: "v1", Kind: "Event"}, &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, &unstructured.Unstructured{})
 
 	f.local = k8sfake.NewSimpleDynamicClient(s, f.localObjects...)
 	f.remote = k8sfake.NewSimpleDynamicClient(s, f.remoteObjects...)
 
-	crs, err := newCRSyncer(crd, f.local, f.remote, robotName)
-	if err != nil {
-		f.Fatal(err)
-	}
-	return crs, schema.GroupVersionResource{
+	return schema.GroupVersionResource{
 		Group:    crd.Spec.Group,
 		Version:  crd.Spec.Version,
 		Resource: crd.Spec.Names.Plural,
@@ -135,6 +161,8 @@ func sprintAction(a k8stest.Action) string {
 		return fmt.Sprintf("DELETE %s/%s %s/%s", v.Resource, v.Subresource, v.Namespace, v.Name)
 	case k8stest.CreateActionImpl:
 		return fmt.Sprintf("CREATE %s/%s %s/%s: %v", v.Resource, v.Subresource, v.Namespace, v.Name, v.Object.(*unstructured.Unstructured))
+	case k8stest.PatchActionImpl:
+		return fmt.Sprintf("PATCH %s/%s %s/%s: %s", v.Resource, v.Subresource, v.Namespace, v.Name, v.Patch)
 	case k8stest.UpdateActionImpl:
 		return fmt.Sprintf("UPDATE %s/%s %s: %v", v.Resource, v.Subresource, v.Namespace, v.Object.(*unstructured.Unstructured))
 	default:
@@ -196,6 +224,39 @@ func newClusterScopedTestCR(name string, spec, status interface{}) *unstructured
 	return o
 }
 
+func TestEffectiveSpecSource(t *testing.T) {
+	tests := []struct {
+		source     string
+		upstream   Direction
+		downstream Direction
+		wantErr    bool
+	}{
+		{source: "cloud", upstream: DirectionRemote, downstream: DirectionLocal},
+		{source: "robot", upstream: DirectionLocal, downstream: DirectionRemote},
+		{source: "", wantErr: true},
+		{source: "edge", wantErr: true},
+	}
+	for _, tc := range tests {
+		crd := testCRD(crdtypes.NamespaceScoped)
+		crd.ObjectMeta.Annotations[annotationSpecSource] = tc.source
+		upstream, downstream, err := effectiveSpecSource(crd)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("effectiveSpecSource(%q): expected error", tc.source)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("effectiveSpecSource(%q): unexpected error: %v", tc.source, err)
+			continue
+		}
+		if upstream != tc.upstream || downstream != tc.downstream {
+			t.Errorf("effectiveSpecSource(%q) = %s, %s; want %s, %s",
+				tc.source, upstream, downstream, tc.upstream, tc.downstream)
+		}
+	}
+}
+
 func TestSyncUpstream_createSpec(t *testing.T) {
 	crd := testCRD(crdtypes.NamespaceScoped)
 	f := newFixture(t)
@@ -220,6 +281,207 @@ func TestSyncUpstream_createSpec(t *testing.T) {
 	f.verifyWriteActions()
 }
 
+func TestSyncUpstream_strippedCacheReadsFullObject(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	tcrRemote := newTestCR("resource1", map[string]interface{}{"payload": "large"}, "status1")
+	tcrRemote.Object["metadata"].(map[string]interface{})["managedFields"] = []interface{}{
+		map[string]interface{}{"manager": "kubectl"},
+	}
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.cacheStripPaths = [][]string{{"metadata", "managedFields"}, {"spec", "payload"}}
+	crs.startInformers()
+
+	cached, exists, err := crs.upstreamInf.GetIndexer().GetByKey("default/resource1")
+	if err != nil || !exists {
+		t.Fatalf("object not in cache: exists=%t, err=%v", exists, err)
+	}
+	if _, ok := cached.(*unstructured.Unstructured).Object["metadata"].(map[string]interface{})["managedFields"]; ok {
+		t.Errorf("cached object still has managedFields: %v", cached)
+	}
+	if _, ok := cached.(*unstructured.Unstructured).Object["spec"].(map[string]interface{})["payload"]; ok {
+		t.Errorf("cached object still has spec.payload: %v", cached)
+	}
+
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	tcrLocalNew := newTestCR("resource1", map[string]interface{}{"payload": "large"}, "status1")
+
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", tcrLocalNew))
+	f.verifyWriteActions()
+}
+
+func TestSync_metadataOnlyCache(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	f.addRemoteObjects(newTestCR("resource1", "spec1", "status1"))
+	f.addLocalObjects(newTestCR("resource2", "spec2", "status2"))
+	f.addRemoteObjects(newTestCR("resource2", "spec2", nil))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.metadataOnlyCache = true
+	crs.startInformers()
+
+	for _, inf := range []cache.SharedIndexInformer{crs.upstreamInf, crs.downstreamInf} {
+		for _, obj := range inf.GetIndexer().List() {
+			o := obj.(*unstructured.Unstructured)
+			if _, ok := o.Object["spec"]; ok {
+				t.Errorf("cached object %s still has a spec", o.GetName())
+			}
+			if _, ok := o.Object["status"]; ok {
+				t.Errorf("cached object %s still has a status", o.GetName())
+			}
+		}
+	}
+
+	// The events from the metadata-only caches still trigger full syncs.
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := crs.syncDownstream("default/resource2"); err != nil {
+		t.Fatal(err)
+	}
+	tcrRemoteNew := newTestCR("resource2", "spec2", "status2")
+	tcrRemoteNew.SetAnnotations(map[string]string{annotationResourceVersion: ""})
+
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", newTestCR("resource1", "spec1", "status1")))
+	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+	f.verifyWriteActions()
+}
+
+func TestSyncUpstream_createWithoutSpec(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	// Objects of status-only CRDs have no spec.
+	tcrRemote := newTestCR("resource1", nil, "status1")
+	delete(tcrRemote.Object, "spec")
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tcrLocalNew := newTestCR("resource1", nil, "status1")
+	delete(tcrLocalNew.Object, "spec")
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", tcrLocalNew))
+	f.verifyWriteActions()
+}
+
+func TestSyncUpstream_skipsOldObjects(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	const modified = "example.com/last-modified"
+	tcrOld := newTestCR("resource1", "spec1", "status1")
+	tcrOld.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-2 * time.Hour)))
+	tcrRecent := newTestCR("resource2", "spec2", "status2")
+	tcrRecent.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-2 * time.Hour)))
+	tcrRecent.SetAnnotations(map[string]string{modified: time.Now().Format(time.RFC3339)})
+	f.addRemoteObjects(tcrOld, tcrRecent)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.maxObjectAge = time.Hour
+	crs.objectAgeAnnotation = modified
+
+	crs.startInformers()
+	for _, key := range []string{"default/resource1", "default/resource2"} {
+		if err := crs.syncUpstream(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcrLocalNew := newTestCR("resource2", "spec2", "status2")
+	tcrLocalNew.SetAnnotations(map[string]string{modified: tcrRecent.GetAnnotations()[modified]})
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", tcrLocalNew))
+	f.verifyWriteActions()
+}
+
+func TestSyncUpstream_syncsUpdatedOldObjects(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	managedFields := func(field string) []interface{} {
+		return []interface{}{map[string]interface{}{
+			"manager":   "kubectl",
+			"operation": "Update",
+			"time":      time.Now().UTC().Format(time.RFC3339),
+			"fieldsV1":  map[string]interface{}{field: map[string]interface{}{}},
+		}}
+	}
+	// Both objects are old, but the spec of resource1 was just updated.
+	tcrUpdated := newTestCR("resource1", "spec1", "status1")
+	tcrUpdated.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-2 * time.Hour)))
+	unstructured.SetNestedSlice(tcrUpdated.Object, managedFields("f:spec"), "metadata", "managedFields")
+	tcrStatusOnly := newTestCR("resource2", "spec2", "status2")
+	tcrStatusOnly.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-2 * time.Hour)))
+	unstructured.SetNestedSlice(tcrStatusOnly.Object, managedFields("f:status"), "metadata", "managedFields")
+	f.addRemoteObjects(tcrUpdated, tcrStatusOnly)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.maxObjectAge = time.Hour
+
+	crs.startInformers()
+	for _, key := range []string{"default/resource1", "default/resource2"} {
+		if err := crs.syncUpstream(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", newTestCR("resource1", "spec1", "status1")))
+	f.verifyWriteActions()
+}
+
+func TestSync_requireSyncGate(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationRequireSyncGate] = "true"
+	f := newFixture(t)
+
+	gate := map[string]string{labelSyncGate: labelSyncGateEnabled}
+	tcrGated := newTestCR("resource1", "spec1", "status1")
+	tcrGated.SetLabels(gate)
+	tcrUngated := newTestCR("resource2", "spec2", "status2")
+	// The gate was removed from resource3 after it was synced.
+	tcrRemoved := newTestCR("resource3", "spec3-new", "status3")
+	tcrRemovedLocal := newTestCR("resource3", "spec3", "status3-new")
+	tcrRemovedLocal.SetLabels(gate)
+	f.addRemoteObjects(tcrGated, tcrUngated, tcrRemoved)
+	f.addLocalObjects(tcrRemovedLocal)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	for _, key := range []string{"default/resource1", "default/resource2", "default/resource3"} {
+		if err := crs.syncUpstream(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := crs.syncDownstream("default/resource3"); err != nil {
+		t.Fatal(err)
+	}
+
+	tcrLocalNew := newTestCR("resource1", "spec1", "status1")
+	tcrLocalNew.SetLabels(gate)
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", tcrLocalNew))
+	f.verifyWriteActions()
+}
+
 func TestSyncClusterScopedCRUpstream_createSpec(t *testing.T) {
 	crd := testCRD(crdtypes.ClusterScoped)
 	f := newFixture(t)
@@ -271,17 +533,23 @@ func TestSyncUpstream_updateSpec(t *testing.T) {
 	f.verifyWriteActions()
 }
 
-func TestSyncUpstream_propagateDelete(t *testing.T) {
+func TestSyncUpstream_specSubtree(t *testing.T) {
 	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationSpecSubtree] = "shared"
 	f := newFixture(t)
 
+	// Only the shared section is synced, the local section of the
+	// downstream spec is kept.
 	var (
-		now       = metav1.Now()
-		tcrLocal  = newTestCR("resource1", "spec1", "status1")
-		tcrRemote = newTestCR("resource1", "spec1", "status1")
+		tcrLocal = newTestCR("resource1", map[string]interface{}{
+			"shared": "v1",
+			"local":  "robot",
+		}, nil)
+		tcrRemote = newTestCR("resource1", map[string]interface{}{
+			"shared": "v2",
+			"local":  "cloud",
+		}, nil)
 	)
-	tcrRemote.SetDeletionTimestamp(&now)
-
 	f.addLocalObjects(tcrLocal)
 	f.addRemoteObjects(tcrRemote)
 
@@ -292,122 +560,817 @@ func TestSyncUpstream_propagateDelete(t *testing.T) {
 	if err := crs.syncUpstream("default/resource1"); err != nil {
 		t.Fatal(err)
 	}
+	tcrLocalNew := newTestCR("resource1", map[string]interface{}{
+		"shared": "v2",
+		"local":  "robot",
+	}, nil)
 
-	f.expectLocalActions(
-		k8stest.NewDeleteAction(gvr, "default", "resource1"),
-	)
+	f.expectLocalActions(k8stest.NewUpdateAction(gvr, "default", tcrLocalNew))
 	f.verifyWriteActions()
 }
 
-func TestSyncDownstream_deleteOrphan(t *testing.T) {
+func TestSyncUpstream_patchesLabelsOnlyChange(t *testing.T) {
 	crd := testCRD(crdtypes.NamespaceScoped)
 	f := newFixture(t)
 
-	// We have a local resource that has no matching resource in the upstream cluster.
-	// Trying to sync it again should delete the local copy.
-	tcrLocal := newTestCR("resource1", "spec1", "status1")
-
+	// If only the labels changed, they are patched instead of updating the
+	// full object.
+	var (
+		tcrLocal  = newTestCR("resource1", "spec1", "status2")
+		tcrRemote = newTestCR("resource1", "spec1", "status1")
+	)
+	tcrLocal.SetLabels(map[string]string{"zone": "a", "tier": "1"})
+	tcrRemote.SetLabels(map[string]string{"zone": "b"})
 	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
 
 	crs, gvr := f.newCRSyncer(crd, "cluster1")
 	defer crs.stop()
 
 	crs.startInformers()
-	if err := crs.syncDownstream("default/resource1"); err != nil {
+	if err := crs.syncUpstream("default/resource1"); err != nil {
 		t.Fatal(err)
 	}
 
+	patch := []byte(`{"metadata":{"labels":{"tier":null,"zone":"b"}}}`)
+	f.expectLocalActions(k8stest.NewPatchAction(gvr, "default", "resource1", types.MergePatchType, patch))
+	f.verifyWriteActions()
+}
+
+func TestSyncUpstream_namespaceMap(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationNamespaceMap] = "team-a=robot-team-a"
+	f := newFixture(t)
+
+	tcrRemote := newTestCR("resource1", "spec1", "status1")
+	tcrRemote.SetNamespace("team-a")
+	tcrDefault := newTestCR("resource2", "spec2", "status2")
+	// Other namespaces are still out of scope.
+	tcrUnmapped := newTestCR("resource3", "spec3", "status3")
+	tcrUnmapped.SetNamespace("team-b")
+	f.addRemoteObjects(tcrRemote, tcrDefault, tcrUnmapped)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	for _, key := range []string{"team-a/resource1", "default/resource2", "team-b/resource3"} {
+		if err := crs.syncUpstream(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tcrLocalNew := newTestCR("resource1", "spec1", "status1")
+	tcrLocalNew.SetNamespace("robot-team-a")
+
 	f.expectLocalActions(
-		k8stest.NewDeleteAction(gvr, "default", "resource1"),
+		k8stest.NewCreateAction(gvr, "robot-team-a", tcrLocalNew),
+		k8stest.NewCreateAction(gvr, "default", newTestCR("resource2", "spec2", "status2")),
 	)
 	f.verifyWriteActions()
 }
 
-func TestSyncDownstream_statusFull(t *testing.T) {
+func TestParseNamespaceMap(t *testing.T) {
+	for _, tc := range []struct {
+		value       string
+		wantReverse map[string]string
+		wantErr     bool
+	}{
+		{value: "team-a=robot-team-a,team-b=robot-team-b", wantReverse: map[string]string{"robot-team-a": "team-a", "robot-team-b": "team-b"}},
+		{value: "team-a=team-b,team-b=team-a", wantReverse: map[string]string{"team-b": "team-a", "team-a": "team-b"}},
+		{value: "default=robot-default,team-a=default", wantReverse: map[string]string{"robot-default": "default", "default": "team-a"}},
+		{value: "team-a=robot,team-b=robot", wantErr: true},
+		{value: "team-a=robot-a,team-a=robot-b", wantErr: true},
+		// Objects in default are kept there.
+		{value: "team-a=default", wantErr: true},
+		{value: "team-a", wantErr: true},
+	} {
+		_, reverse, err := parseNamespaceMap(tc.value)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseNamespaceMap(%q) succeeded, want error", tc.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseNamespaceMap(%q) failed: %s", tc.value, err)
+		} else if !reflect.DeepEqual(reverse, tc.wantReverse) {
+			t.Errorf("parseNamespaceMap(%q) reverse = %v, want %v", tc.value, reverse, tc.wantReverse)
+		}
+	}
+}
+
+func TestSyncUpstream_ignoresExcludedNamespaces(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationNamespaceMap] = "team-a=robot-team-a"
+	f := newFixture(t)
+
+	// Neither a system object upstream nor an orphaned one downstream is
+	// touched.
+	tcrRemote := newTestCR("resource1", "spec1", "status1")
+	tcrRemote.SetNamespace("kube-system")
+	tcrLocal := newTestCR("resource2", "spec2", "status2")
+	tcrLocal.SetNamespace("kube-public")
+	f.addRemoteObjects(tcrRemote)
+	f.addLocalObjects(tcrLocal)
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("kube-system/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := crs.syncDownstream("kube-public/resource2"); err != nil {
+		t.Fatal(err)
+	}
+	f.verifyWriteActions()
+}
+
+func TestSyncDownstream_namespaceMap(t *testing.T) {
 	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationNamespaceMap] = "team-a=robot-team-a"
 	f := newFixture(t)
 
 	var (
 		tcrLocal  = newTestCR("resource1", "spec1", "status2")
 		tcrRemote = newTestCR("resource1", "spec1", "status1")
 	)
+	tcrLocal.SetNamespace("robot-team-a")
 	tcrLocal.SetResourceVersion("123")
-
+	tcrRemote.SetNamespace("team-a")
 	f.addLocalObjects(tcrLocal)
 	f.addRemoteObjects(tcrRemote)
 
-	crs, gvr := f.newCRSyncer(crd, "")
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
 	defer crs.stop()
 
 	crs.startInformers()
-	if err := crs.syncDownstream("default/resource1"); err != nil {
+	if err := crs.syncDownstream("robot-team-a/resource1"); err != nil {
 		t.Fatal(err)
 	}
 
 	tcrRemoteNew := newTestCR("resource1", "spec1", "status2")
+	tcrRemoteNew.SetNamespace("team-a")
 	tcrRemoteNew.SetAnnotations(map[string]string{
 		annotationResourceVersion: "123",
 	})
 
-	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "team-a", tcrRemoteNew))
 	f.verifyWriteActions()
 }
 
-func TestSyncDownstream_statusSubtree(t *testing.T) {
+func TestSyncDownstream_namespaceMapIgnoresSourceNamespace(t *testing.T) {
 	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationNamespaceMap] = "team-a=robot-team-a"
 	f := newFixture(t)
 
-	var (
-		tcrLocal = newTestCR("resource1", "spec1", map[string]interface{}{
-			"cloud": "cloud_1",
-			"robot": "robot_2",
-		})
-		tcrRemote = newTestCR("resource1", "spec1", map[string]interface{}{
-			"cloud": "cloud_2",
-			"robot": "robot_1",
-		})
-	)
-	tcrLocal.SetResourceVersion("123")
-
+	// Downstream objects in team-a aren't copies, as upstream team-a is
+	// mapped to robot-team-a.
+	tcrLocal := newTestCR("resource1", "spec1", "status1")
+	tcrLocal.SetNamespace("team-a")
+	tcrRemote := newTestCR("resource1", "spec1", "status2")
+	tcrRemote.SetNamespace("team-a")
 	f.addLocalObjects(tcrLocal)
 	f.addRemoteObjects(tcrRemote)
 
-	crs, gvr := f.newCRSyncer(crd, "")
+	crs, _ := f.newCRSyncer(crd, "cluster1")
 	defer crs.stop()
 
-	crs.subtree = "robot"
 	crs.startInformers()
-	if err := crs.syncDownstream("default/resource1"); err != nil {
+	if err := crs.syncDownstream("team-a/resource1"); err != nil {
 		t.Fatal(err)
 	}
+	f.verifyWriteActions()
+}
 
-	tcrRemoteNew := newTestCR("resource1", "spec1", map[string]interface{}{
-		"cloud": "cloud_2",
-		"robot": "robot_2",
-	})
-	tcrRemoteNew.SetAnnotations(map[string]string{
-		annotationResourceVersion: "123",
+func TestSyncUpstream_removesStaleFinalizers(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	tcrLocal := newTestCR("resource1", "spec1", "status1")
+	tcrRemote := newTestCR("resource1", "spec1", "status1")
+	tcrRemote.SetFinalizers([]string{
+		"cr-syncer.cloudrobotics.com/synced",
+		"robot-cluster1.synced.cr-syncer.cloudrobotics.com",
+		"robot-2.synced.cr-syncer.cloudrobotics.com",
+		"example.com/cleanup",
 	})
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
 
+	tcrRemoteNew := newTestCR("resource1", "spec1", "status1")
+	tcrRemoteNew.SetFinalizers([]string{
+		"robot-2.synced.cr-syncer.cloudrobotics.com",
+		"example.com/cleanup",
+	})
 	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+	f.expectLocalActions(k8stest.NewUpdateAction(gvr, "default", newTestCR("resource1", "spec1", "status1")))
 	f.verifyWriteActions()
 }
 
-func TestSyncDownstream_downstreamNotFound(t *testing.T) {
+func TestSyncUpstream_propagateDelete(t *testing.T) {
 	crd := testCRD(crdtypes.NamespaceScoped)
 	f := newFixture(t)
 
-	// If the downstream resource is not present when synced, the upstream
-	// resource should be added to the upstream queue, so that syncUpstream
-	// can recreate the downstream resource.  This tests the case where the
-	// upstream resource was deleted and immediately recreated.
 	var (
+		now       = metav1.Now()
+		tcrLocal  = newTestCR("resource1", "spec1", "status1")
 		tcrRemote = newTestCR("resource1", "spec1", "status1")
 	)
+	tcrRemote.SetDeletionTimestamp(&now)
 
+	f.addLocalObjects(tcrLocal)
 	f.addRemoteObjects(tcrRemote)
 
-	crs, _ := f.newCRSyncer(crd, "cluster1")
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	f.expectLocalActions(
+		k8stest.NewDeleteAction(gvr, "default", "resource1"),
+	)
+	f.verifyWriteActions()
+}
+
+func TestSyncUpstream_skipsDeleteOfTerminatingDownstream(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	var (
+		now       = metav1.Now()
+		tcrLocal  = newTestCR("resource1", "spec1", "status1")
+		tcrRemote = newTestCR("resource1", "spec1", "status1")
+	)
+	tcrRemote.SetDeletionTimestamp(&now)
+	tcrLocal.SetDeletionTimestamp(&now)
+	tcrLocal.SetFinalizers([]string{"example.com/cleanup"})
+
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	for i := 0; i < 2; i++ {
+		if err := crs.syncUpstream("default/resource1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The downstream object is already terminating, no further Delete
+	// calls are sent while its finalizers run.
+	f.verifyWriteActions()
+}
+
+// deleteRecorder records the options of delete calls.
+type deleteRecorder struct {
+	dynamic.NamespaceableResourceInterface
+	options []*metav1.DeleteOptions
+}
+
+func (r *deleteRecorder) Namespace(ns string) dynamic.ResourceInterface {
+	return &namespacedDeleteRecorder{r.NamespaceableResourceInterface.Namespace(ns), r}
+}
+
+type namespacedDeleteRecorder struct {
+	dynamic.ResourceInterface
+	r *deleteRecorder
+}
+
+func (n *namespacedDeleteRecorder) Delete(name string, options *metav1.DeleteOptions, subresources ...string) error {
+	n.r.options = append(n.r.options, options)
+	return n.ResourceInterface.Delete(name, options, subresources...)
+}
+
+func TestSyncUpstream_deletionGracePeriod(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationDeletionGraceSeconds] = "30"
+	f := newFixture(t)
+
+	f.addLocalObjects(newTestCR("resource1", "spec1", "status1"))
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	recorder := &deleteRecorder{NamespaceableResourceInterface: crs.downstream}
+	crs.downstream = recorder
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.options) != 1 {
+		t.Fatalf("got %d delete calls, want 1", len(recorder.options))
+	}
+	if o := recorder.options[0]; o == nil || o.GracePeriodSeconds == nil || *o.GracePeriodSeconds != 30 {
+		t.Errorf("delete options = %v, want grace period of 30s", o)
+	}
+}
+
+func TestSyncUpstream_deletePropagation(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationDeletePropagation] = "Foreground"
+	f := newFixture(t)
+
+	f.addLocalObjects(newTestCR("resource1", "spec1", "status1"))
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	recorder := &deleteRecorder{NamespaceableResourceInterface: crs.downstream}
+	crs.downstream = recorder
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.options) != 1 {
+		t.Fatalf("got %d delete calls, want 1", len(recorder.options))
+	}
+	if o := recorder.options[0]; o == nil || o.PropagationPolicy == nil || *o.PropagationPolicy != metav1.DeletePropagationForeground {
+		t.Errorf("delete options = %v, want foreground propagation", o)
+	}
+}
+
+func TestParseDeletePropagation(t *testing.T) {
+	for _, value := range []string{"", "Cascade"} {
+		crd := testCRD(crdtypes.NamespaceScoped)
+		crd.ObjectMeta.Annotations[annotationDeletePropagation] = value
+		if p := parseDeletePropagation(crd); p != nil {
+			t.Errorf("parseDeletePropagation(%q) = %s, want nil", value, *p)
+		}
+	}
+}
+
+// crdObject converts a CRD into an unstructured object that can be served
+// by the fake dynamic clients.
+func crdObject(t *testing.T, crd crdtypes.CustomResourceDefinition) *unstructured.Unstructured {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &unstructured.Unstructured{Object: content}
+	o.SetAPIVersion("apiextensions.k8s.io/v1beta1")
+	o.SetKind("CustomResourceDefinition")
+	return o
+}
+
+func TestSyncUpstream_skipsSchemaViolation(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationValidateSchema] = "true"
+	crd.Spec.Validation = &crdtypes.CustomResourceValidation{
+		OpenAPIV3Schema: &crdtypes.JSONSchemaProps{
+			Type: "object",
+			Properties: map[string]crdtypes.JSONSchemaProps{
+				"spec": {
+					Type: "object",
+					Properties: map[string]crdtypes.JSONSchemaProps{
+						"replicas": {Type: "integer"},
+					},
+				},
+			},
+		},
+	}
+	f := newFixture(t)
+
+	tcrRemote := newTestCR("resource1", map[string]interface{}{"replicas": "many"}, nil)
+	f.addLocalObjects(crdObject(t, crd))
+	f.addRemoteObjects(tcrRemote)
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	err := crs.validateDownstream(tcrRemote)
+	if err == nil || !strings.Contains(err.Error(), "spec.replicas") {
+		t.Errorf("validateDownstream() = %v; want error mentioning spec.replicas", err)
+	}
+	// The invalid object must not be written.
+	f.verifyWriteActions()
+}
+
+func TestSyncUpstream_retriesIfSchemaFailsToLoad(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationValidateSchema] = "true"
+	f := newFixture(t)
+
+	// The downstream CRD can't be read.
+	f.addRemoteObjects(newTestCR("resource1", "spec1", nil))
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err == nil {
+		t.Error("syncUpstream() succeeded, want error so that the item is requeued")
+	}
+	f.verifyWriteActions()
+}
+
+func TestSyncDownstream_deleteOrphan(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	// We have a local resource that has no matching resource in the upstream cluster.
+	// Trying to sync it again should delete the local copy.
+	tcrLocal := newTestCR("resource1", "spec1", "status1")
+
+	f.addLocalObjects(tcrLocal)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	f.expectLocalActions(
+		k8stest.NewDeleteAction(gvr, "default", "resource1"),
+	)
+	f.verifyWriteActions()
+}
+
+// countGets returns the number of get actions.
+func countGets(actions []k8stest.Action) (n int) {
+	for _, a := range actions {
+		if a.GetVerb() == "get" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSyncDownstream_readsUpstreamFromCache(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	var (
+		tcrLocal  = newTestCR("resource1", "spec1", "status2")
+		tcrRemote = newTestCR("resource1", "spec1", "status1")
+	)
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := countGets(f.remote.Actions()); n != 0 {
+		t.Errorf("got %d remote gets for cached object, want 0", n)
+	}
+
+	// On a cache miss, the object is fetched from the API server instead
+	// of deleting the local copy as an orphan.
+	f.remote.ClearActions()
+	if err := crs.upstreamInf.GetIndexer().Delete(tcrRemote); err != nil {
+		t.Fatal(err)
+	}
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := countGets(f.remote.Actions()); n != 1 {
+		t.Errorf("got %d remote gets after cache miss, want 1", n)
+	}
+	for _, a := range f.local.Actions() {
+		if a.GetVerb() == "delete" {
+			t.Errorf("local object was deleted after cache miss")
+		}
+	}
+}
+
+func TestSyncDownstream_statusFull(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	var (
+		tcrLocal  = newTestCR("resource1", "spec1", "status2")
+		tcrRemote = newTestCR("resource1", "spec1", "status1")
+	)
+	tcrLocal.SetResourceVersion("123")
+
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tcrRemoteNew := newTestCR("resource1", "spec1", "status2")
+	tcrRemoteNew.SetAnnotations(map[string]string{
+		annotationResourceVersion: "123",
+	})
+
+	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+	f.verifyWriteActions()
+}
+
+func TestSyncDownstream_emptyStatus(t *testing.T) {
+	for _, clearStatus := range []bool{false, true} {
+		crd := testCRD(crdtypes.NamespaceScoped)
+		if clearStatus {
+			crd.ObjectMeta.Annotations[annotationClearStatusWhenEmpty] = "true"
+		}
+		f := newFixture(t)
+
+		tcrLocal := newTestCR("resource1", "spec1", nil)
+		tcrLocal.SetResourceVersion("123")
+		f.addLocalObjects(tcrLocal)
+		f.addRemoteObjects(newTestCR("resource1", "spec1", "status1"))
+
+		crs, gvr := f.newCRSyncer(crd, "")
+		crs.startInformers()
+		if err := crs.syncDownstream("default/resource1"); err != nil {
+			t.Fatal(err)
+		}
+		crs.stop()
+
+		// The upstream status is kept by default.
+		tcrRemoteNew := newTestCR("resource1", "spec1", "status1")
+		if clearStatus {
+			tcrRemoteNew.Object["status"] = nil
+		}
+		tcrRemoteNew.SetAnnotations(map[string]string{
+			annotationResourceVersion: "123",
+		})
+		f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+		f.verifyWriteActions()
+	}
+}
+
+// statusMismatches returns the number of status write mismatches recorded
+// for the CRD.
+func statusMismatches(t *testing.T, crd crdtypes.CustomResourceDefinition) int64 {
+	rows, err := view.RetrieveData("cr-syncer.cloudrobotics.com/status_write_mismatches_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rows {
+		for _, tg := range r.Tags {
+			if tg.Key == tagResource && tg.Value == crd.GetName() {
+				return r.Data.(*view.CountData).Value
+			}
+		}
+	}
+	return 0
+}
+
+func TestSyncDownstream_verifiesStatusWrite(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	var (
+		tcrLocal  = newTestCR("resource1", "spec1", "status2")
+		tcrRemote = newTestCR("resource1", "spec1", "status1")
+	)
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, _ := f.newCRSyncer(crd, "")
+	defer crs.stop()
+	crs.verifyStatus = true
+	// Reading back the object returns the stale status.
+	f.remote.PrependReactor("get", "goals", func(k8stest.Action) (bool, runtime.Object, error) {
+		return true, tcrRemote.DeepCopy(), nil
+	})
+
+	before := statusMismatches(t, crd)
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := statusMismatches(t, crd) - before; got != 1 {
+		t.Errorf("got %d status mismatches, want 1", got)
+	}
+}
+
+func TestSyncDownstream_statusSubtree(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	var (
+		tcrLocal = newTestCR("resource1", "spec1", map[string]interface{}{
+			"cloud": "cloud_1",
+			"robot": "robot_2",
+		})
+		tcrRemote = newTestCR("resource1", "spec1", map[string]interface{}{
+			"cloud": "cloud_2",
+			"robot": "robot_1",
+		})
+	)
+	tcrLocal.SetResourceVersion("123")
+
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "")
+	defer crs.stop()
+
+	crs.subtree = "robot"
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tcrRemoteNew := newTestCR("resource1", "spec1", map[string]interface{}{
+		"cloud": "cloud_2",
+		"robot": "robot_2",
+	})
+	tcrRemoteNew.SetAnnotations(map[string]string{
+		annotationResourceVersion: "123",
+	})
+
+	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+	f.verifyWriteActions()
+}
+
+func TestSyncDownstream_statusSubtreeRobotName(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationStatusSubtree] = "robots.{robotName}"
+	f := newFixture(t)
+
+	var (
+		tcrLocal = newTestCR("resource1", "spec1", map[string]interface{}{
+			"robots": map[string]interface{}{
+				"robot1": "robot1_2",
+				"robot2": "robot2_1",
+			},
+		})
+		tcrRemote = newTestCR("resource1", "spec1", map[string]interface{}{
+			"robots": map[string]interface{}{
+				"robot1": "robot1_1",
+				"robot2": "robot2_2",
+			},
+		})
+	)
+	tcrLocal.SetResourceVersion("123")
+
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "robot1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the key of robot1 is copied.
+	tcrRemoteNew := newTestCR("resource1", "spec1", map[string]interface{}{
+		"robots": map[string]interface{}{
+			"robot1": "robot1_2",
+			"robot2": "robot2_2",
+		},
+	})
+	tcrRemoteNew.SetAnnotations(map[string]string{
+		annotationResourceVersion: "123",
+	})
+
+	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+	f.verifyWriteActions()
+}
+
+func TestSyncDownstream_batchesStatusFields(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationStatusFields] = "phase=immediate,heartbeat=batched"
+	f := newFixture(t)
+
+	status := func(phase string, heartbeat int64) map[string]interface{} {
+		return map[string]interface{}{"phase": phase, "heartbeat": heartbeat}
+	}
+	// Only the heartbeat of resource1 changed, but the phase of resource2.
+	f.addLocalObjects(
+		newTestCR("resource1", "spec1", status("Running", 2)),
+		newTestCR("resource2", "spec1", status("Done", 2)),
+	)
+	f.addRemoteObjects(
+		newTestCR("resource1", "spec1", status("Running", 1)),
+		newTestCR("resource2", "spec1", status("Running", 1)),
+	)
+
+	crs, gvr := f.newCRSyncer(crd, "")
+	defer crs.stop()
+	// Both objects were synced just now.
+	crs.recordStatusSync("default/resource1")
+	crs.recordStatusSync("default/resource2")
+
+	crs.startInformers()
+	for _, key := range []string{"default/resource1", "default/resource2"} {
+		if err := crs.syncDownstream(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcrRemoteNew := newTestCR("resource2", "spec1", status("Done", 2))
+	tcrRemoteNew.SetAnnotations(map[string]string{
+		annotationResourceVersion: "",
+	})
+	f.expectRemoteActions(k8stest.NewUpdateAction(gvr, "default", tcrRemoteNew))
+	f.verifyWriteActions()
+}
+
+func TestSyncDownstream_statusMinInterval(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	tcrLocal := newTestCR("resource1", "spec1", "status1")
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", nil))
+
+	crs, _ := f.newCRSyncer(crd, "")
+	defer crs.stop()
+	crs.statusMinInterval = time.Hour
+
+	crs.startInformers()
+	// Rapid status changes within the interval only cause the first
+	// write, the others are deferred.
+	for i, status := range []string{"status1", "status2", "status3"} {
+		tcrLocal.Object["status"] = status
+		tcrLocal.SetResourceVersion(fmt.Sprint(i + 1))
+		if err := crs.downstreamInf.GetIndexer().Update(tcrLocal.DeepCopy()); err != nil {
+			t.Fatal(err)
+		}
+		if err := crs.syncDownstream("default/resource1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if writes := filterReadActions(f.remote.Actions()); len(writes) != 1 {
+		t.Errorf("got %d upstream writes, want 1", len(writes))
+	}
+	if wait := crs.statusWriteDelay("default/resource1"); wait <= 0 || wait > time.Hour {
+		t.Errorf("got status write delay %s, want (0, 1h]", wait)
+	}
+}
+
+func TestSyncDownstream_waitsForObservedGeneration(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationRequireObservedGeneration] = "true"
+	crd.Spec.Subresources = &crdtypes.CustomResourceSubresources{Status: &crdtypes.CustomResourceSubresourceStatus{}}
+	f := newFixture(t)
+
+	var (
+		tcrLocal = newTestCR("resource1", "spec2", map[string]interface{}{
+			"observedGeneration": int64(1),
+			"phase":              "Ready",
+		})
+		tcrRemote = newTestCR("resource1", "spec2", nil)
+	)
+	tcrLocal.SetGeneration(2)
+	tcrLocal.SetResourceVersion("123")
+
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, _ := f.newCRSyncer(crd, "")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The status belongs to generation 1 and must not be propagated.
+	f.verifyWriteActions()
+}
+
+func TestSyncDownstream_downstreamNotFound(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	// If the downstream resource is not present when synced, the upstream
+	// resource should be added to the upstream queue, so that syncUpstream
+	// can recreate the downstream resource.  This tests the case where the
+	// upstream resource was deleted and immediately recreated.
+	var (
+		tcrRemote = newTestCR("resource1", "spec1", "status1")
+	)
+
+	f.addRemoteObjects(tcrRemote)
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
 	defer crs.stop()
 
 	crs.startInformers()
@@ -480,6 +1443,59 @@ func TestCRSyncer_populateWorkqueue(t *testing.T) {
 	}
 }
 
+func TestCRSyncer_ignoresSelfWrites(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	cr1 := newTestCR("cr1", "spec1", "status1")
+	cr2 := newTestCR("cr2", "spec2", "status2")
+	f.addRemoteObjects(cr1, cr2)
+
+	crs, gvr := f.newCRSyncer(crd, "")
+	defer crs.stop()
+	defer crs.upstreamQueue.ShutDown()
+	crs.startInformers()
+
+	// Drain the initial add events.
+	for i := 0; i < 2; i++ {
+		key, _ := crs.upstreamQueue.Get()
+		crs.upstreamQueue.Done(key)
+	}
+
+	// cr1 is updated by the syncer itself, cr2 by someone else.
+	crs.recordSelfWrite("default/cr1", "2")
+	remote := f.remote.Resource(gvr).Namespace("default")
+	for _, cr := range []*unstructured.Unstructured{cr1, cr2} {
+		cr = cr.DeepCopy()
+		cr.SetResourceVersion("2")
+		if _, err := remote.Update(cr, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Events are handled in order, so the update of cr2 is queued after
+	// the one of cr1 would have been.
+	keys := make(chan string, 2)
+	go func() {
+		for {
+			key, quit := crs.upstreamQueue.Get()
+			if quit {
+				return
+			}
+			crs.upstreamQueue.Done(key)
+			keys <- key.(string)
+		}
+	}()
+	select {
+	case key := <-keys:
+		if key != "default/cr2" {
+			t.Errorf("got sync of %s, want default/cr2", key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Received no update event for cr2")
+	}
+}
+
 func TestCRSyncer_populateWorkqueueWithFilter(t *testing.T) {
 	crd := testCRD(crdtypes.NamespaceScoped)
 	crd.ObjectMeta.Annotations[annotationFilterByRobotName] = "true"
@@ -543,3 +1559,70 @@ func channelFromQueue(t *testing.T, queue workqueue.Interface, inf cache.SharedI
 	return ch
 
 }
+
+func TestListOptions_listPageSize(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	if got := crs.listOptions(metav1.ListOptions{ResourceVersion: "0"}); got.Limit != 0 || got.ResourceVersion != "0" {
+		t.Errorf("listOptions() without page size = %+v, want no limit", got)
+	}
+
+	crs.listPageSize = 500
+	got := crs.listOptions(metav1.ListOptions{ResourceVersion: "0"})
+	if got.Limit != 500 {
+		t.Errorf("got limit %d, want 500", got.Limit)
+	}
+	if got.ResourceVersion != "" {
+		t.Errorf("got resource version %q for first page, want a consistent read", got.ResourceVersion)
+	}
+	next := crs.listOptions(metav1.ListOptions{ResourceVersion: "0", Continue: "token"})
+	if next.Limit != 500 || next.Continue != "token" || next.ResourceVersion != "" {
+		t.Errorf("got options %+v for next page, want limit 500 with only the continue token", next)
+	}
+}
+
+func TestSyncDownstream_observedGenerationWithoutStatusSubresource(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationRequireObservedGeneration] = "true"
+	f := newFixture(t)
+
+	var (
+		tcrLocal = newTestCR("resource1", "spec2", map[string]interface{}{
+			"observedGeneration": int64(1),
+			"phase":              "Ready",
+		})
+		tcrRemote = newTestCR("resource1", "spec2", nil)
+	)
+	tcrLocal.SetGeneration(2)
+	tcrLocal.SetResourceVersion("123")
+
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(tcrRemote)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	crs, _ := f.newCRSyncer(crd, "")
+	defer crs.stop()
+
+	if !strings.Contains(buf.String(), "Warning: Ignoring "+annotationRequireObservedGeneration) {
+		t.Errorf("got no warning about the missing status subresource:\n%s", buf.String())
+	}
+	if crs.requireObservedGeneration {
+		t.Error("requireObservedGeneration is still enabled")
+	}
+
+	// Without the status subresource, the status is synced regardless of
+	// the observed generation.
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	if writes := filterReadActions(f.remote.Actions()); len(writes) != 1 {
+		t.Errorf("got upstream writes %v, want 1", writes)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Label that pauses the sync of an individual object while it is "true" on
+// its upstream or downstream copy. The other objects of the CRD are still
+// synced.
+const labelSyncPaused = "cloudrobotics.com/sync-paused"
+
+// skipPaused returns true if the sync of o is paused by its label, in which
+// case the syncer doesn't write the object in either direction.
+func (s *crSyncer) skipPaused(direction, key string, o *unstructured.Unstructured) bool {
+	if o.GetLabels()[labelSyncPaused] != "true" {
+		return false
+	}
+	if *verbose {
+		log.Printf("Skipping %s sync of %s %s: %s label is set on %s", direction, s.crd.GetName(), key, labelSyncPaused, o.GetName())
+	}
+	return true
+}
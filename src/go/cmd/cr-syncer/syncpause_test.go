@@ -0,0 +1,75 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSyncUpstream_skipsPausedObject(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	paused := newTestCR("resource1", "spec1", "status1")
+	paused.SetLabels(map[string]string{labelSyncPaused: "true"})
+	sibling := newTestCR("resource2", "spec2", "status2")
+	f.addRemoteObjects(paused, sibling)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	for _, key := range []string{"default/resource1", "default/resource2"} {
+		if err := crs.syncUpstream(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", newTestCR("resource2", "spec2", "status2")))
+	f.verifyWriteActions()
+
+	// Removing the label resumes the sync.
+	unpaused := paused.DeepCopy()
+	unpaused.SetLabels(map[string]string{labelSyncPaused: "false"})
+	if err := crs.upstreamInf.GetIndexer().Update(unpaused); err != nil {
+		t.Fatal(err)
+	}
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", unpaused))
+	f.verifyWriteActions()
+}
+
+func TestSyncDownstream_skipsPausedObject(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+
+	tcrLocal := newTestCR("resource1", "spec1", "status2")
+	tcrLocal.SetLabels(map[string]string{labelSyncPaused: "true"})
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", "status1"))
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	f.verifyWriteActions()
+}
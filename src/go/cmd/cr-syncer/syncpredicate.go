@@ -0,0 +1,83 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// CRD annotation with a predicate of the form <path>=<value>, eg
+	// spec.phase=active, that upstream objects must match to be synced.
+	annotationSyncPredicate = "cr-syncer.cloudrobotics.com/sync-predicate"
+	// CRD annotation that makes the syncer delete the downstream copies of
+	// objects that stop matching the sync predicate.
+	annotationSyncPredicateDelete = "cr-syncer.cloudrobotics.com/sync-predicate-delete"
+)
+
+// syncPredicate matches objects whose field at path has the given value.
+// Values are compared in their string form, so that eg spec.replicas=3 and
+// spec.enabled=true match numbers and booleans.
+type syncPredicate struct {
+	path  []string // nil if the annotation is malformed.
+	value string
+}
+
+// parseSyncPredicate returns the sync predicate of the CRD, or nil if it
+// doesn't have one. A malformed predicate matches no objects, rather than
+// syncing objects that were meant to be excluded.
+func parseSyncPredicate(crd crdtypes.CustomResourceDefinition) *syncPredicate {
+	value := crd.ObjectMeta.Annotations[annotationSyncPredicate]
+	if value == "" {
+		return nil
+	}
+	parts := strings.SplitN(value, "=", 2)
+	path := strings.TrimSpace(parts[0])
+	if len(parts) != 2 || path == "" || strings.HasPrefix(path, ".") || strings.HasSuffix(path, ".") {
+		log.Printf("Value for %s must be <path>=<value> on %s, got %q, no objects are synced",
+			annotationSyncPredicate, crd.ObjectMeta.Name, value)
+		return &syncPredicate{}
+	}
+	return &syncPredicate{path: strings.Split(path, "."), value: parts[1]}
+}
+
+// matches returns true if the object o matches the predicate. A nil
+// predicate matches all objects.
+func (p *syncPredicate) matches(o *unstructured.Unstructured) bool {
+	if p == nil {
+		return true
+	}
+	if p.path == nil {
+		return false
+	}
+	v, found, err := unstructured.NestedFieldNoCopy(o.Object, p.path...)
+	if err != nil || !found {
+		return false
+	}
+	return fmt.Sprint(v) == p.value
+}
+
+// String returns the predicate in the form of the annotation.
+func (p *syncPredicate) String() string {
+	if p == nil {
+		return ""
+	}
+	return strings.Join(p.path, ".") + "=" + p.value
+}
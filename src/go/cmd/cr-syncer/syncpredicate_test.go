@@ -0,0 +1,108 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSyncPredicate_matches(t *testing.T) {
+	o := newTestCR("resource1", map[string]interface{}{
+		"phase":    "active",
+		"replicas": int64(3),
+		"enabled":  true,
+	}, nil)
+	for _, tc := range []struct {
+		annotation string
+		want       bool
+	}{
+		{"", true},
+		{"spec.phase=active", true},
+		{"spec.phase=inactive", false},
+		{"spec.replicas=3", true},
+		{"spec.enabled=true", true},
+		{"spec.missing=active", false},
+		{"spec.phase.nested=active", false},
+		// Malformed predicates match nothing.
+		{"spec.phase", false},
+		{"=active", false},
+		{"spec.=active", false},
+	} {
+		crd := testCRD(crdtypes.NamespaceScoped)
+		if tc.annotation != "" {
+			crd.ObjectMeta.Annotations[annotationSyncPredicate] = tc.annotation
+		}
+		if got := parseSyncPredicate(crd).matches(o); got != tc.want {
+			t.Errorf("predicate %q matches = %t, want %t", tc.annotation, got, tc.want)
+		}
+	}
+}
+
+func TestSyncUpstream_syncPredicate(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationSyncPredicate] = "spec.phase=active"
+	f := newFixture(t)
+
+	tcrRemote := newTestCR("resource1", map[string]interface{}{"phase": "pending"}, nil)
+	f.addRemoteObjects(tcrRemote)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+
+	// The object isn't synced while it doesn't match.
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	f.verifyWriteActions()
+
+	// The predicate is evaluated again when the object is updated.
+	tcrRemote = tcrRemote.DeepCopy()
+	tcrRemote.Object["spec"] = map[string]interface{}{"phase": "active"}
+	tcrRemote.SetResourceVersion("2")
+	if err := crs.upstreamInf.GetIndexer().Update(tcrRemote); err != nil {
+		t.Fatal(err)
+	}
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+	tcrLocal := newTestCR("resource1", map[string]interface{}{"phase": "active"}, nil)
+	f.expectLocalActions(k8stest.NewCreateAction(gvr, "default", tcrLocal))
+	f.verifyWriteActions()
+}
+
+func TestSyncUpstream_syncPredicateDeletesUnmatched(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationSyncPredicate] = "spec.phase=active"
+	crd.ObjectMeta.Annotations[annotationSyncPredicateDelete] = "true"
+	f := newFixture(t)
+
+	// The object stopped matching after it was synced.
+	f.addRemoteObjects(newTestCR("resource1", map[string]interface{}{"phase": "done"}, nil))
+	f.addLocalObjects(newTestCR("resource1", map[string]interface{}{"phase": "active"}, nil))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+	if err := crs.syncUpstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	f.expectLocalActions(k8stest.NewDeleteAction(gvr, "default", "resource1"))
+	f.verifyWriteActions()
+}
@@ -0,0 +1,172 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// Annotations with the outcome of the last sync of an object, written
+	// to both its copies if -record-sync-results is set.
+	annotationLastSyncResult = "cr-syncer.cloudrobotics.com/last-sync-result"
+	annotationLastSyncError  = "cr-syncer.cloudrobotics.com/last-sync-error"
+
+	maxSyncErrorLength = 256
+)
+
+// syncResultAnnotations are set by the syncer, so they aren't copied between
+// the clusters.
+var syncResultAnnotations = []string{annotationLastSyncResult, annotationLastSyncError, annotationAdmissionRejected, annotationSpecChecksum, annotationSyncedBy, annotationOwnedByUpstream, annotationOversized}
+
+// syncResultValue returns the value of the last-sync-result annotation for
+// the result, or "" if the object is gone.
+func syncResultValue(result Result) string {
+	switch result {
+	case ResultCreated, ResultUpdated:
+		return "updated"
+	case ResultUnchanged:
+		return "noop"
+	case ResultFailed:
+		return "error"
+	}
+	return ""
+}
+
+// annotateSyncResult records the outcome of the sync of the object with the
+// given queue key in the annotations of both its copies. The annotations are
+// only written if they changed, and the event handlers ignore updates that
+// only change them, so that writing them doesn't trigger syncs endlessly.
+func (s *crSyncer) annotateSyncResult(direction, key string, result Result, syncErr error) {
+	value := syncResultValue(result)
+	if value == "" {
+		return
+	}
+	msg := ""
+	if syncErr != nil {
+		if msg = syncErr.Error(); len(msg) > maxSyncErrorLength {
+			msg = msg[:maxSyncErrorLength-3] + "..."
+		}
+	}
+
+	var upstreamKey, downstreamKey string
+	if direction == "upstream" {
+		upstreamKey = s.resolveKey(key, s.upstreamInf, s.downstreamInf, s.downstreamKey, s.upstreamKey)
+		downstreamKey = s.counterpartOf(s.upstreamInf, s.downstreamInf, upstreamKey, s.downstreamKey)
+	} else {
+		downstreamKey = s.resolveKey(key, s.downstreamInf, s.upstreamInf, s.upstreamKey, s.downstreamKey)
+		upstreamKey = s.counterpartOf(s.downstreamInf, s.upstreamInf, downstreamKey, s.upstreamKey)
+	}
+	s.patchSyncResult("upstream", s.upstreamInf, s.upstream, upstreamKey, value, msg)
+	s.patchSyncResult("downstream", s.downstreamInf, s.downstream, downstreamKey, value, msg)
+}
+
+// counterpartOf returns the key of the counterpart in the cache of other of
+// the object with the given key in the cache of inf.
+func (s *crSyncer) counterpartOf(inf, other cache.SharedIndexInformer, key string, toOther func(string) string) string {
+	otherKey := toOther(key)
+	obj, exists, err := inf.GetIndexer().GetByKey(key)
+	if err != nil || !exists {
+		return otherKey
+	}
+	otherNs, _, _ := cache.SplitMetaNamespaceKey(otherKey)
+	if k := s.counterpartKey(other, otherNs, obj.(*unstructured.Unstructured)); k != "" {
+		return k
+	}
+	return otherKey
+}
+
+// patchSyncResult sets the sync result annotations of the object with the
+// given key, unless they already have these values.
+func (s *crSyncer) patchSyncResult(side string, inf cache.SharedIndexInformer, client dynamic.NamespaceableResourceInterface, key, value, msg string) {
+	obj, exists, err := inf.GetIndexer().GetByKey(key)
+	if err != nil || !exists {
+		return
+	}
+	o := obj.(*unstructured.Unstructured)
+	annotations := o.GetAnnotations()
+	if annotations[annotationLastSyncResult] == value && annotations[annotationLastSyncError] == msg {
+		return
+	}
+	var msgValue interface{} // Removes the annotation.
+	if msg != "" {
+		msgValue = msg
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				annotationLastSyncResult: value,
+				annotationLastSyncError:  msgValue,
+			},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	updated, err := client.Namespace(o.GetNamespace()).Patch(o.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		if !isNotFoundError(err) {
+			log.Printf("Failed to record sync result of %s %s: %s", side, key, err)
+		}
+		return
+	}
+	if side == "upstream" {
+		s.recordSelfWrite(key, updated.GetResourceVersion())
+	}
+}
+
+// onlySyncResultChanged returns true if an update of an object only changed
+// its sync result annotations, ie if it was the syncer's own annotation of
+// the outcome of a sync.
+func onlySyncResultChanged(old, new *unstructured.Unstructured) bool {
+	oldAnnotations, newAnnotations := old.GetAnnotations(), new.GetAnnotations()
+	if oldAnnotations[annotationLastSyncResult] == newAnnotations[annotationLastSyncResult] &&
+		oldAnnotations[annotationLastSyncError] == newAnnotations[annotationLastSyncError] {
+		return false
+	}
+	old, new = old.DeepCopy(), new.DeepCopy()
+	for _, o := range []*unstructured.Unstructured{old, new} {
+		deleteAnnotation(o, annotationLastSyncResult)
+		deleteAnnotation(o, annotationLastSyncError)
+		o.SetResourceVersion("")
+		unstructured.RemoveNestedField(o.Object, "metadata", "managedFields")
+	}
+	return reflect.DeepEqual(old.Object, new.Object)
+}
+
+// copyAnnotations sets the annotations of dst to those of src, except for
+// the ones that the syncer sets on both sides.
+func copyAnnotations(src, dst *unstructured.Unstructured) {
+	annotations := src.GetAnnotations()
+	own := dst.GetAnnotations()
+	for _, k := range syncResultAnnotations {
+		delete(annotations, k)
+		if v, ok := own[k]; ok {
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[k] = v
+		}
+	}
+	dst.SetAnnotations(annotations)
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/dynamic/fake"
+	k8stest "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestProcessNextWorkItem_annotatesSyncResult(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(
+		newTestCR("resource1", "spec1", "status1"),
+		newTestCR("resource2", "spec2", "status2"),
+	)
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.recordSyncResults = true
+	crs.startInformers()
+
+	// Use a separate queue, as the informers fill the syncer's queues.
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+
+	q.Add("default/resource1")
+	crs.processNextWorkItem(context.Background(), q, crs.reconcileUpstream, "upstream")
+
+	f.local.PrependReactor("create", "*", func(k8stest.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("create failed")
+	})
+	q.Add("default/resource2")
+	crs.processNextWorkItem(context.Background(), q, crs.reconcileUpstream, "upstream")
+
+	annotations := func(name string) map[string]string {
+		t.Helper()
+		o, err := f.remote.Resource(gvr).Namespace("default").Get(name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return o.GetAnnotations()
+	}
+	if got := annotations("resource1"); got[annotationLastSyncResult] != "updated" || got[annotationLastSyncError] != "" {
+		t.Errorf("resource1 annotations = %v, want successful sync", got)
+	}
+	got := annotations("resource2")
+	if got[annotationLastSyncResult] != "error" {
+		t.Errorf("resource2 %s = %q, want %q", annotationLastSyncResult, got[annotationLastSyncResult], "error")
+	}
+	if msg := got[annotationLastSyncError]; msg == "" {
+		t.Errorf("resource2 has no %s annotation", annotationLastSyncError)
+	}
+}
+
+func TestCopyAnnotations_keepsSyncResults(t *testing.T) {
+	src := newTestCR("resource1", "spec1", nil)
+	src.SetAnnotations(map[string]string{
+		"example.com/owner":      "team-a",
+		annotationLastSyncResult: "error",
+	})
+	dst := newTestCR("resource1", "spec1", nil)
+	dst.SetAnnotations(map[string]string{
+		"example.com/owner":      "team-b",
+		annotationLastSyncResult: "noop",
+	})
+
+	copyAnnotations(src, dst)
+
+	want := map[string]string{
+		"example.com/owner":      "team-a",
+		annotationLastSyncResult: "noop",
+	}
+	if got := dst.GetAnnotations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("copyAnnotations() = %v, want %v", got, want)
+	}
+	if src.GetAnnotations()[annotationLastSyncResult] != "error" {
+		t.Errorf("copyAnnotations() modified src")
+	}
+}
+
+func TestProcessNextWorkItem_syncResultSurvivesOwnAnnotation(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	f.addRemoteObjects(newTestCR("resource1", "spec2", "status1"))
+	f.addLocalObjects(newTestCR("resource1", "spec1", "status1"))
+
+	crs, gvr := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.recordSyncResults = true
+	crs.startInformers()
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	q.Add("default/resource1")
+	crs.processNextWorkItem(context.Background(), q, crs.reconcileUpstream, "upstream")
+
+	// Both copies are annotated.
+	for _, c := range []struct {
+		side   string
+		client *k8sfake.FakeDynamicClient
+	}{{"upstream", f.remote}, {"downstream", f.local}} {
+		o, err := c.client.Resource(gvr).Namespace("default").Get("resource1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := o.GetAnnotations()[annotationLastSyncResult]; got != "updated" {
+			t.Errorf("%s %s = %q, want %q", c.side, annotationLastSyncResult, got, "updated")
+		}
+	}
+
+	// The event of the downstream annotation doesn't trigger a reconcile
+	// that would overwrite "updated" with "noop".
+	annotated, err := f.local.Resource(gvr).Namespace("default").Get("resource1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotated.SetResourceVersion("2")
+	before := annotated.DeepCopy()
+	before.SetResourceVersion("1")
+	deleteAnnotation(before, annotationLastSyncResult)
+	if !onlySyncResultChanged(before, annotated) {
+		t.Error("onlySyncResultChanged() = false for the syncer's annotation")
+	}
+	changed := annotated.DeepCopy()
+	changed.Object["status"] = "status2"
+	if onlySyncResultChanged(before, changed) {
+		t.Error("onlySyncResultChanged() = true for a status change")
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+
+	"go.opencensus.io/trace"
+)
+
+type apiCallsKey struct{}
+
+// apiCalls collects the API operations performed by a sync. A sync runs in a
+// single goroutine, so it needs no locking.
+type apiCalls struct {
+	ops []string
+}
+
+func (c *apiCalls) String() string {
+	return strings.Join(c.ops, ",")
+}
+
+// withAPICalls returns a context in which traceCall records the API
+// operations in the returned apiCalls.
+func withAPICalls(ctx context.Context) (context.Context, *apiCalls) {
+	c := &apiCalls{}
+	return context.WithValue(ctx, apiCallsKey{}, c), c
+}
+
+// traceCall starts a span for the API call op as a child of the sync span in
+// ctx and returns the function that ends it.
+func (s *crSyncer) traceCall(ctx context.Context, op string) func(error) {
+	if c, ok := ctx.Value(apiCallsKey{}).(*apiCalls); ok {
+		c.ops = append(c.ops, op)
+	}
+	_, span := trace.StartSpan(ctx, "cr-syncer/api/"+op)
+	span.AddAttributes(trace.StringAttribute("crd", s.crd.GetName()))
+	return func(err error) {
+		if err != nil {
+			span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+		}
+		span.End()
+	}
+}
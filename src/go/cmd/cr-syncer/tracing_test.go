@@ -0,0 +1,104 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opencensus.io/trace"
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestProcessNextWorkItem_spansPerDirection(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	f := newFixture(t)
+	tcrLocal := newTestCR("resource1", "spec1", "status2")
+	tcrLocal.SetResourceVersion("123")
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(newTestCR("resource1", "spec2", "status1"))
+
+	crs, _ := f.newCRSyncer(crd, "cluster1")
+	defer crs.stop()
+	crs.startInformers()
+
+	recorder := &spanRecorder{}
+	trace.RegisterExporter(recorder)
+	defer trace.UnregisterExporter(recorder)
+
+	ctx, span := trace.StartSpan(context.Background(), "test", trace.WithSampler(trace.AlwaysSample()))
+	for _, direction := range []string{"upstream", "downstream"} {
+		syncf := crs.reconcileUpstream
+		if direction == "downstream" {
+			syncf = crs.reconcileDownstream
+		}
+		q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+		q.Add("default/resource1")
+		crs.processNextWorkItem(ctx, q, syncf, direction)
+		q.ShutDown()
+	}
+	span.End()
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	syncs := map[string]*trace.SpanData{}
+	for _, s := range recorder.spans {
+		if s.Name == "cr-syncer/sync/upstream" || s.Name == "cr-syncer/sync/downstream" {
+			syncs[s.Name] = s
+		}
+		if s.Name == "cr-syncer/reconcile/upstream" || s.Name == "cr-syncer/reconcile/downstream" {
+			t.Errorf("got nested reconcile span %s", s.Name)
+		}
+	}
+	for name, ops := range map[string]string{
+		"cr-syncer/sync/upstream":   "update",
+		"cr-syncer/sync/downstream": "updatestatus",
+	} {
+		s, ok := syncs[name]
+		if !ok {
+			t.Errorf("no span %s, got %v", name, recorder.spans)
+			continue
+		}
+		if got := s.Attributes["crd"]; got != crd.GetName() {
+			t.Errorf("%s: crd attribute = %v, want %s", name, got, crd.GetName())
+		}
+		if got := s.Attributes["key"]; got != "default/resource1" {
+			t.Errorf("%s: key attribute = %v, want default/resource1", name, got)
+		}
+		if got := s.Attributes["operations"]; got != ops {
+			t.Errorf("%s: operations attribute = %v, want %s", name, got, ops)
+		}
+	}
+
+	// The API calls are traced as children of the sync spans.
+	var calls int
+	for _, s := range recorder.spans {
+		if s.Name != "cr-syncer/api/update" && s.Name != "cr-syncer/api/updatestatus" {
+			continue
+		}
+		calls++
+		parent := syncs["cr-syncer/sync/upstream"]
+		if s.Name == "cr-syncer/api/updatestatus" {
+			parent = syncs["cr-syncer/sync/downstream"]
+		}
+		if parent != nil && s.ParentSpanID != parent.SpanID {
+			t.Errorf("%s has parent %v, want %v", s.Name, s.ParentSpanID, parent.SpanID)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("got %d API call spans, want 2", calls)
+	}
+}
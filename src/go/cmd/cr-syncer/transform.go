@@ -0,0 +1,90 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+)
+
+// CRD annotation with the name of a transform that is applied to the status
+// subtree before it is written upstream.
+const annotationSubtreeTransform = "cr-syncer.cloudrobotics.com/subtree-transform"
+
+// subtreeTransform reshapes a status subtree value.
+type subtreeTransform func(v interface{}) (interface{}, error)
+
+// subtreeTransforms are the transforms that can be named by the
+// subtree-transform annotation.
+var subtreeTransforms = map[string]subtreeTransform{
+	"identity": func(v interface{}) (interface{}, error) { return v, nil },
+	"flatten":  flattenSubtree,
+}
+
+// parseSubtreeTransform returns the transform named by the subtree-transform
+// annotation, or nil if it is unset or unknown.
+func parseSubtreeTransform(crd crdtypes.CustomResourceDefinition) subtreeTransform {
+	name := crd.ObjectMeta.Annotations[annotationSubtreeTransform]
+	if name == "" {
+		return nil
+	}
+	t, ok := subtreeTransforms[name]
+	if !ok {
+		var names []string
+		for n := range subtreeTransforms {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		log.Printf("Value for %s must be one of %s on %s, got %q",
+			annotationSubtreeTransform, strings.Join(names, ", "), crd.ObjectMeta.Name, name)
+		return nil
+	}
+	return t
+}
+
+// flattenSubtree turns nested dicts into a single dict with dotted keys, eg
+// {"a": {"b": 1}} into {"a.b": 1}. Other values are kept as they are.
+func flattenSubtree(v interface{}) (interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v, nil
+	}
+	flat := map[string]interface{}{}
+	if err := flattenInto(flat, "", m); err != nil {
+		return nil, err
+	}
+	return flat, nil
+}
+
+func flattenInto(flat map[string]interface{}, prefix string, m map[string]interface{}) error {
+	for k, v := range m {
+		key := prefix + k
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+			if err := flattenInto(flat, key+".", nested); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := flat[key]; ok {
+			return fmt.Errorf("duplicate key %q", key)
+		}
+		flat[key] = v
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	crdtypes "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestFlattenSubtree(t *testing.T) {
+	got, err := flattenSubtree(map[string]interface{}{
+		"phase": "Running",
+		"battery": map[string]interface{}{
+			"level": int64(80),
+			"cells": map[string]interface{}{"1": "ok"},
+		},
+		"empty": map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"phase":           "Running",
+		"battery.level":   int64(80),
+		"battery.cells.1": "ok",
+		"empty":           map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("flattenSubtree() = %v, want %v", got, want)
+	}
+
+	if _, err := flattenSubtree(map[string]interface{}{
+		"a.b": int64(1),
+		"a":   map[string]interface{}{"b": int64(2)},
+	}); err == nil {
+		t.Error("flattenSubtree() succeeded with colliding keys")
+	}
+}
+
+func TestParseSubtreeTransform_unknown(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationSubtreeTransform] = "reverse"
+	if parseSubtreeTransform(crd) != nil {
+		t.Error("got transform for unknown name, want nil")
+	}
+}
+
+func TestSyncDownstream_transformsSubtree(t *testing.T) {
+	crd := testCRD(crdtypes.NamespaceScoped)
+	crd.ObjectMeta.Annotations[annotationStatusSubtree] = "robots.{robotName}"
+	crd.ObjectMeta.Annotations[annotationSubtreeTransform] = "flatten"
+	f := newFixture(t)
+
+	tcrLocal := newTestCR("resource1", "spec1", map[string]interface{}{
+		"robots": map[string]interface{}{"robot1": map[string]interface{}{
+			"battery": map[string]interface{}{"level": int64(80)},
+		}},
+	})
+	f.addLocalObjects(tcrLocal)
+	f.addRemoteObjects(newTestCR("resource1", "spec1", nil))
+
+	crs, _ := f.newCRSyncer(crd, "robot1")
+	defer crs.stop()
+
+	crs.startInformers()
+	if err := crs.syncDownstream("default/resource1"); err != nil {
+		t.Fatal(err)
+	}
+
+	actions := filterReadActions(f.remote.Actions())
+	if len(actions) != 1 {
+		t.Fatalf("got %d remote writes, want 1", len(actions))
+	}
+	written := actions[0].(k8stest.UpdateAction).GetObject().(*unstructured.Unstructured)
+	got, _, _ := unstructured.NestedMap(written.Object, "status", "robots", "robot1")
+	want := map[string]interface{}{"battery.level": int64(80)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got upstream subtree %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetCondition returns the condition of the given type, or nil if the
+// ChartAssignment has no such condition.
+func GetCondition(ca *ChartAssignment, t ChartAssignmentConditionType) *ChartAssignmentCondition {
+	for i := range ca.Status.Conditions {
+		if ca.Status.Conditions[i].Type == t {
+			return &ca.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or updates the condition of the given type. The
+// LastUpdateTime is set whenever the condition changes, the
+// LastTransitionTime only when its status changes.
+func SetCondition(ca *ChartAssignment, t ChartAssignmentConditionType, status corev1.ConditionStatus, reason, message string) {
+	now := metav1.Now()
+
+	if c := GetCondition(ca, t); c != nil {
+		if c.Status != status || c.Reason != reason || c.Message != message {
+			c.LastUpdateTime = now
+		}
+		if c.Status != status {
+			c.LastTransitionTime = now
+		}
+		c.Status = status
+		c.Reason = reason
+		c.Message = message
+		return
+	}
+	// Condition set for the first time.
+	ca.Status.Conditions = append(ca.Status.Conditions, ChartAssignmentCondition{
+		Type:               t,
+		Status:             status,
+		LastUpdateTime:     now,
+		LastTransitionTime: now,
+		Reason:             reason,
+		Message:            message,
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetCondition_addsCondition(t *testing.T) {
+	ca := &ChartAssignment{}
+	SetCondition(ca, ChartAssignmentConditionReady, corev1.ConditionFalse, "PodsPending", "0/1 pods running")
+
+	if len(ca.Status.Conditions) != 1 {
+		t.Fatalf("got %d conditions, want 1", len(ca.Status.Conditions))
+	}
+	c := ca.Status.Conditions[0]
+	if c.Type != ChartAssignmentConditionReady || c.Status != corev1.ConditionFalse ||
+		c.Reason != "PodsPending" || c.Message != "0/1 pods running" {
+		t.Errorf("unexpected condition %+v", c)
+	}
+	if c.LastTransitionTime.IsZero() || c.LastUpdateTime.IsZero() {
+		t.Errorf("times not set on new condition %+v", c)
+	}
+}
+
+func TestSetCondition_updatesTransitionTimeOnStatusChange(t *testing.T) {
+	past := metav1.NewTime(time.Now().Add(-time.Hour))
+	ca := &ChartAssignment{}
+	ca.Status.Conditions = []ChartAssignmentCondition{{
+		Type:               ChartAssignmentConditionReady,
+		Status:             corev1.ConditionFalse,
+		LastUpdateTime:     past,
+		LastTransitionTime: past,
+		Reason:             "PodsPending",
+	}}
+
+	// A new reason with the same status only updates the update time.
+	SetCondition(ca, ChartAssignmentConditionReady, corev1.ConditionFalse, "PodsCrashing", "")
+	c := ca.Status.Conditions[0]
+	if !c.LastTransitionTime.Equal(&past) {
+		t.Errorf("transition time changed without status change: %v", c.LastTransitionTime)
+	}
+	if c.LastUpdateTime.Equal(&past) {
+		t.Errorf("update time not changed on reason change")
+	}
+	if c.Reason != "PodsCrashing" {
+		t.Errorf("got reason %q, want PodsCrashing", c.Reason)
+	}
+
+	SetCondition(ca, ChartAssignmentConditionReady, corev1.ConditionTrue, "", "")
+	c = ca.Status.Conditions[0]
+	if c.LastTransitionTime.Equal(&past) {
+		t.Errorf("transition time not changed on status change")
+	}
+	if len(ca.Status.Conditions) != 1 {
+		t.Errorf("got %d conditions, want 1", len(ca.Status.Conditions))
+	}
+}
+
+func TestGetCondition(t *testing.T) {
+	ca := &ChartAssignment{}
+	if c := GetCondition(ca, ChartAssignmentConditionSettled); c != nil {
+		t.Errorf("got condition %+v for empty status, want nil", c)
+	}
+	SetCondition(ca, ChartAssignmentConditionReady, corev1.ConditionFalse, "", "")
+	SetCondition(ca, ChartAssignmentConditionSettled, corev1.ConditionTrue, "", "done")
+
+	c := GetCondition(ca, ChartAssignmentConditionSettled)
+	if c == nil {
+		t.Fatal("Settled condition not found")
+	}
+	if c.Status != corev1.ConditionTrue || c.Message != "done" {
+		t.Errorf("unexpected condition %+v", c)
+	}
+}
@@ -284,6 +284,7 @@ type ChartAssignmentCondition struct {
 	Status             corev1.ConditionStatus       `json:"status"`
 	LastUpdateTime     metav1.Time                  `json:"lastUpdateTime,omitempty"`
 	LastTransitionTime metav1.Time                  `json:"lastTransitionTime,omitempty"`
+	Reason             string                       `json:"reason,omitempty"`
 	Message            string                       `json:"message,omitempty"`
 }
 
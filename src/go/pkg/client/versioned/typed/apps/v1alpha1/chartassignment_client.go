@@ -0,0 +1,58 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"time"
+
+	rest "k8s.io/client-go/rest"
+)
+
+type chartAssignmentClientOptions struct {
+	timeout time.Duration
+}
+
+// ChartAssignmentClientOption configures the client built by
+// NewChartAssignmentClient.
+type ChartAssignmentClientOption func(*chartAssignmentClientOptions)
+
+// WithRequestTimeout bounds the duration of every request of the client, so
+// that callers aren't blocked indefinitely by a hung API server. It also
+// applies to watches, which are closed after the timeout and need to be
+// restarted.
+func WithRequestTimeout(timeout time.Duration) ChartAssignmentClientOption {
+	return func(o *chartAssignmentClientOptions) {
+		o.timeout = timeout
+	}
+}
+
+// NewChartAssignmentClient returns a client for ChartAssignments for tools
+// that don't need the other resources of the apps group. The types of the
+// group are registered with the scheme of the client.
+func NewChartAssignmentClient(c *rest.Config, opts ...ChartAssignmentClientOption) (ChartAssignmentInterface, error) {
+	var o chartAssignmentClientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	config := *c
+	if o.timeout > 0 {
+		config.Timeout = o.timeout
+	}
+	client, err := NewForConfig(&config)
+	if err != nil {
+		return nil, err
+	}
+	return client.ChartAssignments(), nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	appsv1alpha1 "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+func TestNewChartAssignmentClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/apps.cloudrobotics.com/v1alpha1/chartassignments/ca1" {
+			http.NotFound(w, r)
+			return
+		}
+		ca := appsv1alpha1.ChartAssignment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps.cloudrobotics.com/v1alpha1", Kind: "ChartAssignment"},
+			ObjectMeta: metav1.ObjectMeta{Name: "ca1"},
+			Spec:       appsv1alpha1.ChartAssignmentSpec{ClusterName: "robot1"},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&ca)
+	}))
+	defer server.Close()
+
+	client, err := NewChartAssignmentClient(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := client.Get("ca1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.Name != "ca1" || ca.Spec.ClusterName != "robot1" {
+		t.Errorf("got unexpected ChartAssignment %+v", ca)
+	}
+}
+
+func TestNewChartAssignmentClientRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hang until the test is done.
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := NewChartAssignmentClient(&rest.Config{Host: server.URL}, WithRequestTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := client.Get("ca1", metav1.GetOptions{})
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("Get succeeded against a hung server")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get didn't time out")
+	}
+}
+
+func TestGetIfChangedSendsResourceVersion(t *testing.T) {
+	var gotRV string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRV = r.URL.Query().Get("resourceVersion")
+		ca := appsv1alpha1.ChartAssignment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps.cloudrobotics.com/v1alpha1", Kind: "ChartAssignment"},
+			ObjectMeta: metav1.ObjectMeta{Name: "ca1", ResourceVersion: "5"},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&ca)
+	}))
+	defer server.Close()
+
+	client, err := NewChartAssignmentClient(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca, changed, err := client.GetIfChanged("ca1", "5"); err != nil || changed || ca != nil {
+		t.Errorf("GetIfChanged(ca1, 5) = %v, %t, %v; want nil, false, nil", ca, changed, err)
+	}
+	if gotRV != "5" {
+		t.Errorf("got resourceVersion %q in request, want %q", gotRV, "5")
+	}
+	if ca, changed, err := client.GetIfChanged("ca1", "4"); err != nil || !changed || ca.ResourceVersion != "5" {
+		t.Errorf("GetIfChanged(ca1, 4) = %v, %t, %v; want version 5, true, nil", ca, changed, err)
+	}
+}
+
+func TestChartAssignmentEvents(t *testing.T) {
+	w := watch.NewFake()
+	events := ChartAssignmentEvents(w)
+
+	ca := func(name string) *appsv1alpha1.ChartAssignment {
+		return &appsv1alpha1.ChartAssignment{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	go func() {
+		w.Add(ca("ca1"))
+		w.Action(watch.Bookmark, ca("ca1"))
+		w.Error(&metav1.Status{Message: "expired"})
+		w.Modify(ca("ca1"))
+		w.Delete(ca("ca2"))
+		w.Stop()
+	}()
+
+	want := []struct {
+		typ  watch.EventType
+		name string
+	}{
+		{watch.Added, "ca1"},
+		{watch.Modified, "ca1"},
+		{watch.Deleted, "ca2"},
+	}
+	var got []ChartAssignmentEvent
+	timeout := time.After(10 * time.Second)
+	for done := false; !done; {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				done = true
+				break
+			}
+			got = append(got, e)
+		case <-timeout:
+			t.Fatal("timed out waiting for the events channel to be closed")
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d: %v", len(got), len(want), got)
+	}
+	for i, e := range got {
+		if e.Type != want[i].typ || e.Object.Name != want[i].name {
+			t.Errorf("event %d = %s %s, want %s %s", i, e.Type, e.Object.Name, want[i].typ, want[i].name)
+		}
+	}
+}
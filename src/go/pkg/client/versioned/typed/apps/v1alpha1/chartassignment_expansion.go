@@ -0,0 +1,89 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"log"
+
+	v1alpha1 "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// ChartAssignmentExpansion has the methods of ChartAssignmentInterface that
+// aren't generated.
+type ChartAssignmentExpansion interface {
+	// GetIfChanged returns the ChartAssignment and true if its resource
+	// version differs from lastResourceVersion, or nil and false if it
+	// doesn't. An empty lastResourceVersion always counts as changed.
+	GetIfChanged(name, lastResourceVersion string) (*v1alpha1.ChartAssignment, bool, error)
+	// WatchTyped is like Watch, but delivers the ChartAssignments as typed
+	// objects. The channel is closed when the watch ends. Call stop to end
+	// the watch early.
+	WatchTyped(opts v1.ListOptions) (events <-chan ChartAssignmentEvent, stop func(), err error)
+}
+
+// ChartAssignmentEvent is a watch event for a ChartAssignment.
+type ChartAssignmentEvent struct {
+	Type   watch.EventType
+	Object *v1alpha1.ChartAssignment
+}
+
+// ChartAssignmentEvents converts the events of a watch of ChartAssignments
+// to typed events until the watch ends. Bookmark events are dropped, and
+// error events and unexpected objects are logged and dropped.
+func ChartAssignmentEvents(w watch.Interface) <-chan ChartAssignmentEvent {
+	events := make(chan ChartAssignmentEvent)
+	go func() {
+		defer close(events)
+		for e := range w.ResultChan() {
+			switch e.Type {
+			case watch.Bookmark:
+				continue
+			case watch.Error:
+				log.Printf("Error event while watching ChartAssignments: %v", e.Object)
+				continue
+			}
+			ca, ok := e.Object.(*v1alpha1.ChartAssignment)
+			if !ok {
+				log.Printf("Unexpected object of type %T while watching ChartAssignments", e.Object)
+				continue
+			}
+			events <- ChartAssignmentEvent{Type: e.Type, Object: ca}
+		}
+	}()
+	return events
+}
+
+func (c *chartAssignments) GetIfChanged(name, lastResourceVersion string) (*v1alpha1.ChartAssignment, bool, error) {
+	// The resource version lets the API server answer from its watch cache
+	// instead of reading from etcd, which makes frequent polls cheap.
+	result, err := c.Get(name, v1.GetOptions{ResourceVersion: lastResourceVersion})
+	if err != nil {
+		return nil, false, err
+	}
+	if lastResourceVersion != "" && result.ResourceVersion == lastResourceVersion {
+		return nil, false, nil
+	}
+	return result, true, nil
+}
+
+func (c *chartAssignments) WatchTyped(opts v1.ListOptions) (<-chan ChartAssignmentEvent, func(), error) {
+	w, err := c.Watch(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ChartAssignmentEvents(w), w.Stop, nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	v1alpha1 "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	typed "github.com/googlecloudrobotics/core/src/go/pkg/client/versioned/typed/apps/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (c *FakeChartAssignments) GetIfChanged(name, lastResourceVersion string) (*v1alpha1.ChartAssignment, bool, error) {
+	result, err := c.Get(name, v1.GetOptions{ResourceVersion: lastResourceVersion})
+	if err != nil {
+		return nil, false, err
+	}
+	if lastResourceVersion != "" && result.ResourceVersion == lastResourceVersion {
+		return nil, false, nil
+	}
+	return result, true, nil
+}
+
+func (c *FakeChartAssignments) WatchTyped(opts v1.ListOptions) (<-chan typed.ChartAssignmentEvent, func(), error) {
+	w, err := c.Watch(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return typed.ChartAssignmentEvents(w), w.Stop, nil
+}
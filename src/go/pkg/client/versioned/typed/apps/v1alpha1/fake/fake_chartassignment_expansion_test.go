@@ -0,0 +1,49 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake_test
+
+import (
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/googlecloudrobotics/core/src/go/pkg/client/versioned/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetIfChanged(t *testing.T) {
+	client := fake.NewSimpleClientset(&apps.ChartAssignment{
+		ObjectMeta: metav1.ObjectMeta{Name: "ca1", ResourceVersion: "5"},
+	}).AppsV1alpha1().ChartAssignments()
+
+	ca, changed, err := client.GetIfChanged("ca1", "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed || ca != nil {
+		t.Errorf("GetIfChanged(ca1, 5) = %v, %t; want nil, false", ca, changed)
+	}
+
+	ca, changed, err = client.GetIfChanged("ca1", "4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || ca == nil || ca.Name != "ca1" {
+		t.Errorf("GetIfChanged(ca1, 4) = %v, %t; want ca1, true", ca, changed)
+	}
+
+	if _, _, err := client.GetIfChanged("ca2", "4"); err == nil {
+		t.Error("GetIfChanged(ca2, 4) succeeded for a missing object")
+	}
+}
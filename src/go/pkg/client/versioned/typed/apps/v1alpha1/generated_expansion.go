@@ -20,6 +20,4 @@ type AppExpansion interface{}
 
 type AppRolloutExpansion interface{}
 
-type ChartAssignmentExpansion interface{}
-
 type ResourceSetExpansion interface{}
@@ -453,43 +453,14 @@ func setOwnerReference(om *meta.ObjectMeta, ref meta.OwnerReference) bool {
 // inCondition returns true if the ChartAssignment has a condition of the given
 // type in state true.
 func inCondition(as *apps.ChartAssignment, c apps.ChartAssignmentConditionType) bool {
-	for _, cond := range as.Status.Conditions {
-		if cond.Type == c && cond.Status == core.ConditionTrue {
-			return true
-		}
-	}
-	return false
+	cond := apps.GetCondition(as, c)
+	return cond != nil && cond.Status == core.ConditionTrue
 }
 
 // setCondition adds or updates a condition. Existing conditions are detected
 // based on the Type field.
 func setCondition(as *apps.ChartAssignment, t apps.ChartAssignmentConditionType, v core.ConditionStatus, msg string) {
-	now := meta.Now()
-
-	for i, c := range as.Status.Conditions {
-		if c.Type != t {
-			continue
-		}
-		// Update existing condition.
-		if c.Status != v || c.Message != msg {
-			c.LastUpdateTime = now
-		}
-		if c.Status != v {
-			c.LastTransitionTime = now
-		}
-		c.Message = msg
-		c.Status = v
-		as.Status.Conditions[i] = c
-		return
-	}
-	// Condition set for the first time.
-	as.Status.Conditions = append(as.Status.Conditions, apps.ChartAssignmentCondition{
-		Type:               t,
-		LastUpdateTime:     now,
-		LastTransitionTime: now,
-		Status:             v,
-		Message:            msg,
-	})
+	apps.SetCondition(as, t, v, "", msg)
 }
 
 // NewValidationWebhook returns a new webhook that validates ChartAssignments.
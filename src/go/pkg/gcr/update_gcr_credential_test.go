@@ -15,6 +15,9 @@
 package gcr
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -33,3 +36,37 @@ func TestDockercfgJSON(t *testing.T) {
 
 	g.Expect(gotJSON).To(MatchJSON(expectedJSON))
 }
+
+func TestMultiRegistryDockerCfgJSON(t *testing.T) {
+	g := NewGomegaWithT(t)
+	expectedJSON := `{
+  "https://gcr.io":{"username":"oauth2accesstoken","password":"ya29.yaddayadda","email":"not@val.id","auth":"b2F1dGgyYWNjZXNzdG9rZW46eWEyOS55YWRkYXlhZGRh"},
+  "https://europe-docker.pkg.dev":{"username":"oauth2accesstoken","password":"ya29.yaddayadda","email":"not@val.id","auth":"b2F1dGgyYWNjZXNzdG9rZW46eWEyOS55YWRkYXlhZGRh"},
+  "http://mirror.local:5000":{"username":"robot","password":"secret","email":"not@val.id","auth":"cm9ib3Q6c2VjcmV0"}
+}`
+
+	gotJSON := MultiRegistryDockerCfgJSON([]RegistryCredential{
+		{Registry: "gcr.io", Username: "oauth2accesstoken", Password: "ya29.yaddayadda"},
+		{Registry: "europe-docker.pkg.dev", Username: "oauth2accesstoken", Password: "ya29.yaddayadda"},
+		{Registry: "http://mirror.local:5000", Username: "robot", Password: "secret"},
+	})
+
+	g.Expect(gotJSON).To(MatchJSON(expectedJSON))
+}
+
+func TestVerifyCredential(t *testing.T) {
+	g := NewGomegaWithT(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.URL.Path).To(Equal("/v2/"))
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "oauth2accesstoken" || password != "ya29.valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	g.Expect(VerifyCredential(context.Background(), server.URL, "ya29.valid")).To(Succeed())
+	g.Expect(VerifyCredential(context.Background(), server.URL, "ya29.invalid")).NotTo(Succeed())
+}
@@ -22,6 +22,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -37,9 +39,42 @@ import (
 // Name of the secret that stores the GCR pull token.
 const SecretName = "gcr-json-key"
 
+// Registry that is used to check whether a freshly minted token is accepted.
+const verifyRegistry = "gcr.io"
+
+const verifyTimeout = 30 * time.Second
+
+// RegistryCredential is the auth entry for a single registry in a dockercfg.
+type RegistryCredential struct {
+	// Registry host name (eg "gcr.io") or URL.
+	Registry string
+	Username string
+	Password string
+}
+
+// gcrCredentials returns the auth entries of the GCR registries for the
+// given access token.
+func gcrCredentials(token string) []RegistryCredential {
+	creds := []RegistryCredential{}
+	for _, r := range []string{"gcr.io", "asia.gcr.io", "eu.gcr.io", "us.gcr.io"} {
+		creds = append(creds, RegistryCredential{
+			Registry: r,
+			Username: "oauth2accesstoken",
+			Password: token,
+		})
+	}
+	return creds
+}
+
 // DockerCfgJSON takes a service account key, and converts it into the JSON
 // format required for k8s's docker-registry secrets.
 func DockerCfgJSON(token string) []byte {
+	return MultiRegistryDockerCfgJSON(gcrCredentials(token))
+}
+
+// MultiRegistryDockerCfgJSON builds a dockercfg with one auth entry per
+// registry, so that a single image pull secret covers all of them.
+func MultiRegistryDockerCfgJSON(creds []RegistryCredential) []byte {
 	type dockercfg struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
@@ -48,12 +83,16 @@ func DockerCfgJSON(token string) []byte {
 	}
 
 	m := map[string]interface{}{}
-	for _, r := range []string{"gcr.io", "asia.gcr.io", "eu.gcr.io", "us.gcr.io"} {
-		m["https://"+r] = dockercfg{
-			Username: "oauth2accesstoken",
-			Password: string(token),
+	for _, c := range creds {
+		r := c.Registry
+		if !strings.Contains(r, "://") {
+			r = "https://" + r
+		}
+		m[r] = dockercfg{
+			Username: c.Username,
+			Password: c.Password,
 			Email:    "not@val.id",
-			Auth:     []byte("oauth2accesstoken:" + token),
+			Auth:     []byte(c.Username + ":" + c.Password),
 		}
 	}
 	b, err := json.Marshal(m)
@@ -63,6 +102,39 @@ func DockerCfgJSON(token string) []byte {
 	return b
 }
 
+// VerifyCredential checks that the given access token authenticates against
+// the registry. It queries the registry's API version check endpoint
+// (/v2/) and returns an error if the registry rejects the credentials.
+// The registry can be given as a host name ("gcr.io") or as a URL.
+func VerifyCredential(ctx context.Context, registry string, token string) error {
+	url := registry
+	if !strings.Contains(url, "://") {
+		url = "https://" + url
+	}
+	url = strings.TrimSuffix(url, "/") + "/v2/"
+
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %v", registry, err)
+	}
+	req.SetBasicAuth("oauth2accesstoken", token)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %v", registry, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("registry %s rejected credentials: %s", registry, resp.Status)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("unexpected response from registry %s: %s", registry, resp.Status)
+	}
+	return nil
+}
+
 func patchServiceAccount(k8s *kubernetes.Clientset, name string, namespace string, patchData []byte) error {
 	sa := k8s.CoreV1().ServiceAccounts(namespace)
 	return backoff.Retry(
@@ -78,20 +150,25 @@ func patchServiceAccount(k8s *kubernetes.Clientset, name string, namespace strin
 }
 
 // UpdateGcrCredentials authenticates to the cloud cluster using the auth config given and updates
-// the credentials used to pull images from GCR.
-func UpdateGcrCredentials(k8s *kubernetes.Clientset, auth *robotauth.RobotAuth) error {
+// the credentials used to pull images from GCR. The auth entries of any extra registries are added
+// to the same secret, so that it covers all of them.
+func UpdateGcrCredentials(k8s *kubernetes.Clientset, auth *robotauth.RobotAuth, extra ...RegistryCredential) error {
 	ctx := context.Background()
 	tokenSource := auth.CreateRobotTokenSource(ctx)
 	token, err := tokenSource.Token()
 	if err != nil {
 		return fmt.Errorf("failed to get token: %v", err)
 	}
+	if err := VerifyCredential(ctx, verifyRegistry, token.AccessToken); err != nil {
+		return fmt.Errorf("failed to verify token: %v", err)
+	}
 
 	nsList, err := k8s.CoreV1().Namespaces().List(metav1.ListOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to list namespaces: %v", err)
 	}
-	cfgData := map[string][]byte{".dockercfg": DockerCfgJSON(token.AccessToken)}
+	creds := append(gcrCredentials(token.AccessToken), extra...)
+	cfgData := map[string][]byte{".dockercfg": MultiRegistryDockerCfgJSON(creds)}
 	patchData := []byte(`{"imagePullSecrets": [{"name": "` + SecretName + `"}]}`)
 	haveError := false
 	for _, ns := range nsList.Items {
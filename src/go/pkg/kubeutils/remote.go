@@ -0,0 +1,106 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubeutils
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/motemen/go-loghttp"
+	"golang.org/x/oauth2"
+	"k8s.io/client-go/rest"
+)
+
+// Path prefix under which the cloud cluster's Kubernetes API is exposed.
+const remoteAPIPrefix = "/apis/core.kubernetes"
+
+type remoteConfigOptions struct {
+	verbose   bool
+	configure func(http.RoundTripper)
+	wrap      []func(http.RoundTripper) http.RoundTripper
+}
+
+// RemoteConfigOption configures the transport built by RemoteConfig.
+type RemoteConfigOption func(*remoteConfigOptions)
+
+// WithVerboseLogging logs all HTTP requests to the remote server if verbose
+// is true.
+func WithVerboseLogging(verbose bool) RemoteConfigOption {
+	return func(o *remoteConfigOptions) {
+		o.verbose = verbose
+	}
+}
+
+// WithBaseTransport calls configure with the underlying transport before
+// it is wrapped, eg to tweak connection settings.
+func WithBaseTransport(configure func(http.RoundTripper)) RemoteConfigOption {
+	return func(o *remoteConfigOptions) {
+		o.configure = configure
+	}
+}
+
+// WithTransportWrapper wraps the authenticated transport with wrap, eg to
+// collect metrics. Wrappers are applied in the order they are given.
+func WithTransportWrapper(wrap func(http.RoundTripper) http.RoundTripper) RemoteConfigOption {
+	return func(o *remoteConfigOptions) {
+		o.wrap = append(o.wrap, wrap)
+	}
+}
+
+// RemoteConfig assembles the REST config for accessing the cloud cluster
+// through server, authenticating with tokens from ts. All requests carry
+// ctx, which can be used to provide static OpenCensus tags as client-go
+// provides no context hooks.
+func RemoteConfig(ctx context.Context, server string, ts oauth2.TokenSource, opts ...RemoteConfigOption) *rest.Config {
+	var o remoteConfigOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	transport := func(base http.RoundTripper) (rt http.RoundTripper) {
+		if o.configure != nil {
+			o.configure(base)
+		}
+		rt = &oauth2.Transport{
+			Source: ts,
+			Base:   base,
+		}
+		rt = &PrefixingRoundtripper{
+			Prefix: remoteAPIPrefix,
+			Base:   rt,
+		}
+		if o.verbose {
+			rt = &loghttp.Transport{Transport: rt}
+		}
+		for _, wrap := range o.wrap {
+			rt = wrap(rt)
+		}
+		return &ctxRoundTripper{base: rt, ctx: ctx}
+	}
+	return &rest.Config{
+		Host:          server,
+		APIPath:       "/apis",
+		WrapTransport: transport,
+	}
+}
+
+// ctxRoundTripper injects a fixed context into all requests.
+type ctxRoundTripper struct {
+	base http.RoundTripper
+	ctx  context.Context
+}
+
+func (r *ctxRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r.base.RoundTrip(req.WithContext(r.ctx))
+}
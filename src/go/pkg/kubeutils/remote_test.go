@@ -0,0 +1,67 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubeutils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+	"k8s.io/client-go/rest"
+)
+
+func TestRemoteConfig(t *testing.T) {
+	var gotPath, gotAuth string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	wrapped := false
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	config := RemoteConfig(context.Background(), server.URL, ts,
+		WithTransportWrapper(func(rt http.RoundTripper) http.RoundTripper {
+			wrapped = true
+			return rt
+		}))
+	config.Insecure = true
+
+	rt, err := rest.TransportFor(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("GET", server.URL+"/api/v1/namespaces", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if want := "/apis/core.kubernetes/api/v1/namespaces"; gotPath != want {
+		t.Errorf("request path = %q, want %q", gotPath, want)
+	}
+	if want := "Bearer token"; gotAuth != want {
+		t.Errorf("Authorization header = %q, want %q", gotAuth, want)
+	}
+	if !wrapped {
+		t.Error("transport wrapper was not applied")
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubeutils
+
+import (
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// SecretsResource is the resource of Secrets for use with dynamic clients.
+var SecretsResource = corev1.SchemeGroupVersion.WithResource("secrets")
+
+// MirrorSecret copies the type, data, labels and annotations of the secret
+// with the given name from src to dst, where it is created or overwritten.
+// src and dst are Secret clients for the source and destination namespaces.
+// The annotations given are added to the copy.
+func MirrorSecret(src, dst dynamic.ResourceInterface, name string, annotations map[string]string) error {
+	secret, err := src.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "get source secret")
+	}
+	mirror, err := dst.Get(name, metav1.GetOptions{})
+	exists := err == nil
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return errors.Wrap(err, "get secret")
+		}
+		mirror = &unstructured.Unstructured{Object: make(map[string]interface{})}
+		mirror.SetAPIVersion("v1")
+		mirror.SetKind("Secret")
+		mirror.SetName(name)
+	}
+	mirror.SetLabels(secret.GetLabels())
+	mirrorAnnotations := secret.GetAnnotations()
+	if mirrorAnnotations == nil {
+		mirrorAnnotations = map[string]string{}
+	}
+	for k, v := range annotations {
+		mirrorAnnotations[k] = v
+	}
+	mirror.SetAnnotations(mirrorAnnotations)
+	for _, f := range []string{"type", "data"} {
+		if v, ok := secret.Object[f]; ok {
+			mirror.Object[f] = v
+		} else {
+			delete(mirror.Object, f)
+		}
+	}
+	if exists {
+		_, err = dst.Update(mirror, metav1.UpdateOptions{})
+		return errors.Wrap(err, "update secret")
+	}
+	_, err = dst.Create(mirror, metav1.CreateOptions{})
+	return errors.Wrap(err, "create secret")
+}
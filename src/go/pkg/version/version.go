@@ -0,0 +1,31 @@
+// Copyright 2019 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package version provides the build information that is injected by the
+// linker when stamped binaries are built, eg with
+// "bazel build --stamp //src/go/cmd/cr-syncer".
+package version
+
+import "runtime"
+
+// Set by the linker, see BUILD.bazel. Unstamped builds report "unknown".
+var (
+	Version   = "unknown"
+	GitCommit = "unknown"
+)
+
+// GoVersion returns the version of Go the binary was built with.
+func GoVersion() string {
+	return runtime.Version()
+}